@@ -1,14 +1,31 @@
 package main
 
 import (
+	"context"
 	"fmt"
+	"maps"
 	"os"
+	"time"
 
+	"github.com/redis/go-redis/v9"
 	"go.uber.org/zap"
 
 	"nft-proxy/internal/alchemy"
+	"nft-proxy/internal/budget"
+	"nft-proxy/internal/cache"
 	"nft-proxy/internal/config"
 	"nft-proxy/internal/handlers"
+	"nft-proxy/internal/health"
+	"nft-proxy/internal/jwtauth"
+	"nft-proxy/internal/limiter"
+	"nft-proxy/internal/projection"
+	"nft-proxy/internal/ratelimit"
+	"nft-proxy/internal/redact"
+	"nft-proxy/internal/signedurl"
+	"nft-proxy/internal/spam"
+	"nft-proxy/internal/tenant"
+	"nft-proxy/internal/tracing"
+	"nft-proxy/internal/warmup"
 )
 
 // CompositionRoot holds all application dependencies and provides a centralized
@@ -20,9 +37,21 @@ type CompositionRoot struct {
 	Logger  *zap.Logger
 
 	// Services
-	AlchemyClient *alchemy.Client
-	HTTPServer    *handlers.Server
-	MetricsServer *handlers.MetricsServer
+	AlchemyClient   *alchemy.Client
+	UpstreamLimiter *limiter.Limiter
+	BudgetTracker   *budget.Tracker
+	ResponseCache   *cache.Cache
+	DiskCache       *cache.Disk
+	KeyDB           *redis.Client
+	Readiness       *health.Checker
+	Prober          *health.Prober
+	HotKeys         *warmup.Tracker
+	Warmer          *warmup.Warmer
+	SpamFilter      *spam.Filter
+	HTTPServer      *handlers.Server
+	MetricsServer   *handlers.MetricsServer
+
+	shutdownTracing func(context.Context) error
 }
 
 // NewCompositionRoot creates and initializes all application dependencies
@@ -41,10 +70,18 @@ func NewCompositionRoot() (*CompositionRoot, error) {
 		return nil, fmt.Errorf("failed to load API keys: %w", err)
 	}
 
+	root.redactLogs()
+
+	if err := root.initTracing(); err != nil {
+		return nil, fmt.Errorf("failed to initialize tracing: %w", err)
+	}
+
 	if err := root.initServices(); err != nil {
 		return nil, fmt.Errorf("failed to initialize services: %w", err)
 	}
 
+	root.initReadiness()
+
 	if err := root.initHTTPServer(); err != nil {
 		return nil, fmt.Errorf("failed to initialize HTTP server: %w", err)
 	}
@@ -53,6 +90,8 @@ func NewCompositionRoot() (*CompositionRoot, error) {
 		return nil, fmt.Errorf("failed to initialize metrics server: %w", err)
 	}
 
+	root.initWarmup()
+
 	return root, nil
 }
 
@@ -109,32 +148,405 @@ func (r *CompositionRoot) loadAPIKeys() error {
 	return nil
 }
 
+// redactLogs makes the logger strip the Alchemy API keys, webhook signing
+// keys and URL signing keys from every entry, as a safety net for errors that
+// quote upstream URLs
+func (r *CompositionRoot) redactLogs() {
+	secrets := append([]string{r.Config.Alchemy.APIKey}, r.APIKeys...)
+	secrets = append(secrets, r.Config.Webhook.SigningKeys...)
+	secrets = append(secrets, r.Config.SignedURLs.Keys...)
+	redactor := redact.New(secrets...)
+	r.Logger = r.Logger.WithOptions(zap.WrapCore(redactor.WrapCore))
+}
+
+// initTracing installs the OpenTelemetry tracer provider if tracing is enabled
+func (r *CompositionRoot) initTracing() error {
+	tc := r.Config.Tracing
+	if !tc.Enabled {
+		return nil
+	}
+
+	shutdown, err := tracing.Setup(context.Background(), tracing.Options{
+		Endpoint:    tc.Endpoint,
+		ServiceName: tc.ServiceName,
+		SampleRatio: tc.SampleRatio,
+	})
+	if err != nil {
+		return err
+	}
+	r.shutdownTracing = shutdown
+	r.Logger.Info("Tracing enabled", zap.String("endpoint", tc.Endpoint), zap.Float64("sample_ratio", tc.SampleRatio))
+	return nil
+}
+
 // initServices initializes application services
 func (r *CompositionRoot) initServices() error {
 	// In the future, this could be enhanced with rotation logic
 	apiKey := r.APIKeys[0]
 
+	var clientOpts []alchemy.Option
+	if rl := r.Config.Alchemy.RateLimit; rl.Enabled {
+		throttle := alchemy.NewThrottle(alchemy.ThrottleOptions{
+			ComputeUnitsPerSecond: rl.ComputeUnitsPerSecond,
+			Burst:                 rl.Burst,
+			MaxWait:               rl.MaxWait,
+			Cost:                  r.Config.Alchemy.ComputeUnits.Cost,
+		})
+		clientOpts = append(clientOpts, alchemy.WithThrottle(throttle))
+	}
+
+	if bc := r.Config.Alchemy.Breaker; bc.Enabled {
+		clientOpts = append(clientOpts, alchemy.WithBreakers(alchemy.NewBreakers(alchemy.BreakerOptions{
+			Failures: bc.Failures,
+			Cooldown: bc.Cooldown,
+		})))
+	}
+
+	if bc := r.Config.Budget; bc.Enabled {
+		tracker, err := budget.NewTracker(budget.Options{
+			Cost:      r.Config.Alchemy.ComputeUnits.Cost,
+			Daily:     budget.Limits{Soft: bc.Daily.Soft, Hard: bc.Daily.Hard},
+			Monthly:   budget.Limits{Soft: bc.Monthly.Soft, Hard: bc.Monthly.Hard},
+			StateFile: bc.StateFile,
+		}, r.Logger)
+		if err != nil {
+			return fmt.Errorf("failed to initialize compute unit budget: %w", err)
+		}
+		tracker.Start(bc.FlushInterval)
+		r.BudgetTracker = tracker
+		clientOpts = append(clientOpts, alchemy.WithUsageTracker(tracker))
+	}
+
 	r.AlchemyClient = alchemy.NewClient(
 		apiKey,
 		r.Config.Alchemy.BaseURLs,
 		r.Config.Alchemy.Retry,
+		clientOpts...,
 	)
 
+	if cc := r.Config.Alchemy.Concurrency; cc.Enabled {
+		r.UpstreamLimiter = limiter.New(limiter.Options{
+			Adaptive:     cc.Adaptive,
+			InitialLimit: cc.InitialLimit,
+			MinLimit:     cc.MinLimit,
+			MaxLimit:     cc.MaxLimit,
+			MaxQueue:     *cc.MaxQueue,
+			QueueTimeout: cc.QueueTimeout,
+		})
+	}
+
+	if r.Config.Cache.Enabled {
+		tiers := []cache.Tier{
+			cache.NewMemory(r.Config.Cache.L1.MaxEntries, r.Config.Cache.L1.MaxBytes),
+		}
+		if dc := r.Config.Cache.Disk; dc.Path != "" {
+			disk, err := cache.OpenDisk(dc.Path, dc.MaxBytes, dc.SweepInterval)
+			if err != nil {
+				return err
+			}
+			r.DiskCache = disk
+			tiers = append(tiers, disk)
+			r.Logger.Info("Disk cache enabled", zap.String("path", dc.Path), zap.Int("entries", disk.Len()))
+		}
+		if l2 := r.Config.Cache.L2; l2.URL != "" {
+			opts, err := redis.ParseURL(l2.URL)
+			if err != nil {
+				return fmt.Errorf("invalid L2 cache URL: %w", err)
+			}
+			opts.DialTimeout = l2.Timeout
+			opts.ReadTimeout = l2.Timeout
+			opts.WriteTimeout = l2.Timeout
+			r.KeyDB = redis.NewClient(opts)
+			tiers = append(tiers, cache.NewKeyDB(r.KeyDB))
+			r.Logger.Info("L2 cache enabled", zap.String("keydb", opts.Addr))
+		}
+
+		rules, err := cacheRules(r.Config.Cache)
+		if err != nil {
+			return err
+		}
+		r.ResponseCache = cache.New(r.Logger, rules, tiers...)
+	}
+
+	return nil
+}
+
+// initReadiness registers the component checks served on /ready
+func (r *CompositionRoot) initReadiness() {
+	rc := r.Config.Readiness
+	r.Readiness = health.NewChecker(rc.Timeout)
+
+	r.Readiness.Add("config", func(context.Context) (any, error) {
+		chains := r.AlchemyClient.Chains()
+		if len(chains) == 0 {
+			return nil, fmt.Errorf("no chains configured")
+		}
+		return map[string]int{"chains": len(chains)}, nil
+	})
+	r.Readiness.Add("api_keys", r.AlchemyClient.CheckKeys)
+	if r.Config.Alchemy.Breaker.Enabled {
+		r.Readiness.Add("circuit_breakers", r.AlchemyClient.CheckBreakers)
+	}
+	if r.KeyDB != nil {
+		r.Readiness.Add("l2_cache", func(ctx context.Context) (any, error) {
+			return nil, r.KeyDB.Ping(ctx).Err()
+		})
+	}
+
+	if pc := rc.Probe; pc.Enabled {
+		r.Prober = health.NewProber(r.AlchemyClient, health.ProbeOptions{
+			Chains:   r.AlchemyClient.Chains(),
+			Path:     pc.Path,
+			Query:    pc.Query,
+			Interval: pc.Interval,
+			Timeout:  pc.Timeout,
+		}, r.Logger)
+		r.Prober.Start()
+		r.Readiness.Add("alchemy_probe", r.Prober.Check)
+	}
+}
+
+// cacheRules converts the per-endpoint cache configuration into cache rules.
+// An endpoint's negative TTLs override the default ones status by status.
+func cacheRules(cfg config.CacheConfig) (cache.Rules, error) {
+	if err := checkNegativeTTL(cfg.NegativeTTL); err != nil {
+		return cache.Rules{}, err
+	}
+	rules := cache.Rules{
+		Default:   cache.Rule{TTL: cfg.DefaultTTL, NegativeTTL: cfg.NegativeTTL},
+		Endpoints: make(map[string]cache.Rule, len(cfg.Rules)),
+	}
+	for endpoint, rule := range cfg.Rules {
+		if err := checkNegativeTTL(rule.NegativeTTL); err != nil {
+			return cache.Rules{}, fmt.Errorf("cache rule %s: %w", endpoint, err)
+		}
+		negative := make(map[int]time.Duration, len(cfg.NegativeTTL)+len(rule.NegativeTTL))
+		maps.Copy(negative, cfg.NegativeTTL)
+		maps.Copy(negative, rule.NegativeTTL)
+		rules.Endpoints[endpoint] = cache.Rule{TTL: rule.TTL, NegativeTTL: negative}
+	}
+	return rules, nil
+}
+
+// checkNegativeTTL rejects negative TTLs for statuses that must not be cached
+func checkNegativeTTL(ttls map[int]time.Duration) error {
+	for status := range ttls {
+		if !cache.NegativeCacheable(status) {
+			return fmt.Errorf("status %d cannot be negatively cached", status)
+		}
+	}
 	return nil
 }
 
 // initHTTPServer initializes the HTTP server
 func (r *CompositionRoot) initHTTPServer() error {
+	var opts []handlers.ServerOption
+	if r.UpstreamLimiter != nil {
+		opts = append(opts, handlers.WithConcurrencyLimiter(r.UpstreamLimiter, r.Config.Alchemy.Concurrency.RetryAfter))
+	}
+	if r.ResponseCache != nil {
+		opts = append(opts, handlers.WithCache(r.ResponseCache, r.Config.Cache.MaxEntryBytes))
+	}
+	opts = append(opts, handlers.WithReadiness(r.Readiness))
+	if wc := r.Config.Warmup; wc.Enabled && wc.HotKeys.Enabled && r.ResponseCache != nil {
+		r.HotKeys = warmup.NewTracker(wc.HotKeys.Capacity)
+		opts = append(opts, handlers.WithHotKeyTracker(r.HotKeys))
+	}
+	if keys := r.Config.Webhook.SigningKeys; len(keys) > 0 {
+		opts = append(opts, handlers.WithAlchemyWebhook(keys))
+	}
+	if presets := r.Config.Server.Projection.Presets; len(presets) > 0 {
+		for name := range presets {
+			if _, err := projection.Parse("@"+name, presets); err != nil {
+				return fmt.Errorf("invalid projection preset %s: %w", name, err)
+			}
+		}
+		opts = append(opts, handlers.WithProjectionPresets(presets))
+	}
+	if sc := r.Config.Spam; sc.Enabled {
+		filter, err := spam.New(spam.Options{
+			Mode:           sc.Mode,
+			ListsFile:      sc.ListsFile,
+			ReloadInterval: sc.ReloadInterval,
+			Heuristics:     sc.Heuristics,
+		}, r.Logger.Named("spam"))
+		if err != nil {
+			return fmt.Errorf("failed to initialize spam filter: %w", err)
+		}
+		r.SpamFilter = filter
+		r.SpamFilter.Start()
+		opts = append(opts, handlers.WithSpamFilter(r.SpamFilter))
+	}
+	if tc := r.Config.Tenants; tc.Enabled {
+		tenants, err := tenantRegistry(tc, r.Config.Alchemy.ComputeUnits.Cost)
+		if err != nil {
+			return fmt.Errorf("invalid tenant configuration: %w", err)
+		}
+		opts = append(opts, handlers.WithTenants(tenants))
+	}
+	if rc := r.Config.ClientRateLimit; rc.Enabled {
+		rateLimit, err := r.rateLimiter(rc)
+		if err != nil {
+			return fmt.Errorf("failed to initialize rate limit: %w", err)
+		}
+		opts = append(opts, handlers.WithRateLimit(rateLimit))
+	}
+	if jc := r.Config.JWTAuth; jc.Enabled {
+		auth, err := r.jwtAuthenticator(jc)
+		if err != nil {
+			return fmt.Errorf("failed to initialize JWT authentication: %w", err)
+		}
+		opts = append(opts, handlers.WithJWTAuth(auth))
+	} else if jc.ListenAddr != "" {
+		return fmt.Errorf("jwt_auth.listen_addr needs jwt_auth.enabled, the TCP listener has no other authentication")
+	}
+	if sc := r.Config.SignedURLs; len(sc.Keys) > 0 {
+		signer, err := signedurl.New(sc.Keys, sc.MaxTTL)
+		if err != nil {
+			return fmt.Errorf("failed to initialize signed URLs: %w", err)
+		}
+		opts = append(opts, handlers.WithSignedURLs(signer))
+	}
+	if al := r.Config.Server.AccessLog; al.Enabled {
+		opts = append(opts, handlers.WithAccessLog(r.Logger.Named("access"), al.SampleRate))
+	}
+
 	r.HTTPServer = handlers.NewServer(
 		r.AlchemyClient,
 		r.Logger,
+		opts...,
 	)
 
 	return nil
 }
 
+// rateLimiter creates the per-client rate limit over its configured store
+func (r *CompositionRoot) rateLimiter(rc config.ClientRateLimitConfig) (*ratelimit.Limiter, error) {
+	var store ratelimit.Store
+	switch rc.Store {
+	case "memory":
+		store = ratelimit.NewMemory()
+	case "keydb":
+		if r.KeyDB == nil {
+			return nil, fmt.Errorf("the keydb store needs the L2 cache, set cache.l2.url")
+		}
+		store = ratelimit.NewKeyDB(r.KeyDB)
+	default:
+		return nil, fmt.Errorf("unknown rate limit store %q, expected \"memory\" or \"keydb\"", rc.Store)
+	}
+
+	return ratelimit.New(ratelimit.Options{
+		Requests: rc.Requests,
+		Period:   rc.Period,
+		Burst:    rc.Burst,
+		HitCost:  rc.HitCost,
+	}, store)
+}
+
+// jwtAuthenticator creates the JWT validator from the auth service's secret
+func (r *CompositionRoot) jwtAuthenticator(jc config.JWTAuthConfig) (*jwtauth.Authenticator, error) {
+	secrets, err := jwtauth.LoadSecrets(jc.AuthConfigFile)
+	if err != nil {
+		return nil, err
+	}
+
+	var counter jwtauth.Counter
+	switch jc.Store {
+	case "memory":
+		counter = jwtauth.NewMemory()
+	case "keydb":
+		if r.KeyDB == nil {
+			return nil, fmt.Errorf("the keydb store needs the L2 cache, set cache.l2.url")
+		}
+		counter = jwtauth.NewKeyDB(r.KeyDB)
+	default:
+		return nil, fmt.Errorf("unknown token counter store %q, expected \"memory\" or \"keydb\"", jc.Store)
+	}
+	return jwtauth.New(secrets, counter), nil
+}
+
+// tenantRegistry builds the per-client policies from the configuration
+func tenantRegistry(tc config.TenantsConfig, cost func(endpoint string) int) (*tenant.Registry, error) {
+	policies := make([]tenant.Policy, 0, len(tc.Policies))
+	for _, pc := range tc.Policies {
+		policies = append(policies, tenant.Policy{
+			Name:              pc.Name,
+			Identities:        pc.Identities,
+			Chains:            pc.Chains,
+			Endpoints:         pc.Endpoints,
+			RequestsPerSecond: pc.RateLimit.RequestsPerSecond,
+			Burst:             pc.RateLimit.Burst,
+			DailyComputeUnits: pc.DailyComputeUnits,
+			Priority:          pc.Priority,
+		})
+	}
+	return tenant.New(tenant.Options{Policies: policies, Default: tc.Default, Cost: cost})
+}
+
+// initWarmup starts prefetching the seed requests and refreshing hot keys
+func (r *CompositionRoot) initWarmup() {
+	wc := r.Config.Warmup
+	if !wc.Enabled || r.ResponseCache == nil {
+		return
+	}
+
+	seeds := make(map[string]warmup.Seed, len(wc.Seeds))
+	for chain, seed := range wc.Seeds {
+		seeds[chain] = warmup.Seed{Contracts: seed.Contracts, Owners: seed.Owners}
+	}
+	r.Warmer = warmup.New(r.HTTPServer, warmup.Options{
+		Concurrency:      wc.Concurrency,
+		Seeds:            seeds,
+		ContractRequests: wc.ContractRequests,
+		OwnerRequests:    wc.OwnerRequests,
+		Tracker:          r.HotKeys,
+		TopN:             wc.HotKeys.TopN,
+		Interval:         wc.HotKeys.Interval,
+		RefreshBefore:    wc.HotKeys.RefreshBefore,
+	}, r.Logger.Named("warmup"))
+	r.Warmer.Start()
+}
+
 // Cleanup performs cleanup of all resources
 func (r *CompositionRoot) Cleanup() error {
+	if r.Warmer != nil {
+		r.Warmer.Stop()
+	}
+
+	if r.BudgetTracker != nil {
+		if err := r.BudgetTracker.Close(); err != nil {
+			r.Logger.Error("Failed to persist compute unit usage", zap.Error(err))
+		}
+	}
+
+	if r.Prober != nil {
+		r.Prober.Stop()
+	}
+
+	if r.SpamFilter != nil {
+		r.SpamFilter.Stop()
+	}
+
+	if r.DiskCache != nil {
+		if err := r.DiskCache.Close(); err != nil {
+			r.Logger.Error("Failed to close disk cache", zap.Error(err))
+		}
+	}
+
+	if r.KeyDB != nil {
+		if err := r.KeyDB.Close(); err != nil {
+			r.Logger.Error("Failed to close KeyDB client", zap.Error(err))
+		}
+	}
+
+	if r.shutdownTracing != nil {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := r.shutdownTracing(ctx); err != nil {
+			r.Logger.Error("Failed to flush traces", zap.Error(err))
+		}
+	}
+
 	if r.Logger != nil {
 		if err := r.Logger.Sync(); err != nil {
 			return fmt.Errorf("failed to sync logger: %w", err)
@@ -146,7 +558,25 @@ func (r *CompositionRoot) Cleanup() error {
 
 // initMetricsServer initializes the metrics HTTP server
 func (r *CompositionRoot) initMetricsServer() error {
-	r.MetricsServer = handlers.NewMetricsServer(r.Logger)
+	opts := []handlers.MetricsServerOption{
+		handlers.WithBearerToken(r.Config.Metrics.BearerToken),
+		handlers.WithMetricsReadiness(r.Readiness),
+	}
+	if r.ResponseCache != nil {
+		opts = append(opts,
+			handlers.WithCacheInspector(r.HTTPServer),
+			handlers.WithCachePurger(r.HTTPServer),
+			handlers.WithCacheSnapshots(r.HTTPServer),
+		)
+	}
+	if len(r.Config.SignedURLs.Keys) > 0 {
+		opts = append(opts, handlers.WithURLSigning(r.HTTPServer))
+	}
+
+	r.MetricsServer = handlers.NewMetricsServer(r.Logger, opts...)
+	if r.Config.Metrics.On(config.MetricsListenerSocket) {
+		r.HTTPServer.MountAdmin(r.MetricsServer.Handler())
+	}
 	return nil
 }
 
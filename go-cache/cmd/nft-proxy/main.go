@@ -9,9 +9,15 @@ import (
 	"time"
 
 	"go.uber.org/zap"
+
+	"nft-proxy/internal/config"
 )
 
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "snapshot" {
+		os.Exit(runSnapshot(os.Args[2:]))
+	}
+
 	root, err := NewCompositionRoot()
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "Failed to initialize application: %v\n", err)
@@ -32,13 +38,23 @@ func main() {
 		}
 	}()
 
-	metricsPort := root.GetMetricsPort()
-	root.Logger.Info("Starting metrics server", zap.String("port", metricsPort))
-	go func() {
-		if err := root.MetricsServer.Start(metricsPort); err != nil {
-			root.Logger.Error("Metrics server failed to start", zap.Error(err))
-		}
-	}()
+	if addr := root.Config.JWTAuth.ListenAddr; addr != "" {
+		go func() {
+			if err := root.HTTPServer.StartTCP(addr); err != nil {
+				root.Logger.Error("Server failed to start on TCP", zap.String("addr", addr), zap.Error(err))
+			}
+		}()
+	}
+
+	if root.Config.Metrics.On(config.MetricsListenerPort) {
+		metricsPort := root.GetMetricsPort()
+		root.Logger.Info("Starting metrics server", zap.String("port", metricsPort))
+		go func() {
+			if err := root.MetricsServer.Start(metricsPort); err != nil {
+				root.Logger.Error("Metrics server failed to start", zap.Error(err))
+			}
+		}()
+	}
 
 	quit := make(chan os.Signal, 1)
 	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
@@ -0,0 +1,158 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+
+	"nft-proxy/internal/snapshot"
+)
+
+const snapshotUsage = `Usage: nft-proxy snapshot export|import [flags]
+
+Downloads a snapshot of a running instance's cache, or loads one into it,
+through its admin API.
+
+Flags:
+`
+
+// snapshotPath is the admin endpoint serving snapshots
+const snapshotPath = "/admin/cache/snapshot"
+
+// runSnapshot implements the snapshot subcommand and returns the exit code
+func runSnapshot(args []string) int {
+	fs := flag.NewFlagSet("snapshot", flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprint(fs.Output(), snapshotUsage)
+		fs.PrintDefaults()
+	}
+
+	metricsPort := os.Getenv("METRICS_PORT")
+	if metricsPort == "" {
+		metricsPort = "9090"
+	}
+	addr := fs.String("addr", "http://127.0.0.1:"+metricsPort, "base URL of the metrics listener")
+	socket := fs.String("socket", "", "Unix socket of the proxy, used instead of -addr")
+	token := fs.String("token", os.Getenv("METRICS_BEARER_TOKEN"), "bearer token of the admin API")
+	file := fs.String("file", "-", "snapshot file to write or read, - for stdout or stdin")
+
+	if len(args) == 0 {
+		fs.Usage()
+		return 2
+	}
+	command := args[0]
+	if err := fs.Parse(args[1:]); err != nil {
+		return 2
+	}
+
+	client := http.DefaultClient
+	baseURL := strings.TrimSuffix(*addr, "/")
+	if *socket != "" {
+		client = &http.Client{Transport: &http.Transport{
+			DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+				return (&net.Dialer{}).DialContext(ctx, "unix", *socket)
+			},
+		}}
+		baseURL = "http://nft-proxy"
+	}
+
+	var err error
+	switch command {
+	case "export":
+		err = exportSnapshot(client, baseURL+snapshotPath, *token, *file)
+	case "import":
+		err = importSnapshot(client, baseURL+snapshotPath, *token, *file)
+	default:
+		fs.Usage()
+		return 2
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Snapshot %s failed: %v\n", command, err)
+		return 1
+	}
+	return 0
+}
+
+// exportSnapshot downloads a snapshot into file
+func exportSnapshot(client *http.Client, url, token, file string) error {
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := doAdmin(client, req, token)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	out := io.Writer(os.Stdout)
+	if file != "-" {
+		f, err := os.Create(file)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		out = f
+	}
+
+	n, err := io.Copy(out, resp.Body)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stderr, "Wrote %d byte snapshot\n", n)
+	return nil
+}
+
+// importSnapshot uploads the snapshot in file
+func importSnapshot(client *http.Client, url, token, file string) error {
+	in := io.Reader(os.Stdin)
+	if file != "-" {
+		f, err := os.Open(file)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		in = f
+	}
+
+	req, err := http.NewRequest(http.MethodPost, url, in)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", snapshot.ContentType)
+	resp, err := doAdmin(client, req, token)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	result, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintln(os.Stderr, strings.TrimSpace(string(result)))
+	return nil
+}
+
+// doAdmin sends an admin API request and fails on non-2xx responses
+func doAdmin(client *http.Client, req *http.Request, token string) (*http.Response, error) {
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode/100 != 2 {
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		return nil, errors.New(resp.Status + ": " + strings.TrimSpace(string(body)))
+	}
+	return resp, nil
+}
@@ -0,0 +1,192 @@
+package alchemy
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"nft-proxy/internal/metrics"
+)
+
+// Errors returned without calling Alchemy
+var (
+	// ErrCircuitOpen is returned while a chain's circuit breaker is open
+	ErrCircuitOpen = errors.New("alchemy circuit breaker open")
+	// ErrKeyQuarantined is returned while the API key is quarantined after
+	// Alchemy rejected it
+	ErrKeyQuarantined = errors.New("alchemy API key quarantined")
+)
+
+// BreakerOptions configures Breakers
+type BreakerOptions struct {
+	// Failures is how many consecutive failed calls to a chain open its
+	// breaker. Connection errors and 5xx responses count as failures.
+	Failures int
+	// Cooldown is how long an open breaker rejects calls, and a rejected API
+	// key stays quarantined, before calls are let through again
+	Cooldown time.Duration
+}
+
+// Breakers fail calls fast while Alchemy is unhealthy. Each chain has a
+// circuit breaker that opens after consecutive failures, and an API key
+// that Alchemy answers with 401 or 403 is quarantined. Both let calls
+// through again after the cooldown; the next failure re-opens the breaker,
+// or quarantines the key again, at once, and a success resets them.
+type Breakers struct {
+	opts    BreakerOptions
+	metrics *metrics.BreakerMetrics
+	now     func() time.Time
+
+	mu          sync.Mutex
+	chains      map[string]*breaker
+	quarantined map[string]time.Time
+}
+
+type breaker struct {
+	failures  int
+	openUntil time.Time
+}
+
+// NewBreakers creates circuit breakers and an API key quarantine
+func NewBreakers(opts BreakerOptions) *Breakers {
+	if opts.Failures < 1 {
+		opts.Failures = 1
+	}
+	return &Breakers{
+		opts:        opts,
+		metrics:     metrics.NewBreakerMetrics(),
+		now:         time.Now,
+		chains:      make(map[string]*breaker),
+		quarantined: make(map[string]time.Time),
+	}
+}
+
+// Allow returns ErrKeyQuarantined or ErrCircuitOpen if a call to a canonical
+// chain with the API key keyID must not be made now
+func (b *Breakers) Allow(chain, keyID string) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	now := b.now()
+	if now.Before(b.quarantined[keyID]) {
+		return ErrKeyQuarantined
+	}
+	if cb, ok := b.chains[chain]; ok && now.Before(cb.openUntil) {
+		return ErrCircuitOpen
+	}
+	return nil
+}
+
+// Record accounts the outcome of a call. A status of 0 means no response
+// was received.
+func (b *Breakers) Record(chain, keyID string, status int) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	now := b.now()
+	switch {
+	case status == http.StatusUnauthorized || status == http.StatusForbidden:
+		b.quarantined[keyID] = now.Add(b.opts.Cooldown)
+		b.metrics.SetQuarantined(keyID, true)
+	case status != 0:
+		if _, ok := b.quarantined[keyID]; ok {
+			delete(b.quarantined, keyID)
+			b.metrics.SetQuarantined(keyID, false)
+		}
+	}
+
+	cb, ok := b.chains[chain]
+	if !ok {
+		cb = &breaker{}
+		b.chains[chain] = cb
+	}
+	if status != 0 && status < http.StatusInternalServerError {
+		cb.failures = 0
+		cb.openUntil = time.Time{}
+		b.metrics.SetOpen(chain, false)
+		return
+	}
+	cb.failures++
+	if cb.failures >= b.opts.Failures {
+		cb.openUntil = now.Add(b.opts.Cooldown)
+		b.metrics.SetOpen(chain, true)
+	}
+}
+
+// Open returns those of the canonical chains whose breaker is open
+func (b *Breakers) Open(chains []string) []string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	now := b.now()
+	var open []string
+	for _, chain := range chains {
+		if cb, ok := b.chains[chain]; ok && now.Before(cb.openUntil) {
+			open = append(open, chain)
+		}
+	}
+	return open
+}
+
+// Quarantined reports whether the API key keyID is quarantined
+func (b *Breakers) Quarantined(keyID string) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.now().Before(b.quarantined[keyID])
+}
+
+// allow checks the breaker of a chain and the API key's quarantine
+func (c *Client) allow(chain, network string) error {
+	if c.breakers == nil {
+		return nil
+	}
+	canonical, err := c.CanonicalChain(chain, network)
+	if err != nil {
+		return err
+	}
+	return c.breakers.Allow(canonical, KeyID(c.apiKey))
+}
+
+// recordOutcome feeds the outcome of a call, after retries, to the breakers
+func (c *Client) recordOutcome(chain, network string, status int) {
+	if c.breakers == nil {
+		return
+	}
+	canonical, err := c.CanonicalChain(chain, network)
+	if err != nil {
+		return
+	}
+	c.breakers.Record(canonical, KeyID(c.apiKey), status)
+}
+
+// CheckKeys is a readiness check that fails while every API key is
+// quarantined
+func (c *Client) CheckKeys(context.Context) (any, error) {
+	quarantined := 0
+	if c.breakers != nil && c.breakers.Quarantined(KeyID(c.apiKey)) {
+		quarantined = 1
+	}
+	details := map[string]int{"usable": 1 - quarantined, "quarantined": quarantined}
+	if quarantined == 1 {
+		return details, fmt.Errorf("every API key is quarantined")
+	}
+	return details, nil
+}
+
+// CheckBreakers is a readiness check that fails while the circuit breaker
+// of every chain is open
+func (c *Client) CheckBreakers(context.Context) (any, error) {
+	chains := c.Chains()
+	var open []string
+	if c.breakers != nil {
+		open = c.breakers.Open(chains)
+	}
+	details := map[string]any{"chains": len(chains), "open": open}
+	if len(chains) > 0 && len(open) == len(chains) {
+		return details, fmt.Errorf("circuit breakers of every chain are open")
+	}
+	return details, nil
+}
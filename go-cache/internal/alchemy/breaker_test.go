@@ -0,0 +1,89 @@
+package alchemy
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestBreakers_OpenAfterConsecutiveFailures(t *testing.T) {
+	now := time.Unix(1_800_000_000, 0)
+	b := NewBreakers(BreakerOptions{Failures: 2, Cooldown: time.Minute})
+	b.now = func() time.Time { return now }
+
+	b.Record("eth-mainnet", "key", http.StatusBadGateway)
+	b.Record("eth-mainnet", "key", http.StatusOK)
+	b.Record("eth-mainnet", "key", 0)
+	if err := b.Allow("eth-mainnet", "key"); err != nil {
+		t.Fatalf("Expected a success to reset the failure count, got %v", err)
+	}
+
+	b.Record("eth-mainnet", "key", http.StatusServiceUnavailable)
+	if err := b.Allow("eth-mainnet", "key"); !errors.Is(err, ErrCircuitOpen) {
+		t.Errorf("Expected ErrCircuitOpen, got %v", err)
+	}
+	if err := b.Allow("base-mainnet", "key"); err != nil {
+		t.Errorf("Expected other chains to stay closed, got %v", err)
+	}
+
+	now = now.Add(time.Minute)
+	if err := b.Allow("eth-mainnet", "key"); err != nil {
+		t.Errorf("Expected calls to be let through after the cooldown, got %v", err)
+	}
+}
+
+func TestBreakers_QuarantineRejectedKeys(t *testing.T) {
+	now := time.Unix(1_800_000_000, 0)
+	b := NewBreakers(BreakerOptions{Failures: 5, Cooldown: time.Minute})
+	b.now = func() time.Time { return now }
+
+	b.Record("eth-mainnet", "key", http.StatusUnauthorized)
+	if err := b.Allow("base-mainnet", "key"); !errors.Is(err, ErrKeyQuarantined) {
+		t.Errorf("Expected ErrKeyQuarantined on every chain, got %v", err)
+	}
+
+	now = now.Add(time.Minute)
+	b.Record("eth-mainnet", "key", http.StatusOK)
+	if b.Quarantined("key") {
+		t.Error("Expected a success to lift the quarantine")
+	}
+}
+
+func TestClient_ReadinessReflectsBreakersAndQuarantine(t *testing.T) {
+	status := http.StatusServiceUnavailable
+	mockAlchemy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(status)
+	}))
+	defer mockAlchemy.Close()
+
+	opts := testRetryOptions()
+	opts.MaxRetries = 0
+	breakers := NewBreakers(BreakerOptions{Failures: 1, Cooldown: time.Minute})
+	client := NewClient("test-api-key", map[string]string{"eth-mainnet": mockAlchemy.URL, "base-mainnet": mockAlchemy.URL + "/base"}, opts, WithBreakers(breakers))
+	ctx := context.Background()
+
+	client.ProxyGET(ctx, "eth", "mainnet", "/getNFTsForOwner", "")
+	if _, err := client.CheckBreakers(ctx); err != nil {
+		t.Errorf("Expected readiness while one chain is still closed, got %v", err)
+	}
+	client.ProxyGET(ctx, "base", "mainnet", "/getNFTsForOwner", "")
+	if _, err := client.CheckBreakers(ctx); err == nil {
+		t.Error("Expected readiness to fail once every breaker is open")
+	}
+	if _, _, err := client.ProxyGET(ctx, "eth", "mainnet", "/getNFTsForOwner", ""); !errors.Is(err, ErrCircuitOpen) {
+		t.Errorf("Expected calls to fail fast, got %v", err)
+	}
+
+	if _, err := client.CheckKeys(ctx); err != nil {
+		t.Errorf("Expected a usable key, got %v", err)
+	}
+	breakers.now = func() time.Time { return time.Now().Add(time.Minute) }
+	status = http.StatusUnauthorized
+	client.ProxyGET(ctx, "eth", "mainnet", "/getNFTsForOwner", "")
+	if _, err := client.CheckKeys(ctx); err == nil {
+		t.Error("Expected readiness to fail once every key is quarantined")
+	}
+}
@@ -1,33 +1,93 @@
 package alchemy
 
 import (
-	"bytes"
 	"context"
 	"fmt"
 	"io"
 	"net/http"
+	"sort"
 	"strings"
+	"time"
 
 	"nft-proxy/internal/metrics"
+	"nft-proxy/internal/redact"
 
 	"github.com/status-im/proxy-common/httpclient"
+	"go.opentelemetry.io/otel/trace"
 )
 
 // Client represents an Alchemy NFT API client
 type Client struct {
-	apiKey     string
-	baseURLs   map[string]string
-	httpClient *httpclient.HTTPClientWithRetries
+	apiKey    string
+	baseURLs  map[string]string
+	canonical map[string]string
+	throttle  *Throttle
+	usage     UsageTracker
+	breakers  *Breakers
+	// redactor strips the API key, which is part of every upstream URL, from
+	// returned errors and span attributes
+	redactor *redact.Redactor
+
+	// streamClient and retryOpts drive every upstream call, with retries
+	// made by send so each attempt is throttled and accounted
+	streamClient  *http.Client
+	retryOpts     httpclient.RetryOptions
+	statusHandler httpclient.IHttpStatusHandler
+	metrics       *metrics.UpstreamMetrics
+}
+
+// UsageTracker accounts the compute units spent by the client and enforces
+// spending budgets
+type UsageTracker interface {
+	// Allow returns an error if no more upstream calls may be made
+	Allow() error
+	// Record accounts one upstream call
+	Record(chain, endpoint, keyID string)
+}
+
+// Option configures optional Client behaviour
+type Option func(*Client)
+
+// WithThrottle paces outgoing requests through a compute-unit throttle
+func WithThrottle(t *Throttle) Option {
+	return func(c *Client) {
+		c.throttle = t
+	}
+}
+
+// WithUsageTracker accounts compute units of every upstream call and rejects
+// calls once the tracker's budget is exhausted
+func WithUsageTracker(u UsageTracker) Option {
+	return func(c *Client) {
+		c.usage = u
+	}
+}
+
+// WithBreakers fails calls fast while a chain's circuit breaker is open or
+// the API key is quarantined
+func WithBreakers(b *Breakers) Option {
+	return func(c *Client) {
+		c.breakers = b
+	}
 }
 
 // NewClient creates a new Alchemy API client
-func NewClient(apiKey string, baseURLs map[string]string, retryOpts httpclient.RetryOptions) *Client {
+func NewClient(apiKey string, baseURLs map[string]string, retryOpts httpclient.RetryOptions, opts ...Option) *Client {
 	statusHandler := metrics.NewAlchemyHTTPMetrics()
-	return &Client{
-		apiKey:     apiKey,
-		baseURLs:   baseURLs,
-		httpClient: httpclient.NewHTTPClientWithRetries(retryOpts, statusHandler, nil),
+	c := &Client{
+		apiKey:        apiKey,
+		baseURLs:      baseURLs,
+		canonical:     canonicalChains(baseURLs),
+		redactor:      redact.New(apiKey),
+		streamClient:  newStreamClient(retryOpts),
+		retryOpts:     retryOpts,
+		statusHandler: statusHandler,
+		metrics:       metrics.NewUpstreamMetrics(),
 	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
 }
 
 // getBaseURL returns the base URL for a given chain and network
@@ -40,63 +100,123 @@ func (c *Client) getBaseURL(chain, network string) (string, error) {
 	return baseURL, nil
 }
 
-// ProxyGET forwards a GET request to Alchemy and returns the raw response
-func (c *Client) ProxyGET(ctx context.Context, chain, network, path, rawQuery string) ([]byte, int, error) {
-	baseURL, err := c.getBaseURL(chain, network)
-	if err != nil {
-		return nil, 0, err
+// CanonicalChain returns the canonical name of a chain and network, so that
+// aliases such as "ethereum-mainnet" and "eth-mainnet" share one name
+func (c *Client) CanonicalChain(chain, network string) (string, error) {
+	chainKey := strings.ToLower(chain) + "-" + strings.ToLower(network)
+	canonical, ok := c.canonical[chainKey]
+	if !ok {
+		return "", fmt.Errorf("unsupported chain: %s-%s", chain, network)
 	}
+	return canonical, nil
+}
 
-	// Build full URL with API key in path (format: /nft/v3/{apiKey}/{path})
-	endpoint := fmt.Sprintf("%s/nft/v3/%s%s", baseURL, c.apiKey, path)
-	if rawQuery != "" {
-		endpoint = fmt.Sprintf("%s?%s", endpoint, rawQuery)
+// Chains returns the canonical names of every supported chain, sorted
+func (c *Client) Chains() []string {
+	seen := make(map[string]bool, len(c.canonical))
+	chains := make([]string, 0, len(c.canonical))
+	for _, canonical := range c.canonical {
+		if !seen[canonical] {
+			seen[canonical] = true
+			chains = append(chains, canonical)
+		}
 	}
+	sort.Strings(chains)
+	return chains
+}
 
-	req, err := http.NewRequestWithContext(ctx, "GET", endpoint, nil)
-	if err != nil {
-		return nil, 0, fmt.Errorf("failed to create request: %w", err)
+// canonicalChains maps every chain key to the shortest key sharing its base
+// URL, e.g. "ethereum-mainnet" to "eth-mainnet"
+func canonicalChains(baseURLs map[string]string) map[string]string {
+	byURL := make(map[string]string, len(baseURLs))
+	for chainKey, baseURL := range baseURLs {
+		current, ok := byURL[baseURL]
+		if !ok || len(chainKey) < len(current) || (len(chainKey) == len(current) && chainKey < current) {
+			byURL[baseURL] = chainKey
+		}
+	}
+
+	canonical := make(map[string]string, len(baseURLs))
+	for chainKey, baseURL := range baseURLs {
+		canonical[chainKey] = byURL[baseURL]
 	}
+	return canonical
+}
 
-	req.Header.Set("Accept", "application/json")
+// wait checks the spending budget and blocks until the API key has
+// compute-unit budget for the endpoint
+func (c *Client) wait(ctx context.Context, path string) error {
+	if c.usage != nil {
+		if err := c.usage.Allow(); err != nil {
+			return err
+		}
+	}
+	if c.throttle == nil {
+		return nil
+	}
+	return c.throttle.Wait(ctx, c.apiKey, EndpointName(path))
+}
 
-	resp, respBody, _, err := c.httpClient.ExecuteRequest(req)
+// record accounts a completed upstream call
+func (c *Client) record(chain, network, path string) {
+	if c.usage == nil {
+		return
+	}
+	canonical, err := c.CanonicalChain(chain, network)
 	if err != nil {
-		return nil, 0, fmt.Errorf("request failed: %w", err)
+		return
 	}
-	defer resp.Body.Close()
-
-	return respBody, resp.StatusCode, nil
+	c.usage.Record(canonical, EndpointLabel(EndpointName(path)), KeyID(c.apiKey))
 }
 
-// ProxyPOST forwards a POST request to Alchemy and returns the raw response
-func (c *Client) ProxyPOST(ctx context.Context, chain, network, path string, body []byte) ([]byte, int, error) {
-	baseURL, err := c.getBaseURL(chain, network)
+// observe records the outcome of one upstream call under the canonical chain
+// and a bounded endpoint label. A status of 0 means no response was received.
+func (c *Client) observe(chain, network, path string, status int, d time.Duration) {
+	canonical, err := c.CanonicalChain(chain, network)
 	if err != nil {
-		return nil, 0, err
+		return
 	}
+	c.metrics.OnResponse(canonical, EndpointLabel(EndpointName(path)), status, d)
+}
 
-	// Build full URL with API key in path (format: /nft/v3/{apiKey}/{path})
-	endpoint := fmt.Sprintf("%s/nft/v3/%s%s", baseURL, c.apiKey, path)
+// ProxyGET forwards a GET request to Alchemy and returns the raw response
+func (c *Client) ProxyGET(ctx context.Context, chain, network, path, rawQuery string) (_ []byte, _ int, err error) {
+	return c.proxy(ctx, http.MethodGet, chain, network, path, rawQuery, nil)
+}
 
-	var reqBody io.Reader
-	if len(body) > 0 {
-		reqBody = bytes.NewBuffer(body)
-	}
+// ProxyPOST forwards a POST request to Alchemy and returns the raw response
+func (c *Client) ProxyPOST(ctx context.Context, chain, network, path string, body []byte) (_ []byte, _ int, err error) {
+	return c.proxy(ctx, http.MethodPost, chain, network, path, "", body)
+}
 
-	req, err := http.NewRequestWithContext(ctx, "POST", endpoint, reqBody)
+// proxy makes an upstream call with the retries of Stream and reads the
+// decoded response body
+func (c *Client) proxy(ctx context.Context, method, chain, network, path, rawQuery string, body []byte) (_ []byte, _ int, err error) {
+	baseURL, err := c.getBaseURL(chain, network)
 	if err != nil {
-		return nil, 0, fmt.Errorf("failed to create request: %w", err)
+		return nil, 0, err
 	}
 
-	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("Accept", "application/json")
-
-	resp, respBody, _, err := c.httpClient.ExecuteRequest(req)
+	ctx, span := tracer.Start(ctx, "alchemy.request",
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(c.requestAttributes(method, chain, network, baseURL, path)...))
+	defer func() {
+		if err != nil {
+			err = c.redactor.Error(err)
+			c.recordError(span, err)
+		}
+		span.End()
+	}()
+
+	resp, err := c.send(ctx, span, method, chain, network, baseURL, path, rawQuery, body, "")
 	if err != nil {
-		return nil, 0, fmt.Errorf("request failed: %w", err)
+		return nil, 0, err
 	}
 	defer resp.Body.Close()
 
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to read response: %w", err)
+	}
 	return respBody, resp.StatusCode, nil
 }
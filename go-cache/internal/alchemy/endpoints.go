@@ -0,0 +1,43 @@
+package alchemy
+
+import "strings"
+
+// knownEndpoints are the NFT API v3 methods the proxy expects to serve.
+// Anything else is reported as "other" so metric cardinality stays bounded.
+var knownEndpoints = map[string]bool{
+	"getNFTsForOwner":          true,
+	"getNFTsForContract":       true,
+	"getNFTsForCollection":     true,
+	"getOwnersForNFT":          true,
+	"getOwnersForContract":     true,
+	"getContractsForOwner":     true,
+	"getCollectionsForOwner":   true,
+	"getNFTMetadata":           true,
+	"getNFTMetadataBatch":      true,
+	"getContractMetadata":      true,
+	"getContractMetadataBatch": true,
+	"getCollectionMetadata":    true,
+	"getNFTSales":              true,
+	"getFloorPrice":            true,
+	"isSpamContract":           true,
+	"isAirdropNFT":             true,
+}
+
+// EndpointName returns the NFT API method for a proxied path, e.g.
+// "getNFTsForOwner" for "/getNFTsForOwner"
+func EndpointName(path string) string {
+	name := strings.TrimPrefix(path, "/")
+	if idx := strings.IndexByte(name, '/'); idx != -1 {
+		name = name[:idx]
+	}
+	return name
+}
+
+// EndpointLabel returns endpoint if it is a known NFT API method and "other"
+// otherwise
+func EndpointLabel(endpoint string) string {
+	if knownEndpoints[endpoint] {
+		return endpoint
+	}
+	return "other"
+}
@@ -0,0 +1,25 @@
+package alchemy
+
+import "context"
+
+// RequestStats collects details of the upstream calls made on behalf of one
+// client request, for access logging
+type RequestStats struct {
+	// Attempts counts upstream HTTP calls including retries
+	Attempts int
+}
+
+type requestStatsKey struct{}
+
+// WithRequestStats returns a context in which the client records upstream
+// calls into stats
+func WithRequestStats(ctx context.Context, stats *RequestStats) context.Context {
+	return context.WithValue(ctx, requestStatsKey{}, stats)
+}
+
+// countAttempt records one upstream call in the context's RequestStats
+func countAttempt(ctx context.Context) {
+	if stats, ok := ctx.Value(requestStatsKey{}).(*RequestStats); ok {
+		stats.Attempts++
+	}
+}
@@ -0,0 +1,268 @@
+package alchemy
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/status-im/proxy-common/httpclient"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// acceptEncoding is requested from Alchemy on streaming requests. Bodies are
+// passed on (and cached) compressed; the caller decodes them if needed.
+const acceptEncoding = "gzip, br"
+
+// maxDrainBytes bounds how much of a discarded response is read so the
+// connection can be reused
+const maxDrainBytes = 64 << 10
+
+// newStreamClient creates the HTTP client used for streaming requests. It
+// bounds connecting and waiting for response headers but not the body
+// transfer, which may legitimately take a while for large payloads.
+func newStreamClient(retryOpts httpclient.RetryOptions) *http.Client {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.DialContext = (&net.Dialer{
+		Timeout:   retryOpts.ConnectionTimeout,
+		KeepAlive: 30 * time.Second,
+	}).DialContext
+	transport.ResponseHeaderTimeout = retryOpts.RequestTimeout
+	transport.MaxIdleConnsPerHost = 32
+
+	return &http.Client{Transport: transport}
+}
+
+// Stream forwards a request to Alchemy and returns the upstream response
+// without reading its body, so the caller can copy it to the client as it
+// arrives. The body may be gzip or br encoded as indicated by the response's
+// Content-Encoding. Connection errors, 429 and 5xx responses are retried with
+// exponential backoff, or after the Retry-After of a 429, before anything is
+// returned. The caller must close the response body.
+func (c *Client) Stream(ctx context.Context, method, chain, network, path, rawQuery string, body []byte) (_ *http.Response, err error) {
+	baseURL, err := c.getBaseURL(chain, network)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, span := tracer.Start(ctx, "alchemy.request",
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(c.requestAttributes(method, chain, network, baseURL, path)...))
+	defer func() {
+		if err != nil {
+			err = c.redactor.Error(err)
+			c.recordError(span, err)
+		}
+		span.End()
+	}()
+
+	return c.send(ctx, span, method, chain, network, baseURL, path, rawQuery, body, acceptEncoding)
+}
+
+// send makes upstream calls until one succeeds, fails permanently or retries
+// run out. Every attempt waits for the spending budget and compute-unit
+// throttle and is recorded once answered, since Alchemy charges for retries
+// too. With an empty encoding the transport decodes gzip bodies itself.
+func (c *Client) send(ctx context.Context, span trace.Span, method, chain, network, baseURL, path, rawQuery string, body []byte, encoding string) (*http.Response, error) {
+	// Build full URL with API key in path (format: /nft/v3/{apiKey}/{path})
+	endpoint := fmt.Sprintf("%s/nft/v3/%s%s", baseURL, c.apiKey, path)
+	if rawQuery != "" {
+		endpoint = fmt.Sprintf("%s?%s", endpoint, rawQuery)
+	}
+
+	if err := c.allow(chain, network); err != nil {
+		return nil, err
+	}
+
+	for attempt := 0; ; attempt++ {
+		if err := c.wait(ctx, path); err != nil {
+			return nil, err
+		}
+
+		req, err := newStreamRequest(ctx, method, endpoint, body, encoding)
+		if err != nil {
+			return nil, err
+		}
+
+		resp, err := c.streamAttempt(req, chain, network, path, attempt)
+		if err == nil {
+			c.record(chain, network, path)
+		}
+		retryable := ctx.Err() == nil && (err != nil || isRetryableStatus(resp.StatusCode))
+		if !retryable || attempt >= c.retryOpts.MaxRetries {
+			span.SetAttributes(attribute.Int("alchemy.attempts", attempt+1))
+			if err != nil {
+				if ctx.Err() == nil {
+					c.recordOutcome(chain, network, 0)
+				}
+				c.statusHandler.OnRequest("error")
+				return nil, fmt.Errorf("request failed: %w", err)
+			}
+			span.SetAttributes(attribute.Int("http.response.status_code", resp.StatusCode))
+			c.statusHandler.OnRequest(requestStatus(resp.StatusCode))
+			c.recordOutcome(chain, network, resp.StatusCode)
+			return resp, nil
+		}
+
+		delay := c.backoff(attempt)
+		if resp != nil {
+			retryAfter := parseRetryAfter(resp.Header.Get("Retry-After"), time.Now())
+			_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, maxDrainBytes))
+			resp.Body.Close()
+			if limit := c.maxRetryWait(ctx); retryAfter > limit {
+				// Waiting would hold a concurrency slot for longer than the
+				// request may wait, so give up like the throttle does
+				span.SetAttributes(attribute.Int("alchemy.attempts", attempt+1))
+				c.recordOutcome(chain, network, resp.StatusCode)
+				c.statusHandler.OnRequest(requestStatus(resp.StatusCode))
+				return nil, fmt.Errorf("%w: upstream asked to retry after %s", ErrThrottled, retryAfter.Round(time.Millisecond))
+			}
+			if retryAfter > delay {
+				delay = retryAfter
+			}
+		}
+
+		c.statusHandler.OnRetry()
+		if err := sleepContext(ctx, delay); err != nil {
+			c.statusHandler.OnRequest("error")
+			return nil, fmt.Errorf("request failed: %w", err)
+		}
+	}
+}
+
+// streamAttempt makes one upstream call for Stream in its own span
+func (c *Client) streamAttempt(req *http.Request, chain, network, path string, attempt int) (*http.Response, error) {
+	ctx, span := tracer.Start(req.Context(), "alchemy.attempt",
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(attribute.Int("alchemy.attempt", attempt+1)))
+	defer span.End()
+
+	countAttempt(ctx)
+	start := time.Now()
+	resp, err := c.streamClient.Do(req.WithContext(ctx))
+	if err != nil {
+		c.observe(chain, network, path, 0, time.Since(start))
+		c.recordError(span, err)
+		return nil, err
+	}
+	c.observe(chain, network, path, resp.StatusCode, time.Since(start))
+
+	span.SetAttributes(attribute.Int("http.response.status_code", resp.StatusCode))
+	if isRetryableStatus(resp.StatusCode) {
+		span.SetStatus(codes.Error, http.StatusText(resp.StatusCode))
+	}
+	return resp, nil
+}
+
+// newStreamRequest creates an upstream request for send
+func newStreamRequest(ctx context.Context, method, endpoint string, body []byte, encoding string) (*http.Request, error) {
+	var reqBody io.Reader
+	if len(body) > 0 {
+		reqBody = bytes.NewReader(body)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, endpoint, reqBody)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+
+	if method == http.MethodPost {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	req.Header.Set("Accept", "application/json")
+	if encoding != "" {
+		// Setting Accept-Encoding also disables the transport's transparent gzip decoding
+		req.Header.Set("Accept-Encoding", encoding)
+	}
+	return req, nil
+}
+
+// maxBackoff caps the exponential backoff between retries
+const maxBackoff = 30 * time.Second
+
+// backoff returns the delay before retrying after the given attempt: a
+// random duration up to the capped exponential backoff, so that instances
+// throttled together do not retry in lockstep
+func (c *Client) backoff(attempt int) time.Duration {
+	ceiling := maxBackoff
+	if attempt < 32 && c.retryOpts.BaseBackoff < maxBackoff>>attempt {
+		ceiling = c.retryOpts.BaseBackoff << attempt
+	}
+	if ceiling <= 0 {
+		return 0
+	}
+	return rand.N(ceiling + 1)
+}
+
+// maxRetryWait returns how long a request may wait for a Retry-After: the
+// throttle's MaxWait, else the request timeout, and never past the context
+// deadline
+func (c *Client) maxRetryWait(ctx context.Context) time.Duration {
+	limit := c.retryOpts.RequestTimeout
+	if limit <= 0 {
+		limit = maxBackoff
+	}
+	if c.throttle != nil && c.throttle.opts.MaxWait > 0 {
+		limit = c.throttle.opts.MaxWait
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		if remaining := time.Until(deadline); remaining < limit {
+			limit = remaining
+		}
+	}
+	return limit
+}
+
+// parseRetryAfter returns the delay requested by a Retry-After header in
+// seconds or as an HTTP date, or 0 if there is none
+func parseRetryAfter(value string, now time.Time) time.Duration {
+	if value == "" {
+		return 0
+	}
+	if seconds, err := strconv.Atoi(value); err == nil {
+		if seconds < 0 {
+			return 0
+		}
+		return time.Duration(seconds) * time.Second
+	}
+	if at, err := http.ParseTime(value); err == nil && at.After(now) {
+		return at.Sub(now)
+	}
+	return 0
+}
+
+// isRetryableStatus reports whether an upstream status is worth retrying
+func isRetryableStatus(statusCode int) bool {
+	return statusCode == http.StatusTooManyRequests || statusCode >= http.StatusInternalServerError
+}
+
+// requestStatus maps an upstream status to the request metric status label
+func requestStatus(statusCode int) string {
+	switch {
+	case statusCode == http.StatusTooManyRequests:
+		return "rate_limited"
+	case statusCode >= http.StatusInternalServerError:
+		return "error"
+	default:
+		return "success"
+	}
+}
+
+func sleepContext(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
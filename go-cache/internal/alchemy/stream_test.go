@@ -0,0 +1,218 @@
+package alchemy
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/status-im/proxy-common/httpclient"
+	"go.opentelemetry.io/otel"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace/noop"
+)
+
+func testRetryOptions() httpclient.RetryOptions {
+	return httpclient.RetryOptions{
+		MaxRetries:        2,
+		BaseBackoff:       time.Millisecond,
+		ConnectionTimeout: time.Second,
+		RequestTimeout:    time.Second,
+	}
+}
+
+func TestStream_RetriesTransientErrors(t *testing.T) {
+	calls := 0
+	mockAlchemy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		if calls == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte(`{"ownedNfts":[]}`))
+	}))
+	defer mockAlchemy.Close()
+
+	client := NewClient("test-api-key", map[string]string{"eth-mainnet": mockAlchemy.URL}, testRetryOptions())
+
+	resp, err := client.Stream(context.Background(), http.MethodGet, "eth", "mainnet", "/getNFTsForOwner", "owner=0x1", nil)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("Expected status 200 after retry, got %d", resp.StatusCode)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	if string(body) != `{"ownedNfts":[]}` {
+		t.Errorf("Unexpected body %q", body)
+	}
+	if calls != 2 {
+		t.Errorf("Expected 2 upstream calls, got %d", calls)
+	}
+}
+
+func TestStream_DoesNotRetryClientErrors(t *testing.T) {
+	calls := 0
+	mockAlchemy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.WriteHeader(http.StatusBadRequest)
+	}))
+	defer mockAlchemy.Close()
+
+	client := NewClient("test-api-key", map[string]string{"eth-mainnet": mockAlchemy.URL}, testRetryOptions())
+
+	resp, err := client.Stream(context.Background(), http.MethodGet, "eth", "mainnet", "/getNFTsForOwner", "", nil)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusBadRequest || calls != 1 {
+		t.Errorf("Expected a single 400 response, got %d after %d calls", resp.StatusCode, calls)
+	}
+}
+
+func TestStream_ReturnsLastResponseWhenRetriesExhausted(t *testing.T) {
+	calls := 0
+	mockAlchemy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.WriteHeader(http.StatusTooManyRequests)
+	}))
+	defer mockAlchemy.Close()
+
+	client := NewClient("test-api-key", map[string]string{"eth-mainnet": mockAlchemy.URL}, testRetryOptions())
+
+	resp, err := client.Stream(context.Background(), http.MethodGet, "eth", "mainnet", "/getNFTsForOwner", "", nil)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusTooManyRequests || calls != 3 {
+		t.Errorf("Expected 429 after 3 calls, got %d after %d calls", resp.StatusCode, calls)
+	}
+}
+
+type countingTracker struct{ records int }
+
+func (c *countingTracker) Allow() error                         { return nil }
+func (c *countingTracker) Record(chain, endpoint, keyID string) { c.records++ }
+
+func TestStream_ThrottlesAndRecordsEveryAttempt(t *testing.T) {
+	calls := 0
+	mockAlchemy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer mockAlchemy.Close()
+
+	// The bucket holds two calls, so the third attempt is throttled
+	throttle := NewThrottle(ThrottleOptions{ComputeUnitsPerSecond: 1, Burst: 200, Cost: testCosts})
+	tracker := &countingTracker{}
+	client := NewClient("test-api-key", map[string]string{"eth-mainnet": mockAlchemy.URL}, testRetryOptions(),
+		WithThrottle(throttle), WithUsageTracker(tracker))
+
+	_, err := client.Stream(context.Background(), http.MethodGet, "eth", "mainnet", "/getNFTsForOwner", "", nil)
+	if !errors.Is(err, ErrThrottled) {
+		t.Fatalf("Expected the third attempt to be throttled, got %v", err)
+	}
+	if calls != 2 || tracker.records != 2 {
+		t.Errorf("Expected 2 upstream calls recorded, got %d calls and %d records", calls, tracker.records)
+	}
+}
+
+func TestStream_FailsFastOnLongRetryAfter(t *testing.T) {
+	calls := 0
+	mockAlchemy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.Header().Set("Retry-After", "86400")
+		w.WriteHeader(http.StatusTooManyRequests)
+	}))
+	defer mockAlchemy.Close()
+
+	throttle := NewThrottle(ThrottleOptions{ComputeUnitsPerSecond: 1000, MaxWait: time.Second, Cost: testCosts})
+	client := NewClient("test-api-key", map[string]string{"eth-mainnet": mockAlchemy.URL}, testRetryOptions(), WithThrottle(throttle))
+
+	start := time.Now()
+	_, err := client.Stream(context.Background(), http.MethodGet, "eth", "mainnet", "/getNFTsForOwner", "", nil)
+	if !errors.Is(err, ErrThrottled) {
+		t.Fatalf("Expected ErrThrottled, got %v", err)
+	}
+	if calls != 1 || time.Since(start) > time.Second {
+		t.Errorf("Expected to give up after 1 call without waiting, got %d calls in %s", calls, time.Since(start))
+	}
+}
+
+func TestBackoff_IsCappedAndJittered(t *testing.T) {
+	client := NewClient("test-api-key", nil, httpclient.RetryOptions{BaseBackoff: time.Second})
+	distinct := make(map[time.Duration]bool)
+	for i := 0; i < 20; i++ {
+		delay := client.backoff(40)
+		if delay < 0 || delay > maxBackoff {
+			t.Fatalf("Expected backoff within [0, %s], got %s", maxBackoff, delay)
+		}
+		distinct[delay] = true
+	}
+	if len(distinct) < 2 {
+		t.Error("Expected backoff to be jittered")
+	}
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	now := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	tests := map[string]time.Duration{
+		"":                              0,
+		"3":                             3 * time.Second,
+		"-1":                            0,
+		"soon":                          0,
+		"Thu, 01 Jan 2026 00:00:05 GMT": 5 * time.Second,
+		"Wed, 31 Dec 2025 23:59:00 GMT": 0,
+	}
+	for value, expected := range tests {
+		if got := parseRetryAfter(value, now); got != expected {
+			t.Errorf("parseRetryAfter(%q) = %s, want %s", value, got, expected)
+		}
+	}
+}
+
+func TestStream_RedactsAPIKeyFromSpanErrors(t *testing.T) {
+	exporter := tracetest.NewInMemoryExporter()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter)))
+	defer otel.SetTracerProvider(noop.NewTracerProvider())
+
+	// A closed server makes every attempt fail with an error quoting the URL
+	mockAlchemy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	mockAlchemy.Close()
+
+	const apiKey = "secret-api-key"
+	client := NewClient(apiKey, map[string]string{"eth-mainnet": mockAlchemy.URL}, testRetryOptions())
+
+	if _, err := client.Stream(context.Background(), http.MethodGet, "eth", "mainnet", "/getNFTsForOwner", "", nil); err == nil {
+		t.Fatal("Expected connection error")
+	}
+
+	spans := exporter.GetSpans()
+	if len(spans) != 4 {
+		t.Fatalf("Expected 3 attempt spans and 1 request span, got %d", len(spans))
+	}
+	for _, span := range spans {
+		if strings.Contains(span.Status.Description, apiKey) {
+			t.Errorf("Span %s: status leaks the API key: %s", span.Name, span.Status.Description)
+		}
+		for _, event := range span.Events {
+			for _, attr := range event.Attributes {
+				if strings.Contains(attr.Value.Emit(), apiKey) {
+					t.Errorf("Span %s: event attribute %s leaks the API key", span.Name, attr.Key)
+				}
+			}
+		}
+	}
+}
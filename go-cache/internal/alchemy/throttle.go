@@ -0,0 +1,119 @@
+package alchemy
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"golang.org/x/time/rate"
+
+	"nft-proxy/internal/metrics"
+)
+
+// ErrThrottled is returned when a request would have to wait longer than the
+// configured maximum for its API key's compute-units-per-second rate. It is
+// local pacing, unlike the spending budget's budget.ErrExhausted.
+var ErrThrottled = errors.New("compute unit rate throttled")
+
+// ThrottleOptions configures a Throttle
+type ThrottleOptions struct {
+	// ComputeUnitsPerSecond is the CUPS limit of a single API key
+	ComputeUnitsPerSecond int
+	Burst                 int
+	MaxWait               time.Duration
+	// Cost returns the compute-unit weight of an endpoint
+	Cost func(endpoint string) int
+}
+
+// Throttle paces outgoing requests with one token bucket per API key, where
+// each request takes as many tokens as its endpoint costs in compute units.
+type Throttle struct {
+	opts    ThrottleOptions
+	metrics *metrics.ThrottleMetrics
+
+	mu      sync.Mutex
+	buckets map[string]*rate.Limiter
+}
+
+// NewThrottle creates a new compute-unit throttle
+func NewThrottle(opts ThrottleOptions) *Throttle {
+	if opts.Burst < opts.ComputeUnitsPerSecond {
+		opts.Burst = opts.ComputeUnitsPerSecond
+	}
+	if opts.Cost == nil {
+		opts.Cost = func(string) int { return 1 }
+	}
+
+	return &Throttle{
+		opts:    opts,
+		metrics: metrics.NewThrottleMetrics(),
+		buckets: make(map[string]*rate.Limiter),
+	}
+}
+
+// Wait blocks until the API key has budget for a call to endpoint. It returns
+// ErrThrottled without waiting if the budget would not be available within
+// MaxWait.
+func (t *Throttle) Wait(ctx context.Context, apiKey, endpoint string) error {
+	bucket := t.bucket(apiKey)
+	keyID := KeyID(apiKey)
+
+	cost := t.opts.Cost(endpoint)
+	if cost > t.opts.Burst {
+		// A single call can never cost more than a full bucket
+		cost = t.opts.Burst
+	}
+
+	reservation := bucket.ReserveN(time.Now(), cost)
+	if !reservation.OK() {
+		t.metrics.OnThrottled(keyID)
+		return ErrThrottled
+	}
+
+	delay := reservation.Delay()
+	if delay > t.opts.MaxWait {
+		reservation.Cancel()
+		t.metrics.OnThrottled(keyID)
+		return fmt.Errorf("%w: would wait %s", ErrThrottled, delay.Round(time.Millisecond))
+	}
+	t.metrics.SetAvailable(keyID, bucket.Tokens())
+
+	if delay == 0 {
+		return nil
+	}
+
+	t.metrics.OnWait(delay)
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		reservation.Cancel()
+		return ctx.Err()
+	}
+}
+
+func (t *Throttle) bucket(apiKey string) *rate.Limiter {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	bucket, ok := t.buckets[apiKey]
+	if !ok {
+		bucket = rate.NewLimiter(rate.Limit(t.opts.ComputeUnitsPerSecond), t.opts.Burst)
+		t.buckets[apiKey] = bucket
+	}
+	return bucket
+}
+
+// KeyID returns a short, stable fingerprint of an API key that is safe to use
+// in metric labels and logs
+func KeyID(apiKey string) string {
+	sum := sha256.Sum256([]byte(apiKey))
+	return hex.EncodeToString(sum[:4])
+}
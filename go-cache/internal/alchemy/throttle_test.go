@@ -0,0 +1,120 @@
+package alchemy
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/status-im/proxy-common/httpclient"
+)
+
+func testCosts(endpoint string) int {
+	costs := map[string]int{
+		"getNFTsForOwner":     100,
+		"getNFTMetadataBatch": 300,
+	}
+	if cost, ok := costs[endpoint]; ok {
+		return cost
+	}
+	return 10
+}
+
+func TestThrottle_RejectsBeyondMaxWait(t *testing.T) {
+	throttle := NewThrottle(ThrottleOptions{
+		ComputeUnitsPerSecond: 100,
+		Burst:                 300,
+		MaxWait:               50 * time.Millisecond,
+		Cost:                  testCosts,
+	})
+
+	if err := throttle.Wait(context.Background(), "key-a", "getNFTMetadataBatch"); err != nil {
+		t.Fatalf("Expected first call to fit in burst, got %v", err)
+	}
+
+	err := throttle.Wait(context.Background(), "key-a", "getNFTsForOwner")
+	if !errors.Is(err, ErrThrottled) {
+		t.Errorf("Expected ErrThrottled once the bucket is drained, got %v", err)
+	}
+}
+
+func TestThrottle_WaitsBriefly(t *testing.T) {
+	throttle := NewThrottle(ThrottleOptions{
+		ComputeUnitsPerSecond: 1000,
+		Burst:                 1000,
+		MaxWait:               time.Second,
+		Cost:                  func(string) int { return 1000 },
+	})
+
+	if err := throttle.Wait(context.Background(), "key-a", "getNFTsForOwner"); err != nil {
+		t.Fatalf("Expected first call to fit in burst, got %v", err)
+	}
+
+	start := time.Now()
+	if err := throttle.Wait(context.Background(), "key-a", "getNFTsForOwner"); err != nil {
+		t.Fatalf("Expected second call to wait for budget, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed < 500*time.Millisecond {
+		t.Errorf("Expected call to be paced by about 1s, waited %s", elapsed)
+	}
+}
+
+func TestThrottle_KeysAreIndependent(t *testing.T) {
+	throttle := NewThrottle(ThrottleOptions{
+		ComputeUnitsPerSecond: 100,
+		Burst:                 100,
+		MaxWait:               0,
+		Cost:                  testCosts,
+	})
+
+	if err := throttle.Wait(context.Background(), "key-a", "getNFTsForOwner"); err != nil {
+		t.Fatalf("Unexpected error for key-a: %v", err)
+	}
+	if err := throttle.Wait(context.Background(), "key-b", "getNFTsForOwner"); err != nil {
+		t.Errorf("Expected key-b to have its own budget, got %v", err)
+	}
+}
+
+func TestClient_ThrottledRequestDoesNotReachUpstream(t *testing.T) {
+	calls := 0
+	mockAlchemy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer mockAlchemy.Close()
+
+	throttle := NewThrottle(ThrottleOptions{
+		ComputeUnitsPerSecond: 100,
+		Burst:                 100,
+		MaxWait:               0,
+		Cost:                  testCosts,
+	})
+	client := NewClient("test-api-key", map[string]string{"eth-mainnet": mockAlchemy.URL}, httpclient.DefaultRetryOptions(), WithThrottle(throttle))
+
+	if _, _, err := client.ProxyGET(context.Background(), "eth", "mainnet", "/getNFTsForOwner", "owner=0x1"); err != nil {
+		t.Fatalf("Unexpected error on first request: %v", err)
+	}
+	if _, _, err := client.ProxyGET(context.Background(), "eth", "mainnet", "/getNFTsForOwner", "owner=0x1"); !errors.Is(err, ErrThrottled) {
+		t.Errorf("Expected ErrThrottled, got %v", err)
+	}
+	if calls != 1 {
+		t.Errorf("Expected exactly 1 upstream call, got %d", calls)
+	}
+}
+
+func TestEndpointName(t *testing.T) {
+	tests := map[string]string{
+		"/getNFTsForOwner":      "getNFTsForOwner",
+		"/some/nested/endpoint": "some",
+		"getContractMetadata":   "getContractMetadata",
+		"/":                     "",
+	}
+
+	for path, expected := range tests {
+		if got := EndpointName(path); got != expected {
+			t.Errorf("EndpointName(%q) = %q, want %q", path, got, expected)
+		}
+	}
+}
@@ -0,0 +1,36 @@
+package alchemy
+
+import (
+	"errors"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+
+	"nft-proxy/internal/redact"
+)
+
+var tracer = otel.Tracer("nft-proxy/internal/alchemy")
+
+// requestAttributes returns the span attributes of an upstream call. The URL
+// is built without the API key rather than redacted after the fact.
+func (c *Client) requestAttributes(method, chain, network, baseURL, path string) []attribute.KeyValue {
+	attrs := []attribute.KeyValue{
+		attribute.String("http.request.method", method),
+		attribute.String("url.full", baseURL+"/nft/v3/"+redact.Placeholder+path),
+		attribute.String("nft.endpoint", EndpointLabel(EndpointName(path))),
+	}
+	if canonical, err := c.CanonicalChain(chain, network); err == nil {
+		attrs = append(attrs, attribute.String("nft.chain", canonical))
+	}
+	return attrs
+}
+
+// recordError marks span as failed with an error message that cannot leak
+// the API key
+func (c *Client) recordError(span trace.Span, err error) {
+	msg := c.redactor.String(err.Error())
+	span.RecordError(errors.New(msg))
+	span.SetStatus(codes.Error, msg)
+}
@@ -0,0 +1,314 @@
+package budget
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+
+	"nft-proxy/internal/metrics"
+)
+
+// ErrExhausted is matched by errors returned when a hard budget is reached
+var ErrExhausted = errors.New("compute unit budget exhausted")
+
+const (
+	PeriodDaily   = "daily"
+	PeriodMonthly = "monthly"
+)
+
+// ExhaustedError reports which hard budget was reached and when it resets
+type ExhaustedError struct {
+	Period  string
+	ResetAt time.Time
+}
+
+func (e *ExhaustedError) Error() string {
+	return fmt.Sprintf("%s compute unit budget exhausted until %s", e.Period, e.ResetAt.Format(time.RFC3339))
+}
+
+// Is makes errors.Is(err, ErrExhausted) match
+func (e *ExhaustedError) Is(target error) bool {
+	return target == ErrExhausted
+}
+
+// Limits are the soft and hard compute-unit budgets of one period. Zero
+// disables a limit.
+type Limits struct {
+	Soft int64
+	Hard int64
+}
+
+// Options configures a Tracker
+type Options struct {
+	// Cost returns the compute-unit cost of an endpoint
+	Cost    func(endpoint string) int
+	Daily   Limits
+	Monthly Limits
+	// StateFile persists usage across restarts; empty disables persistence
+	StateFile string
+}
+
+// state is the persisted usage of the current periods
+type state struct {
+	Day         string `json:"day"`
+	DailyUsed   int64  `json:"daily_used"`
+	Month       string `json:"month"`
+	MonthlyUsed int64  `json:"monthly_used"`
+}
+
+// Tracker accounts estimated compute-unit spend and enforces daily and
+// monthly budgets. Periods follow UTC calendar days and months.
+type Tracker struct {
+	opts    Options
+	logger  *zap.Logger
+	metrics *metrics.BudgetMetrics
+	now     func() time.Time
+
+	mu        sync.Mutex
+	state     state
+	softNoted map[string]bool
+	dirty     bool
+
+	flushMu sync.Mutex
+	stop    chan struct{}
+	done    chan struct{}
+}
+
+// NewTracker creates a tracker, restoring usage from the state file if present
+func NewTracker(opts Options, logger *zap.Logger) (*Tracker, error) {
+	if opts.Cost == nil {
+		opts.Cost = func(string) int { return 1 }
+	}
+
+	t := &Tracker{
+		opts:      opts,
+		logger:    logger,
+		metrics:   metrics.NewBudgetMetrics(),
+		now:       time.Now,
+		softNoted: make(map[string]bool),
+	}
+
+	if err := t.load(); err != nil {
+		return nil, err
+	}
+
+	t.mu.Lock()
+	t.rollLocked(t.now().UTC())
+	t.reportLocked()
+	t.mu.Unlock()
+
+	return t, nil
+}
+
+// Allow returns an *ExhaustedError if a hard budget has been reached
+func (t *Tracker) Allow() error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	now := t.now().UTC()
+	t.rollLocked(now)
+
+	if hard := t.opts.Daily.Hard; hard > 0 && t.state.DailyUsed >= hard {
+		t.metrics.OnRejected(PeriodDaily)
+		return &ExhaustedError{Period: PeriodDaily, ResetAt: nextDay(now)}
+	}
+	if hard := t.opts.Monthly.Hard; hard > 0 && t.state.MonthlyUsed >= hard {
+		t.metrics.OnRejected(PeriodMonthly)
+		return &ExhaustedError{Period: PeriodMonthly, ResetAt: nextMonth(now)}
+	}
+	return nil
+}
+
+// Record accounts one upstream call to endpoint on chain made with the key
+// identified by keyID
+func (t *Tracker) Record(chain, endpoint, keyID string) {
+	cost := t.opts.Cost(endpoint)
+	t.metrics.OnSpend(chain, endpoint, keyID, cost)
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.rollLocked(t.now().UTC())
+	t.state.DailyUsed += int64(cost)
+	t.state.MonthlyUsed += int64(cost)
+	t.dirty = true
+
+	t.checkSoftLocked(PeriodDaily, t.state.DailyUsed, t.opts.Daily.Soft)
+	t.checkSoftLocked(PeriodMonthly, t.state.MonthlyUsed, t.opts.Monthly.Soft)
+	t.reportLocked()
+}
+
+// Usage returns the compute units spent in the current day and month
+func (t *Tracker) Usage() (daily, monthly int64) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.rollLocked(t.now().UTC())
+	return t.state.DailyUsed, t.state.MonthlyUsed
+}
+
+// Start periodically persists usage to the state file until Close is called
+func (t *Tracker) Start(interval time.Duration) {
+	if t.opts.StateFile == "" || interval <= 0 {
+		return
+	}
+
+	t.stop = make(chan struct{})
+	t.done = make(chan struct{})
+	go func() {
+		defer close(t.done)
+
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				if err := t.Flush(); err != nil {
+					t.logger.Warn("Failed to persist compute unit usage", zap.Error(err))
+				}
+			case <-t.stop:
+				return
+			}
+		}
+	}()
+}
+
+// Close stops the background flush and persists usage one last time
+func (t *Tracker) Close() error {
+	if t.stop != nil {
+		close(t.stop)
+		<-t.done
+		t.stop = nil
+	}
+	return t.Flush()
+}
+
+// Flush writes usage to the state file if it changed since the last flush
+func (t *Tracker) Flush() error {
+	if t.opts.StateFile == "" {
+		return nil
+	}
+
+	t.flushMu.Lock()
+	defer t.flushMu.Unlock()
+
+	t.mu.Lock()
+	if !t.dirty {
+		t.mu.Unlock()
+		return nil
+	}
+	snapshot := t.state
+	t.dirty = false
+	t.mu.Unlock()
+
+	data, err := json.Marshal(snapshot)
+	if err != nil {
+		return fmt.Errorf("failed to encode usage state: %w", err)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(t.opts.StateFile), 0o755); err != nil {
+		return fmt.Errorf("failed to create state directory: %w", err)
+	}
+
+	// Write to a temporary file first so a crash never leaves a torn state file
+	tmp := t.opts.StateFile + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return fmt.Errorf("failed to write usage state: %w", err)
+	}
+	if err := os.Rename(tmp, t.opts.StateFile); err != nil {
+		return fmt.Errorf("failed to replace usage state: %w", err)
+	}
+	return nil
+}
+
+func (t *Tracker) load() error {
+	if t.opts.StateFile == "" {
+		return nil
+	}
+
+	data, err := os.ReadFile(t.opts.StateFile)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read usage state: %w", err)
+	}
+
+	if err := json.Unmarshal(data, &t.state); err != nil {
+		// A corrupt state file should not keep the proxy from starting
+		t.logger.Warn("Ignoring unreadable compute unit usage state", zap.String("path", t.opts.StateFile), zap.Error(err))
+		t.state = state{}
+		return nil
+	}
+
+	t.logger.Info("Restored compute unit usage",
+		zap.String("day", t.state.Day),
+		zap.Int64("daily_used", t.state.DailyUsed),
+		zap.String("month", t.state.Month),
+		zap.Int64("monthly_used", t.state.MonthlyUsed),
+	)
+	return nil
+}
+
+// rollLocked resets counters when a new day or month has started
+func (t *Tracker) rollLocked(now time.Time) {
+	if day := now.Format("2006-01-02"); t.state.Day != day {
+		t.state.Day = day
+		t.state.DailyUsed = 0
+		t.softNoted[PeriodDaily] = false
+		t.dirty = true
+	}
+	if month := now.Format("2006-01"); t.state.Month != month {
+		t.state.Month = month
+		t.state.MonthlyUsed = 0
+		t.softNoted[PeriodMonthly] = false
+		t.dirty = true
+	}
+}
+
+func (t *Tracker) checkSoftLocked(period string, used, soft int64) {
+	if soft <= 0 || used < soft || t.softNoted[period] {
+		return
+	}
+	t.softNoted[period] = true
+	t.metrics.OnSoftBudgetReached(period)
+	t.logger.Warn("Soft compute unit budget reached",
+		zap.String("period", period),
+		zap.Int64("used", used),
+		zap.Int64("soft_budget", soft),
+	)
+}
+
+func (t *Tracker) reportLocked() {
+	t.metrics.SetUsed(PeriodDaily, t.state.DailyUsed)
+	t.metrics.SetUsed(PeriodMonthly, t.state.MonthlyUsed)
+	t.metrics.SetBudgetState(PeriodDaily, budgetState(t.state.DailyUsed, t.opts.Daily))
+	t.metrics.SetBudgetState(PeriodMonthly, budgetState(t.state.MonthlyUsed, t.opts.Monthly))
+}
+
+// budgetState returns 0 under budget, 1 past the soft and 2 past the hard budget
+func budgetState(used int64, limits Limits) int {
+	switch {
+	case limits.Hard > 0 && used >= limits.Hard:
+		return 2
+	case limits.Soft > 0 && used >= limits.Soft:
+		return 1
+	default:
+		return 0
+	}
+}
+
+func nextDay(now time.Time) time.Time {
+	return time.Date(now.Year(), now.Month(), now.Day()+1, 0, 0, 0, 0, time.UTC)
+}
+
+func nextMonth(now time.Time) time.Time {
+	return time.Date(now.Year(), now.Month()+1, 1, 0, 0, 0, 0, time.UTC)
+}
@@ -0,0 +1,102 @@
+package budget
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+func newTestTracker(t *testing.T, opts Options, now time.Time) *Tracker {
+	t.Helper()
+
+	tracker, err := NewTracker(opts, zap.NewNop())
+	if err != nil {
+		t.Fatalf("Failed to create tracker: %v", err)
+	}
+	tracker.now = func() time.Time { return now }
+	return tracker
+}
+
+func TestTracker_HardBudgetRejects(t *testing.T) {
+	now := time.Date(2026, 3, 10, 12, 0, 0, 0, time.UTC)
+	tracker := newTestTracker(t, Options{
+		Cost:  func(string) int { return 100 },
+		Daily: Limits{Soft: 100, Hard: 200},
+	}, now)
+
+	tracker.Record("eth-mainnet", "getNFTsForOwner", "key")
+	if err := tracker.Allow(); err != nil {
+		t.Fatalf("Expected soft budget not to reject, got %v", err)
+	}
+
+	tracker.Record("eth-mainnet", "getNFTsForOwner", "key")
+	err := tracker.Allow()
+	if !errors.Is(err, ErrExhausted) {
+		t.Fatalf("Expected ErrExhausted, got %v", err)
+	}
+
+	var exhausted *ExhaustedError
+	if !errors.As(err, &exhausted) {
+		t.Fatalf("Expected *ExhaustedError, got %T", err)
+	}
+	if exhausted.Period != PeriodDaily {
+		t.Errorf("Expected daily period, got %q", exhausted.Period)
+	}
+	if want := time.Date(2026, 3, 11, 0, 0, 0, 0, time.UTC); !exhausted.ResetAt.Equal(want) {
+		t.Errorf("Expected reset at %s, got %s", want, exhausted.ResetAt)
+	}
+}
+
+func TestTracker_DailyBudgetResetsNextDay(t *testing.T) {
+	now := time.Date(2026, 3, 10, 23, 59, 0, 0, time.UTC)
+	tracker := newTestTracker(t, Options{
+		Cost:    func(string) int { return 100 },
+		Daily:   Limits{Hard: 100},
+		Monthly: Limits{Hard: 1000},
+	}, now)
+
+	tracker.Record("eth-mainnet", "getNFTsForOwner", "key")
+	if err := tracker.Allow(); err == nil {
+		t.Fatal("Expected daily budget to be exhausted")
+	}
+
+	tracker.now = func() time.Time { return now.Add(2 * time.Minute) }
+	if err := tracker.Allow(); err != nil {
+		t.Errorf("Expected budget to reset on the next day, got %v", err)
+	}
+
+	daily, monthly := tracker.Usage()
+	if daily != 0 || monthly != 100 {
+		t.Errorf("Expected usage 0/100 after day rollover, got %d/%d", daily, monthly)
+	}
+}
+
+func TestTracker_UsageSurvivesRestart(t *testing.T) {
+	// NewTracker rolls periods using the wall clock, so stay on the current day
+	now := time.Now().UTC()
+	opts := Options{
+		Cost:      func(string) int { return 50 },
+		StateFile: filepath.Join(t.TempDir(), "usage.json"),
+	}
+
+	tracker := newTestTracker(t, opts, now)
+	tracker.Record("eth-mainnet", "getNFTsForOwner", "key")
+	tracker.Record("base-mainnet", "getNFTsForOwner", "key")
+	if err := tracker.Close(); err != nil {
+		t.Fatalf("Failed to close tracker: %v", err)
+	}
+
+	restored, err := NewTracker(opts, zap.NewNop())
+	if err != nil {
+		t.Fatalf("Failed to restore tracker: %v", err)
+	}
+	restored.now = func() time.Time { return now }
+
+	daily, monthly := restored.Usage()
+	if daily != 100 || monthly != 100 {
+		t.Errorf("Expected restored usage 100/100, got %d/%d", daily, monthly)
+	}
+}
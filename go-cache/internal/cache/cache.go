@@ -0,0 +1,451 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+	"go.uber.org/zap"
+
+	"nft-proxy/internal/metrics"
+)
+
+// Entry is a cached upstream response
+type Entry struct {
+	Body       []byte `json:"body"`
+	StatusCode int    `json:"status_code"`
+	// ContentType and ContentEncoding describe Body as received from
+	// upstream; compressed bodies are stored compressed
+	ContentType     string    `json:"content_type,omitempty"`
+	ContentEncoding string    `json:"content_encoding,omitempty"`
+	StoredAt        time.Time `json:"stored_at"`
+	ExpiresAt       time.Time `json:"expires_at"`
+	// Tags index the entry for purges, see Tags
+	Tags []string `json:"tags,omitempty"`
+}
+
+// Expired reports whether the entry is past its TTL
+func (e *Entry) Expired(now time.Time) bool {
+	return !now.Before(e.ExpiresAt)
+}
+
+// Negative reports whether the entry caches an error response, such as a
+// 404 for a token that does not exist
+func (e *Entry) Negative() bool {
+	return e.StatusCode != http.StatusOK
+}
+
+// Size returns the approximate memory footprint of the entry in bytes
+func (e *Entry) Size() int64 {
+	return int64(len(e.Body))
+}
+
+// Tier is one level of the response cache
+type Tier interface {
+	// Name identifies the tier in headers, logs and metrics
+	Name() string
+	// Get returns the entry stored under key, or nil if there is none
+	Get(ctx context.Context, key string) (*Entry, error)
+	Set(ctx context.Context, key string, entry *Entry) error
+	Delete(ctx context.Context, key string) error
+}
+
+// Purger is implemented by tiers that can delete entries in bulk
+type Purger interface {
+	// PurgeTag deletes the entries carrying tag whose key satisfies match, or
+	// all of them if match is nil, and returns how many it deleted
+	PurgeTag(ctx context.Context, tag string, match func(key string) bool) (int, error)
+	// PurgePrefix deletes every entry whose key starts with prefix and returns
+	// how many it deleted
+	PurgePrefix(ctx context.Context, prefix string) (int, error)
+}
+
+// Ranger is implemented by tiers whose entries can be listed
+type Ranger interface {
+	// Range calls fn for every entry until fn returns an error
+	Range(ctx context.Context, fn func(key string, entry *Entry) error) error
+}
+
+// Rule describes how responses of one endpoint are cached
+type Rule struct {
+	// TTL applies to 200 responses
+	TTL time.Duration
+	// NegativeTTL maps error statuses to how long those responses are cached.
+	// Only statuses accepted by NegativeCacheable are honoured.
+	NegativeTTL map[int]time.Duration
+}
+
+// TTLFor returns how long a response with statusCode is cached, or 0 if it
+// is not cached
+func (r Rule) TTLFor(statusCode int) time.Duration {
+	if statusCode == http.StatusOK {
+		return r.TTL
+	}
+	if !NegativeCacheable(statusCode) {
+		return 0
+	}
+	return r.NegativeTTL[statusCode]
+}
+
+// NegativeCacheable reports whether an error status is deterministic enough
+// to cache: a client error that repeating the request would reproduce.
+// Timeouts, throttling and auth failures, which depend on the proxy's own
+// state or API key, are excluded, as are all 5xx.
+func NegativeCacheable(statusCode int) bool {
+	if statusCode < 400 || statusCode >= 500 {
+		return false
+	}
+	switch statusCode {
+	case http.StatusUnauthorized, http.StatusPaymentRequired, http.StatusForbidden,
+		http.StatusProxyAuthRequired, http.StatusRequestTimeout, http.StatusTooManyRequests:
+		return false
+	}
+	return true
+}
+
+// Rules maps endpoint names to caching rules
+type Rules struct {
+	Default   Rule
+	Endpoints map[string]Rule
+}
+
+// For returns the rule for an endpoint, falling back to Default
+func (r Rules) For(endpoint string) Rule {
+	if rule, ok := r.Endpoints[endpoint]; ok {
+		return rule
+	}
+	return r.Default
+}
+
+// Cache is a multi-tier response cache. Tiers are consulted in order and a
+// hit in a lower tier is copied into the tiers above it.
+type Cache struct {
+	logger  *zap.Logger
+	rules   Rules
+	tiers   []Tier
+	metrics *metrics.CacheMetrics
+	now     func() time.Time
+}
+
+// New creates a response cache over the given tiers, fastest first
+func New(logger *zap.Logger, rules Rules, tiers ...Tier) *Cache {
+	return &Cache{
+		logger:  logger,
+		rules:   rules,
+		tiers:   tiers,
+		metrics: metrics.NewCacheMetrics(),
+		now:     time.Now,
+	}
+}
+
+// Get looks key up in every tier and returns the entry together with the
+// index of the tier that held it (0 for the first tier). endpoint is only used
+// to label metrics.
+func (c *Cache) Get(ctx context.Context, key, endpoint string) (*Entry, int, bool) {
+	now := c.now()
+	for i, tier := range c.tiers {
+		entry, err := c.get(ctx, tier, key)
+		if err != nil {
+			c.logger.Warn("Cache tier lookup failed", zap.String("tier", tier.Name()), zap.Error(err))
+			c.metrics.OnLookup(tier.Name(), endpoint, "miss")
+			continue
+		}
+		if entry == nil {
+			c.metrics.OnLookup(tier.Name(), endpoint, "miss")
+			continue
+		}
+		if entry.Expired(now) {
+			c.metrics.OnLookup(tier.Name(), endpoint, "stale")
+			_ = c.delete(ctx, tier, key)
+			continue
+		}
+		if entry.Negative() {
+			c.metrics.OnLookup(tier.Name(), endpoint, "negative_hit")
+		} else {
+			c.metrics.OnLookup(tier.Name(), endpoint, "hit")
+		}
+
+		for _, upper := range c.tiers[:i] {
+			if err := c.set(ctx, upper, key, entry); err != nil {
+				c.logger.Warn("Cache backfill failed", zap.String("tier", upper.Name()), zap.Error(err))
+			}
+		}
+		return entry, i, true
+	}
+	return nil, 0, false
+}
+
+// Set stores an upstream response if the endpoint's rule allows caching its
+// status. StoredAt and ExpiresAt of entry are filled in from the rule. It
+// reports whether the response was stored.
+func (c *Cache) Set(ctx context.Context, key, endpoint string, entry *Entry) bool {
+	ttl := c.rules.For(endpoint).TTLFor(entry.StatusCode)
+	if ttl <= 0 {
+		return false
+	}
+
+	now := c.now()
+	entry.StoredAt = now
+	entry.ExpiresAt = now.Add(ttl)
+
+	stored := false
+	for _, tier := range c.tiers {
+		if err := c.set(ctx, tier, key, entry); err != nil {
+			c.logger.Warn("Cache store failed", zap.String("tier", tier.Name()), zap.Error(err))
+			continue
+		}
+		stored = true
+	}
+	return stored
+}
+
+// Delete removes key from every tier
+func (c *Cache) Delete(ctx context.Context, key string) {
+	for _, tier := range c.tiers {
+		if err := c.delete(ctx, tier, key); err != nil {
+			c.logger.Warn("Cache delete failed", zap.String("tier", tier.Name()), zap.Error(err))
+		}
+	}
+}
+
+// PurgeResult reports what a purge deleted from one tier
+type PurgeResult struct {
+	Tier   string
+	Purged int
+	Err    error
+}
+
+// errBulkPurgeUnsupported is reported for tiers that do not implement Purger
+var errBulkPurgeUnsupported = errors.New("tier does not support bulk purges")
+
+// PurgeKey removes key from every tier
+func (c *Cache) PurgeKey(ctx context.Context, key string) []PurgeResult {
+	results := make([]PurgeResult, 0, len(c.tiers))
+	for _, tier := range c.tiers {
+		result := PurgeResult{Tier: tier.Name()}
+		entry, err := c.get(ctx, tier, key)
+		if err == nil {
+			err = c.delete(ctx, tier, key)
+		}
+		if err != nil {
+			result.Err = err
+		} else if entry != nil {
+			result.Purged = 1
+		}
+		results = append(results, result)
+	}
+	return results
+}
+
+// PurgeChain removes every entry of a canonical chain from every tier
+func (c *Cache) PurgeChain(ctx context.Context, chain string) []PurgeResult {
+	prefix := keyPrefix + ":" + chain + ":"
+	return c.purge(ctx, func(ctx context.Context, p Purger) (int, error) {
+		return p.PurgePrefix(ctx, prefix)
+	})
+}
+
+// PurgeTag removes every entry carrying tag, such as ContractTag(address),
+// from every tier. If endpoints are given only their entries are removed.
+func (c *Cache) PurgeTag(ctx context.Context, tag string, endpoints ...string) []PurgeResult {
+	var match func(string) bool
+	if len(endpoints) > 0 {
+		match = func(key string) bool {
+			return slices.Contains(endpoints, KeyEndpoint(key))
+		}
+	}
+	return c.purge(ctx, func(ctx context.Context, p Purger) (int, error) {
+		return p.PurgeTag(ctx, tag, match)
+	})
+}
+
+func (c *Cache) purge(ctx context.Context, purge func(context.Context, Purger) (int, error)) []PurgeResult {
+	results := make([]PurgeResult, 0, len(c.tiers))
+	for _, tier := range c.tiers {
+		result := PurgeResult{Tier: tier.Name()}
+		if p, ok := tier.(Purger); ok {
+			spanCtx, span := startSpan(ctx, tier, "purge")
+			start := time.Now()
+			result.Purged, result.Err = purge(spanCtx, p)
+			c.metrics.OnOperation(tier.Name(), "purge", time.Since(start), result.Err)
+			recordSpanError(span, result.Err)
+			span.End()
+		} else {
+			result.Err = errBulkPurgeUnsupported
+		}
+		if result.Err != nil {
+			c.logger.Warn("Cache purge failed", zap.String("tier", tier.Name()), zap.Error(result.Err))
+		}
+		results = append(results, result)
+	}
+	return results
+}
+
+// TierState describes what one tier holds for a key
+type TierState struct {
+	Tier    string
+	Present bool
+	Expired bool
+	// Age is the time since the entry was stored and TTL the time until it
+	// expires, which is negative for expired entries
+	Age             time.Duration
+	TTL             time.Duration
+	Size            int64
+	StatusCode      int
+	ContentEncoding string
+	Err             error
+}
+
+// Inspect reports the state of key in every tier without affecting it:
+// expired entries are not removed and hits are not backfilled
+func (c *Cache) Inspect(ctx context.Context, key string) []TierState {
+	now := c.now()
+	states := make([]TierState, 0, len(c.tiers))
+	for _, tier := range c.tiers {
+		state := TierState{Tier: tier.Name()}
+		entry, err := c.get(ctx, tier, key)
+		switch {
+		case err != nil:
+			state.Err = err
+		case entry != nil:
+			state.Present = true
+			state.Expired = entry.Expired(now)
+			state.Age = now.Sub(entry.StoredAt)
+			state.TTL = entry.ExpiresAt.Sub(now)
+			state.Size = entry.Size()
+			state.StatusCode = entry.StatusCode
+			state.ContentEncoding = entry.ContentEncoding
+		}
+		states = append(states, state)
+	}
+	return states
+}
+
+// Range calls fn for every unexpired entry held by the tiers that can list
+// their entries. A key held by several tiers is visited once, with the entry
+// of the fastest tier.
+func (c *Cache) Range(ctx context.Context, fn func(key string, entry *Entry) error) error {
+	now := c.now()
+	seen := make(map[string]bool)
+	for _, tier := range c.tiers {
+		ranger, ok := tier.(Ranger)
+		if !ok {
+			continue
+		}
+		err := ranger.Range(ctx, func(key string, entry *Entry) error {
+			if seen[key] || entry.Expired(now) {
+				return nil
+			}
+			seen[key] = true
+			return fn(key, entry)
+		})
+		if err != nil {
+			return fmt.Errorf("failed to list %s entries: %w", tier.Name(), err)
+		}
+	}
+	return nil
+}
+
+// Load stores an entry as is in every tier, bypassing the caching rules, as
+// when restoring a snapshot. Expired entries are ignored. It reports whether
+// any tier stored the entry.
+func (c *Cache) Load(ctx context.Context, key string, entry *Entry) bool {
+	if entry.Expired(c.now()) {
+		return false
+	}
+	stored := false
+	for _, tier := range c.tiers {
+		if err := c.set(ctx, tier, key, entry); err != nil {
+			c.logger.Warn("Cache load failed", zap.String("tier", tier.Name()), zap.Error(err))
+			continue
+		}
+		stored = true
+	}
+	return stored
+}
+
+// Remaining returns how long the freshest copy of key stays servable, or 0 if
+// no tier holds a fresh copy. Like Inspect it does not modify the tiers.
+func (c *Cache) Remaining(ctx context.Context, key string) time.Duration {
+	var remaining time.Duration
+	for _, state := range c.Inspect(ctx, key) {
+		if state.Present && !state.Expired && state.TTL > remaining {
+			remaining = state.TTL
+		}
+	}
+	return remaining
+}
+
+// Rule returns the caching rule applied to an endpoint
+func (c *Cache) Rule(endpoint string) Rule {
+	return c.rules.For(endpoint)
+}
+
+// Caches reports whether a response of endpoint with statusCode is stored
+func (c *Cache) Caches(endpoint string, statusCode int) bool {
+	return c.rules.For(endpoint).TTLFor(statusCode) > 0
+}
+
+func (c *Cache) get(ctx context.Context, tier Tier, key string) (*Entry, error) {
+	ctx, span := startSpan(ctx, tier, "get")
+	defer span.End()
+
+	start := time.Now()
+	entry, err := tier.Get(ctx, key)
+	c.metrics.OnOperation(tier.Name(), "get", time.Since(start), err)
+	span.SetAttributes(attribute.Bool("cache.hit", entry != nil))
+	recordSpanError(span, err)
+	return entry, err
+}
+
+func (c *Cache) set(ctx context.Context, tier Tier, key string, entry *Entry) error {
+	ctx, span := startSpan(ctx, tier, "set")
+	defer span.End()
+
+	start := time.Now()
+	err := tier.Set(ctx, key, entry)
+	c.metrics.OnOperation(tier.Name(), "set", time.Since(start), err)
+	recordSpanError(span, err)
+	return err
+}
+
+func (c *Cache) delete(ctx context.Context, tier Tier, key string) error {
+	ctx, span := startSpan(ctx, tier, "delete")
+	defer span.End()
+
+	start := time.Now()
+	err := tier.Delete(ctx, key)
+	c.metrics.OnOperation(tier.Name(), "delete", time.Since(start), err)
+	recordSpanError(span, err)
+	return err
+}
+
+var tracer = otel.Tracer("nft-proxy/internal/cache")
+
+// startSpan starts the span of one tier operation
+func startSpan(ctx context.Context, tier Tier, operation string) (context.Context, trace.Span) {
+	return tracer.Start(ctx, "cache."+operation, trace.WithAttributes(
+		attribute.String("cache.tier", tier.Name()),
+		attribute.String("cache.operation", operation),
+	))
+}
+
+// recordSpanError marks span as failed; cache errors hold no secrets
+func recordSpanError(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+}
+
+// TierName returns the name of the tier at index i
+func (c *Cache) TierName(i int) string {
+	return c.tiers[i].Name()
+}
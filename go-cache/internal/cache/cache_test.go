@@ -0,0 +1,515 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	bolt "go.etcd.io/bbolt"
+	"go.uber.org/zap"
+)
+
+func TestMemory_EvictsLeastRecentlyUsed(t *testing.T) {
+	ctx := context.Background()
+	m := NewMemory(2, 0)
+
+	m.Set(ctx, "a", &Entry{Body: []byte("a")})
+	m.Set(ctx, "b", &Entry{Body: []byte("b")})
+	m.Get(ctx, "a")
+	m.Set(ctx, "c", &Entry{Body: []byte("c")})
+
+	if entry, _ := m.Get(ctx, "b"); entry != nil {
+		t.Error("Expected least recently used entry b to be evicted")
+	}
+	if entry, _ := m.Get(ctx, "a"); entry == nil {
+		t.Error("Expected recently used entry a to be kept")
+	}
+}
+
+func TestMemory_EvictsBySize(t *testing.T) {
+	ctx := context.Background()
+	m := NewMemory(0, 10)
+
+	m.Set(ctx, "a", &Entry{Body: make([]byte, 6)})
+	m.Set(ctx, "b", &Entry{Body: make([]byte, 6)})
+
+	if m.Len() != 1 || m.Bytes() != 6 {
+		t.Errorf("Expected 1 entry of 6 bytes, got %d entries of %d bytes", m.Len(), m.Bytes())
+	}
+
+	m.Set(ctx, "huge", &Entry{Body: make([]byte, 11)})
+	if entry, _ := m.Get(ctx, "huge"); entry != nil {
+		t.Error("Expected entry larger than the cache to be skipped")
+	}
+}
+
+func TestCache_SetHonoursRules(t *testing.T) {
+	ctx := context.Background()
+	c := New(zap.NewNop(), Rules{
+		Default:   Rule{TTL: time.Minute},
+		Endpoints: map[string]Rule{"getNFTSales": {TTL: 0}},
+	}, NewMemory(10, 0))
+
+	if !c.Set(ctx, "k1", "getNFTsForOwner", &Entry{StatusCode: http.StatusOK, Body: []byte("{}")}) {
+		t.Error("Expected 200 response to be cached")
+	}
+	if c.Set(ctx, "k2", "getNFTsForOwner", &Entry{StatusCode: http.StatusInternalServerError, Body: []byte("{}")}) {
+		t.Error("Expected 500 response not to be cached")
+	}
+	if c.Set(ctx, "k3", "getNFTSales", &Entry{StatusCode: http.StatusOK, Body: []byte("{}")}) {
+		t.Error("Expected endpoint with zero TTL not to be cached")
+	}
+}
+
+func TestCache_NegativeCaching(t *testing.T) {
+	ctx := context.Background()
+	c := New(zap.NewNop(), Rules{
+		Default: Rule{TTL: time.Hour, NegativeTTL: map[int]time.Duration{
+			http.StatusNotFound:        time.Minute,
+			http.StatusTooManyRequests: time.Minute,
+			http.StatusBadGateway:      time.Minute,
+		}},
+	}, NewMemory(10, 0))
+
+	if !c.Set(ctx, "missing", "getNFTMetadata", &Entry{StatusCode: http.StatusNotFound, Body: []byte("{}")}) {
+		t.Fatal("Expected 404 response with a negative TTL to be cached")
+	}
+	entry, _, ok := c.Get(ctx, "missing", "getNFTMetadata")
+	if !ok || !entry.Negative() {
+		t.Fatalf("Expected negative hit, got ok=%v entry=%+v", ok, entry)
+	}
+	if ttl := entry.ExpiresAt.Sub(entry.StoredAt); ttl != time.Minute {
+		t.Errorf("Expected negative TTL of 1m, got %v", ttl)
+	}
+
+	for _, status := range []int{http.StatusBadRequest, http.StatusTooManyRequests, http.StatusBadGateway} {
+		if c.Set(ctx, "k", "getNFTMetadata", &Entry{StatusCode: status, Body: []byte("{}")}) {
+			t.Errorf("Expected %d response not to be cached", status)
+		}
+	}
+}
+
+func TestCache_ExpiredEntriesMiss(t *testing.T) {
+	ctx := context.Background()
+	c := New(zap.NewNop(), Rules{Default: Rule{TTL: time.Minute}}, NewMemory(10, 0))
+
+	now := time.Now()
+	c.now = func() time.Time { return now }
+	c.Set(ctx, "k", "getNFTsForOwner", &Entry{StatusCode: http.StatusOK, Body: []byte("{}")})
+
+	if _, _, ok := c.Get(ctx, "k", "getNFTsForOwner"); !ok {
+		t.Fatal("Expected fresh entry to hit")
+	}
+
+	c.now = func() time.Time { return now.Add(2 * time.Minute) }
+	if _, _, ok := c.Get(ctx, "k", "getNFTsForOwner"); ok {
+		t.Error("Expected expired entry to miss")
+	}
+}
+
+func TestCache_BackfillsUpperTiers(t *testing.T) {
+	ctx := context.Background()
+	l1 := NewMemory(10, 0)
+	l2 := NewMemory(10, 0)
+	c := New(zap.NewNop(), Rules{Default: Rule{TTL: time.Minute}}, l1, l2)
+
+	l2.Set(ctx, "k", &Entry{Body: []byte("{}"), StatusCode: http.StatusOK, ExpiresAt: time.Now().Add(time.Minute)})
+
+	_, tier, ok := c.Get(ctx, "k", "getNFTsForOwner")
+	if !ok || tier != 1 {
+		t.Fatalf("Expected hit in tier 1, got ok=%v tier=%d", ok, tier)
+	}
+	if entry, _ := l1.Get(ctx, "k"); entry == nil {
+		t.Error("Expected lower-tier hit to be copied into L1")
+	}
+}
+
+func TestKey(t *testing.T) {
+	base := Key("eth-mainnet", "getNFTsForOwner", http.MethodGet, "/getNFTsForOwner", "owner=0x1&withMetadata=true", nil)
+
+	if got := Key("eth-mainnet", "getNFTsForOwner", http.MethodGet, "/getNFTsForOwner", "withMetadata=true&owner=0x1&token=abc", nil); got != base {
+		t.Errorf("Expected parameter order and auth tokens not to change the key")
+	}
+	if got := Key("eth-mainnet", "getNFTsForOwner", http.MethodGet, "/getNFTsForOwner", "owner=0x2&withMetadata=true", nil); got == base {
+		t.Errorf("Expected different owners to get different keys")
+	}
+	if got := Key("base-mainnet", "getNFTsForOwner", http.MethodGet, "/getNFTsForOwner", "owner=0x1&withMetadata=true", nil); got == base {
+		t.Errorf("Expected different chains to get different keys")
+	}
+}
+
+func TestKeyDB_RoundTripsEntries(t *testing.T) {
+	ctx := context.Background()
+	server := miniredis.RunT(t)
+	tier := NewKeyDB(redis.NewClient(&redis.Options{Addr: server.Addr()}))
+
+	stored := &Entry{
+		Body:            []byte("{}"),
+		StatusCode:      http.StatusOK,
+		ContentEncoding: "gzip",
+		StoredAt:        time.Now(),
+		ExpiresAt:       time.Now().Add(time.Minute),
+	}
+	if err := tier.Set(ctx, "k", stored); err != nil {
+		t.Fatalf("Failed to store entry: %v", err)
+	}
+	if ttl := server.TTL("k"); ttl <= 0 || ttl > time.Minute {
+		t.Errorf("Expected key to expire within a minute, got TTL %s", ttl)
+	}
+
+	entry, err := tier.Get(ctx, "k")
+	if err != nil || entry == nil {
+		t.Fatalf("Expected stored entry, got %v (err %v)", entry, err)
+	}
+	if string(entry.Body) != "{}" || entry.ContentEncoding != "gzip" {
+		t.Errorf("Unexpected entry %+v", entry)
+	}
+
+	if entry, err := tier.Get(ctx, "missing"); entry != nil || err != nil {
+		t.Errorf("Expected miss without error, got %v (err %v)", entry, err)
+	}
+}
+
+func TestCache_InspectDoesNotModifyTiers(t *testing.T) {
+	ctx := context.Background()
+	l1 := NewMemory(10, 0)
+	l2 := NewMemory(10, 0)
+	c := New(zap.NewNop(), Rules{Default: Rule{TTL: time.Minute}}, l1, l2)
+
+	now := time.Now()
+	c.now = func() time.Time { return now }
+	l2.Set(ctx, "k", &Entry{Body: []byte("{}"), StatusCode: http.StatusOK, StoredAt: now.Add(-10 * time.Second), ExpiresAt: now.Add(50 * time.Second)})
+
+	states := c.Inspect(ctx, "k")
+	if len(states) != 2 || states[0].Present || !states[1].Present {
+		t.Fatalf("Expected entry only in the second tier, got %+v", states)
+	}
+	if states[1].Age != 10*time.Second || states[1].TTL != 50*time.Second {
+		t.Errorf("Expected age 10s and TTL 50s, got %s and %s", states[1].Age, states[1].TTL)
+	}
+	if entry, _ := l1.Get(ctx, "k"); entry != nil {
+		t.Error("Expected inspection not to backfill L1")
+	}
+}
+
+func TestTags(t *testing.T) {
+	tags := Tags("owner=0xAbC&contractAddresses[]=0x1&contractAddresses[]=0x2&withMetadata=true", nil)
+	want := map[string]bool{"owner:0xabc": true, "contract:0x1": true, "contract:0x2": true}
+	if len(tags) != len(want) {
+		t.Fatalf("Expected tags %v, got %v", want, tags)
+	}
+	for _, tag := range tags {
+		if !want[tag] {
+			t.Errorf("Unexpected tag %q", tag)
+		}
+	}
+
+	body := []byte(`{"tokens":[{"contractAddress":"0xA","tokenId":"1"},{"contractAddress":"0xa","tokenId":"2"}]}`)
+	if tags := Tags("", body); len(tags) != 1 || tags[0] != ContractTag("0xA") {
+		t.Errorf("Expected one contract tag from the body, got %v", tags)
+	}
+
+	// A malformed pair must not make the rest of the entry unpurgeable
+	if tags := Tags("owner=0x1&bad=%zz", nil); len(tags) != 1 || tags[0] != OwnerTag("0x1") {
+		t.Errorf("Expected the owner tag despite a malformed parameter, got %v", tags)
+	}
+}
+
+func TestMemory_PurgesByTagAndPrefix(t *testing.T) {
+	ctx := context.Background()
+	m := NewMemory(2, 0)
+
+	m.Set(ctx, "nft:v1:eth-mainnet:a", &Entry{Body: []byte("a"), Tags: []string{OwnerTag("0x1")}})
+	m.Set(ctx, "nft:v1:base-mainnet:b", &Entry{Body: []byte("b"), Tags: []string{OwnerTag("0x1")}})
+	m.Set(ctx, "nft:v1:eth-mainnet:c", &Entry{Body: []byte("c")})
+
+	// a was evicted, so only b is left to purge and the index must not hold a
+	if n, _ := m.PurgeTag(ctx, OwnerTag("0x1"), nil); n != 1 {
+		t.Errorf("Expected 1 entry purged by tag, got %d", n)
+	}
+	if len(m.tagged) != 0 {
+		t.Errorf("Expected empty tag index, got %v", m.tagged)
+	}
+
+	if n, _ := m.PurgePrefix(ctx, "nft:v1:eth-mainnet:"); n != 1 || m.Len() != 0 {
+		t.Errorf("Expected 1 entry purged by prefix, got %d with %d left", n, m.Len())
+	}
+}
+
+func TestKeyDB_PurgesByTagAndPrefix(t *testing.T) {
+	ctx := context.Background()
+	server := miniredis.RunT(t)
+	tier := NewKeyDB(redis.NewClient(&redis.Options{Addr: server.Addr()}))
+
+	expires := time.Now().Add(time.Minute)
+	tier.Set(ctx, "nft:v1:eth-mainnet:a", &Entry{Body: []byte("a"), ExpiresAt: expires, Tags: []string{ContractTag("0x1")}})
+	tier.Set(ctx, "nft:v1:base-mainnet:b", &Entry{Body: []byte("b"), ExpiresAt: expires, Tags: []string{ContractTag("0x1")}})
+	tier.Set(ctx, "nft:v1:eth-mainnet:c", &Entry{Body: []byte("c"), ExpiresAt: expires})
+
+	if ttl := server.TTL(tagIndexPrefix + ContractTag("0x1")); ttl <= 0 {
+		t.Errorf("Expected tag index to expire, got TTL %s", ttl)
+	}
+
+	if n, err := tier.PurgeTag(ctx, ContractTag("0x1"), nil); n != 2 || err != nil {
+		t.Errorf("Expected 2 entries purged by tag, got %d (err %v)", n, err)
+	}
+	if server.Exists(tagIndexPrefix + ContractTag("0x1")) {
+		t.Error("Expected purged tag index to be removed")
+	}
+
+	if n, err := tier.PurgePrefix(ctx, "nft:v1:eth-mainnet:"); n != 1 || err != nil {
+		t.Errorf("Expected 1 entry purged by prefix, got %d (err %v)", n, err)
+	}
+	if keys := server.Keys(); len(keys) != 0 {
+		t.Errorf("Expected no keys left, got %v", keys)
+	}
+}
+
+// commandRecorder records the commands a client sends
+type commandRecorder struct {
+	commands [][]any
+}
+
+func (c *commandRecorder) DialHook(next redis.DialHook) redis.DialHook { return next }
+
+func (c *commandRecorder) ProcessHook(next redis.ProcessHook) redis.ProcessHook {
+	return func(ctx context.Context, cmd redis.Cmder) error {
+		c.commands = append(c.commands, cmd.Args())
+		return next(ctx, cmd)
+	}
+}
+
+func (c *commandRecorder) ProcessPipelineHook(next redis.ProcessPipelineHook) redis.ProcessPipelineHook {
+	return func(ctx context.Context, cmds []redis.Cmder) error {
+		for _, cmd := range cmds {
+			c.commands = append(c.commands, cmd.Args())
+		}
+		return next(ctx, cmds)
+	}
+}
+
+func TestKeyDB_TagIndexTTLWithoutRedis7Commands(t *testing.T) {
+	ctx := context.Background()
+	server := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: server.Addr()})
+	recorder := &commandRecorder{}
+	client.AddHook(recorder)
+	tier := NewKeyDB(client)
+
+	index := tagIndexPrefix + OwnerTag("0x1")
+	for _, ttl := range []time.Duration{time.Minute, 10 * time.Minute, time.Minute} {
+		if err := tier.Set(ctx, "nft:v1:eth-mainnet:"+ttl.String(), &Entry{Body: []byte("{}"), ExpiresAt: time.Now().Add(ttl), Tags: []string{OwnerTag("0x1")}}); err != nil {
+			t.Fatalf("Set failed: %v", err)
+		}
+	}
+	if ttl := server.TTL(index); ttl <= 9*time.Minute {
+		t.Errorf("Expected the tag index to live as long as its longest entry, got TTL %s", ttl)
+	}
+
+	// KeyDB speaks the Redis 6 protocol, which has no EXPIRE flags
+	for _, args := range recorder.commands {
+		name := strings.ToLower(fmt.Sprint(args[0]))
+		if strings.Contains(name, "expire") && len(args) > 3 {
+			t.Errorf("Unexpected Redis 7 command %v", args)
+		}
+	}
+}
+
+func TestCache_PurgeKeyCoversEveryTier(t *testing.T) {
+	ctx := context.Background()
+	l1 := NewMemory(10, 0)
+	l2 := NewMemory(10, 0)
+	c := New(zap.NewNop(), Rules{Default: Rule{TTL: time.Minute}}, l1, l2)
+
+	c.Set(ctx, "k", "getNFTsForOwner", &Entry{StatusCode: http.StatusOK, Body: []byte("{}")})
+	results := c.PurgeKey(ctx, "k")
+	if len(results) != 2 || results[0].Purged != 1 || results[1].Purged != 1 {
+		t.Errorf("Expected the key purged from both tiers, got %+v", results)
+	}
+	if _, _, ok := c.Get(ctx, "k", "getNFTsForOwner"); ok {
+		t.Error("Expected purged key to miss")
+	}
+}
+
+func TestCache_PurgeTagByEndpoint(t *testing.T) {
+	ctx := context.Background()
+	server := miniredis.RunT(t)
+	l2 := NewKeyDB(redis.NewClient(&redis.Options{Addr: server.Addr()}))
+	c := New(zap.NewNop(), Rules{Default: Rule{TTL: time.Minute}}, NewMemory(10, 0), l2)
+
+	owned := Key("eth-mainnet", "getNFTsForOwner", http.MethodGet, "/getNFTsForOwner", "owner=0x1", nil)
+	contracts := Key("eth-mainnet", "getContractsForOwner", http.MethodGet, "/getContractsForOwner", "owner=0x1", nil)
+	for _, key := range []string{owned, contracts} {
+		c.Set(ctx, key, KeyEndpoint(key), &Entry{StatusCode: http.StatusOK, Body: []byte("{}"), Tags: []string{OwnerTag("0x1")}})
+	}
+
+	results := c.PurgeTag(ctx, OwnerTag("0x1"), "getNFTsForOwner")
+	if len(results) != 2 || results[0].Purged != 1 || results[1].Purged != 1 {
+		t.Fatalf("Expected one entry purged per tier, got %+v", results)
+	}
+	if _, _, ok := c.Get(ctx, contracts, "getContractsForOwner"); !ok {
+		t.Error("Expected entry of another endpoint to stay cached")
+	}
+	if members, _ := server.SMembers(tagIndexPrefix + OwnerTag("0x1")); len(members) != 1 || members[0] != contracts {
+		t.Errorf("Expected only the remaining key in the tag index, got %v", members)
+	}
+}
+
+func TestDisk_SurvivesReopen(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "cache.db")
+
+	disk, err := OpenDisk(path, 0, 0)
+	if err != nil {
+		t.Fatalf("Failed to open disk cache: %v", err)
+	}
+	now := time.Now()
+	disk.Set(ctx, "fresh", &Entry{Body: []byte("{}"), StatusCode: http.StatusOK, ContentEncoding: "gzip", StoredAt: now, ExpiresAt: now.Add(time.Hour), Tags: []string{OwnerTag("0x1")}})
+	disk.Set(ctx, "expired", &Entry{Body: []byte("{}"), StoredAt: now.Add(-time.Hour), ExpiresAt: now.Add(-time.Minute)})
+	if err := disk.Close(); err != nil {
+		t.Fatalf("Failed to close disk cache: %v", err)
+	}
+
+	disk, err = OpenDisk(path, 0, 0)
+	if err != nil {
+		t.Fatalf("Failed to reopen disk cache: %v", err)
+	}
+	defer disk.Close()
+
+	entry, err := disk.Get(ctx, "fresh")
+	if err != nil || entry == nil || string(entry.Body) != "{}" || entry.ContentEncoding != "gzip" {
+		t.Fatalf("Expected stored entry after reopening, got %+v (err %v)", entry, err)
+	}
+	if entry, _ := disk.Get(ctx, "expired"); entry != nil || disk.Len() != 1 {
+		t.Errorf("Expected expired entry to be dropped on open, %d entries left", disk.Len())
+	}
+	if n, _ := disk.PurgeTag(ctx, OwnerTag("0x1"), nil); n != 1 || disk.Len() != 0 {
+		t.Errorf("Expected tag index to be rebuilt on open, purged %d", n)
+	}
+}
+
+func TestDisk_EvictsLeastRecentlyUsedBySize(t *testing.T) {
+	ctx := context.Background()
+	disk, err := OpenDisk(filepath.Join(t.TempDir(), "cache.db"), 10, 0)
+	if err != nil {
+		t.Fatalf("Failed to open disk cache: %v", err)
+	}
+	defer disk.Close()
+
+	expires := time.Now().Add(time.Hour)
+	disk.Set(ctx, "a", &Entry{Body: make([]byte, 4), ExpiresAt: expires})
+	disk.Set(ctx, "b", &Entry{Body: make([]byte, 4), ExpiresAt: expires})
+	disk.flush()
+	disk.Get(ctx, "a")
+	disk.Set(ctx, "c", &Entry{Body: make([]byte, 4), ExpiresAt: expires})
+	disk.flush()
+
+	if entry, _ := disk.Get(ctx, "b"); entry != nil {
+		t.Error("Expected least recently used entry b to be evicted")
+	}
+	if entry, _ := disk.Get(ctx, "a"); entry == nil {
+		t.Error("Expected recently used entry a to be kept")
+	}
+	if disk.Bytes() != 8 {
+		t.Errorf("Expected 8 bytes held, got %d", disk.Bytes())
+	}
+}
+
+func TestDisk_PurgeCoversQueuedWrites(t *testing.T) {
+	ctx := context.Background()
+	disk, err := OpenDisk(filepath.Join(t.TempDir(), "cache.db"), 0, 0)
+	if err != nil {
+		t.Fatalf("Failed to open disk cache: %v", err)
+	}
+	defer disk.Close()
+
+	expires := time.Now().Add(time.Hour)
+	for _, key := range []string{"a", "b", "c"} {
+		if err := disk.Set(ctx, key, &Entry{Body: []byte(key), ExpiresAt: expires, Tags: []string{OwnerTag("0x1")}}); err != nil {
+			t.Fatalf("Set failed: %v", err)
+		}
+	}
+
+	// The purge is committed after the writes queued before it
+	if n, err := disk.PurgeTag(ctx, OwnerTag("0x1"), nil); n != 3 || err != nil {
+		t.Errorf("Expected 3 queued entries purged, got %d (err %v)", n, err)
+	}
+	if entry, _ := disk.Get(ctx, "a"); entry != nil || disk.Len() != 0 {
+		t.Errorf("Expected no entries left, got %d", disk.Len())
+	}
+}
+
+func TestDisk_FailedCommitKeepsPreviousEntries(t *testing.T) {
+	ctx := context.Background()
+	disk, err := OpenDisk(filepath.Join(t.TempDir(), "cache.db"), 10, 0)
+	if err != nil {
+		t.Fatalf("Failed to open disk cache: %v", err)
+	}
+	defer disk.Close()
+
+	expires := time.Now().Add(time.Hour)
+	disk.Set(ctx, "a", &Entry{Body: make([]byte, 4), ExpiresAt: expires})
+	disk.flush()
+
+	// The store evicts a, but bbolt rejects the oversized key, so the
+	// transaction is rolled back and a is still in the file
+	tooLong := strings.Repeat("k", bolt.MaxKeySize+1)
+	disk.Set(ctx, tooLong, &Entry{Body: make([]byte, 8), ExpiresAt: expires})
+	disk.flush()
+
+	if entry, _ := disk.Get(ctx, "a"); entry == nil {
+		t.Error("Expected the evicted entry to be served again after the failed commit")
+	}
+	if entry, _ := disk.Get(ctx, tooLong); entry != nil {
+		t.Error("Expected the failed store not to be served")
+	}
+	if disk.Len() != 1 || disk.Bytes() != 4 {
+		t.Errorf("Expected the index as before the failed commit, got %d entries and %d bytes", disk.Len(), disk.Bytes())
+	}
+}
+
+func TestDisk_SetAfterClose(t *testing.T) {
+	disk, err := OpenDisk(filepath.Join(t.TempDir(), "cache.db"), 0, 0)
+	if err != nil {
+		t.Fatalf("Failed to open disk cache: %v", err)
+	}
+	if err := disk.Close(); err != nil {
+		t.Fatalf("Failed to close disk cache: %v", err)
+	}
+
+	err = disk.Set(context.Background(), "a", &Entry{Body: []byte("a"), ExpiresAt: time.Now().Add(time.Hour)})
+	if !errors.Is(err, errDiskClosed) {
+		t.Errorf("Expected errDiskClosed, got %v", err)
+	}
+	if _, err := disk.PurgePrefix(context.Background(), ""); !errors.Is(err, errDiskClosed) {
+		t.Errorf("Expected purges to fail with errDiskClosed, got %v", err)
+	}
+}
+
+func TestDisk_SweepRemovesExpiredEntries(t *testing.T) {
+	ctx := context.Background()
+	disk, err := OpenDisk(filepath.Join(t.TempDir(), "cache.db"), 0, 0)
+	if err != nil {
+		t.Fatalf("Failed to open disk cache: %v", err)
+	}
+	defer disk.Close()
+
+	now := time.Now()
+	disk.Set(ctx, "a", &Entry{Body: []byte("a"), ExpiresAt: now.Add(time.Minute)})
+	disk.Set(ctx, "b", &Entry{Body: []byte("b"), ExpiresAt: now.Add(time.Hour)})
+
+	disk.now = func() time.Time { return now.Add(2 * time.Minute) }
+	if n, err := disk.Sweep(); n != 1 || err != nil {
+		t.Errorf("Expected 1 expired entry swept, got %d (err %v)", n, err)
+	}
+	if entry, _ := disk.Get(ctx, "a"); entry != nil {
+		t.Error("Expected swept entry to be gone from disk")
+	}
+}
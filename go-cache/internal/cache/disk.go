@@ -0,0 +1,598 @@
+package cache
+
+import (
+	"container/list"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+
+	"nft-proxy/internal/metrics"
+)
+
+var (
+	// diskEntriesBucket maps keys to JSON encoded entries
+	diskEntriesBucket = []byte("entries")
+	// diskMetaBucket maps keys to the diskMeta loaded at startup, so the
+	// index is rebuilt without reading every body
+	diskMetaBucket = []byte("meta")
+)
+
+// diskQueueSize bounds the writes waiting to be committed. Stores only wait
+// for room when the writer falls this far behind, e.g. during imports.
+const diskQueueSize = 1024
+
+// diskMaxBatch bounds the writes committed in one transaction
+const diskMaxBatch = 256
+
+var errDiskClosed = errors.New("disk cache closed")
+
+// diskOp is a write applied by the writer goroutine in queue order. It either
+// stores an entry or, with remove set, deletes the keys remove selects once
+// every earlier write is applied.
+type diskOp struct {
+	key      string
+	meta     diskMeta
+	data     []byte
+	metaData []byte
+
+	remove func() []string
+	done   chan diskResult
+}
+
+// diskResult is what a removal reports once committed
+type diskResult struct {
+	removed int
+	err     error
+}
+
+// diskWrite is one change to the file; a nil data deletes key
+type diskWrite struct {
+	key  string
+	data []byte
+	meta []byte
+}
+
+// diskMeta is what the in-memory index holds about a stored entry
+type diskMeta struct {
+	Size      int64     `json:"size"`
+	StoredAt  time.Time `json:"stored_at"`
+	ExpiresAt time.Time `json:"expires_at"`
+	Tags      []string  `json:"tags,omitempty"`
+}
+
+type diskItem struct {
+	key  string
+	meta diskMeta
+}
+
+// Disk is a cache tier in an embedded bbolt file that survives restarts. It
+// is bounded by total body size with LRU eviction. Recency is tracked in
+// memory only; after a restart entries are ordered by when they were stored.
+// Expired entries are removed every sweep interval. The file does not shrink
+// when entries are removed, but bbolt reuses its free pages.
+//
+// Stores are queued and committed by a single writer, which batches whatever
+// is queued into one transaction, so a cache miss never waits for a disk
+// sync. Until its write is committed a stored entry is not yet served.
+// Deletes and purges go through the same queue and wait for their commit,
+// so they also remove entries stored just before them.
+type Disk struct {
+	db       *bolt.DB
+	maxBytes int64
+	metrics  *metrics.CacheMetrics
+	now      func() time.Time
+
+	mu     sync.Mutex
+	items  map[string]*list.Element
+	lru    *list.List
+	bytes  int64
+	tagged map[string]map[string]struct{}
+
+	queue chan diskOp
+	stop  chan struct{}
+	done  chan struct{}
+
+	// closeMu is held for reading while queueing, so that nothing is queued
+	// once Close has stopped the writer
+	closeMu sync.RWMutex
+	closed  bool
+}
+
+// OpenDisk opens or creates the tier's file at path. A zero maxBytes means
+// unbounded. Close must be called to release the file.
+func OpenDisk(path string, maxBytes int64, sweepInterval time.Duration) (*Disk, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create cache directory: %w", err)
+	}
+	db, err := bolt.Open(path, 0o600, &bolt.Options{Timeout: time.Second})
+	if err != nil {
+		return nil, fmt.Errorf("failed to open disk cache: %w", err)
+	}
+
+	d := &Disk{
+		db:       db,
+		maxBytes: maxBytes,
+		metrics:  metrics.NewCacheMetrics(),
+		now:      time.Now,
+		items:    make(map[string]*list.Element),
+		lru:      list.New(),
+		tagged:   make(map[string]map[string]struct{}),
+		queue:    make(chan diskOp, diskQueueSize),
+		stop:     make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+	if err := d.load(); err != nil {
+		db.Close()
+		return nil, err
+	}
+	go d.run(sweepInterval)
+	return d, nil
+}
+
+// Name implements Tier
+func (d *Disk) Name() string {
+	return "disk"
+}
+
+// Get implements Tier. Only indexed entries are served, so a write that
+// failed to commit after a purge cannot bring an entry back.
+func (d *Disk) Get(_ context.Context, key string) (*Entry, error) {
+	d.mu.Lock()
+	elem, ok := d.items[key]
+	if ok {
+		d.lru.MoveToFront(elem)
+	}
+	d.mu.Unlock()
+	if !ok {
+		return nil, nil
+	}
+
+	var entry *Entry
+	err := d.db.View(func(tx *bolt.Tx) error {
+		data := tx.Bucket(diskEntriesBucket).Get([]byte(key))
+		if data == nil {
+			return nil
+		}
+		entry = &Entry{}
+		if err := json.Unmarshal(data, entry); err != nil {
+			return fmt.Errorf("failed to decode cache entry: %w", err)
+		}
+		return nil
+	})
+	if err != nil || entry == nil {
+		return nil, err
+	}
+	return entry, nil
+}
+
+// Set implements Tier. The entry is queued for the writer and Set returns
+// without waiting for the commit.
+func (d *Disk) Set(ctx context.Context, key string, entry *Entry) error {
+	if d.maxBytes > 0 && entry.Size() > d.maxBytes {
+		// Never let a single entry flush the whole cache
+		return nil
+	}
+
+	meta := diskMeta{Size: entry.Size(), StoredAt: entry.StoredAt, ExpiresAt: entry.ExpiresAt, Tags: entry.Tags}
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return fmt.Errorf("failed to encode cache entry: %w", err)
+	}
+	metaData, err := json.Marshal(meta)
+	if err != nil {
+		return fmt.Errorf("failed to encode cache entry: %w", err)
+	}
+
+	return d.enqueue(ctx, diskOp{key: key, meta: meta, data: data, metaData: metaData})
+}
+
+// enqueue queues op for the writer, waiting for room if the queue is full.
+// It returns errDiskClosed once Close was called.
+func (d *Disk) enqueue(ctx context.Context, op diskOp) error {
+	d.closeMu.RLock()
+	defer d.closeMu.RUnlock()
+	if d.closed {
+		return errDiskClosed
+	}
+
+	select {
+	case d.queue <- op:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Delete implements Tier
+func (d *Disk) Delete(ctx context.Context, key string) error {
+	_, err := d.remove(ctx, func() []string {
+		if _, ok := d.items[key]; !ok {
+			return nil
+		}
+		return []string{key}
+	})
+	return err
+}
+
+// PurgeTag implements Purger
+func (d *Disk) PurgeTag(ctx context.Context, tag string, match func(key string) bool) (int, error) {
+	return d.remove(ctx, func() []string {
+		var keys []string
+		for key := range d.tagged[tag] {
+			if match == nil || match(key) {
+				keys = append(keys, key)
+			}
+		}
+		return keys
+	})
+}
+
+// PurgePrefix implements Purger
+func (d *Disk) PurgePrefix(ctx context.Context, prefix string) (int, error) {
+	return d.remove(ctx, func() []string {
+		var keys []string
+		for key := range d.items {
+			if strings.HasPrefix(key, prefix) {
+				keys = append(keys, key)
+			}
+		}
+		return keys
+	})
+}
+
+// Range implements Ranger. fn runs inside a read transaction and must not
+// write to the tier.
+func (d *Disk) Range(ctx context.Context, fn func(key string, entry *Entry) error) error {
+	return d.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(diskEntriesBucket).ForEach(func(k, v []byte) error {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			var entry Entry
+			if err := json.Unmarshal(v, &entry); err != nil {
+				return fmt.Errorf("failed to decode cache entry: %w", err)
+			}
+			return fn(string(k), &entry)
+		})
+	})
+}
+
+// Sweep removes expired entries and returns how many it removed
+func (d *Disk) Sweep() (int, error) {
+	return d.remove(context.Background(), d.expired)
+}
+
+// expired returns the keys of expired entries; d.mu must be held
+func (d *Disk) expired() []string {
+	now := d.now()
+	var keys []string
+	for key, elem := range d.items {
+		if !now.Before(elem.Value.(*diskItem).meta.ExpiresAt) {
+			keys = append(keys, key)
+		}
+	}
+	return keys
+}
+
+// Len returns the number of entries held
+func (d *Disk) Len() int {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return len(d.items)
+}
+
+// Bytes returns the total body size of the entries held
+func (d *Disk) Bytes() int64 {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.bytes
+}
+
+// Close commits the queued writes, stops the writer and closes the file.
+// Writes after Close fail with errDiskClosed.
+func (d *Disk) Close() error {
+	d.closeMu.Lock()
+	if d.closed {
+		d.closeMu.Unlock()
+		return errDiskClosed
+	}
+	d.closed = true
+	d.closeMu.Unlock()
+
+	close(d.stop)
+	<-d.done
+	return d.db.Close()
+}
+
+// load creates the buckets and rebuilds the index, dropping expired entries
+func (d *Disk) load() error {
+	now := d.now()
+	var items []diskItem
+	var expired []string
+	err := d.db.Update(func(tx *bolt.Tx) error {
+		if _, err := tx.CreateBucketIfNotExists(diskEntriesBucket); err != nil {
+			return err
+		}
+		meta, err := tx.CreateBucketIfNotExists(diskMetaBucket)
+		if err != nil {
+			return err
+		}
+
+		err = meta.ForEach(func(k, v []byte) error {
+			var m diskMeta
+			if err := json.Unmarshal(v, &m); err != nil || !now.Before(m.ExpiresAt) {
+				expired = append(expired, string(k))
+				return nil
+			}
+			items = append(items, diskItem{key: string(k), meta: m})
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		return deleteDiskKeys(tx, expired)
+	})
+	if err != nil {
+		return fmt.Errorf("failed to load disk cache: %w", err)
+	}
+
+	// Oldest first, so the most recently stored entry ends up at the front
+	sort.Slice(items, func(i, j int) bool { return items[i].meta.StoredAt.Before(items[j].meta.StoredAt) })
+	for _, item := range items {
+		d.addItem(item.key, item.meta)
+	}
+
+	// The size cap may have been lowered since the entries were stored
+	if victims := d.victims("", 0); len(victims) > 0 {
+		if err := d.db.Update(func(tx *bolt.Tx) error {
+			return deleteDiskKeys(tx, victims)
+		}); err != nil {
+			return fmt.Errorf("failed to load disk cache: %w", err)
+		}
+		for _, victim := range victims {
+			d.removeItem(victim)
+		}
+	}
+	d.metrics.SetSize(d.Name(), len(d.items), d.bytes)
+	return nil
+}
+
+// remove queues a removal of the keys selected by fn, which runs with d.mu
+// held, and waits until it is committed
+func (d *Disk) remove(ctx context.Context, fn func() []string) (int, error) {
+	op := diskOp{remove: fn, done: make(chan diskResult, 1)}
+	if err := d.enqueue(ctx, op); err != nil {
+		return 0, err
+	}
+
+	select {
+	case result := <-op.done:
+		return result.removed, result.err
+	case <-d.done:
+		// The writer commits everything queued before it exits
+		select {
+		case result := <-op.done:
+			return result.removed, result.err
+		default:
+			return 0, errDiskClosed
+		}
+	}
+}
+
+// flush waits until every write queued so far is committed
+func (d *Disk) flush() error {
+	_, err := d.remove(context.Background(), func() []string { return nil })
+	return err
+}
+
+// run is the writer. It commits queued writes in batches and sweeps expired
+// entries every interval until Close, then commits what is left.
+func (d *Disk) run(interval time.Duration) {
+	defer close(d.done)
+
+	var tick <-chan time.Time
+	if interval > 0 {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+
+	for {
+		select {
+		case op := <-d.queue:
+			d.apply(d.drain(op))
+		case <-tick:
+			d.apply([]diskOp{{remove: d.expired}})
+		case <-d.stop:
+			for {
+				select {
+				case op := <-d.queue:
+					d.apply(d.drain(op))
+				default:
+					return
+				}
+			}
+		}
+	}
+}
+
+// drain returns op followed by the writes queued behind it, up to
+// diskMaxBatch
+func (d *Disk) drain(op diskOp) []diskOp {
+	ops := []diskOp{op}
+	for len(ops) < diskMaxBatch {
+		select {
+		case next := <-d.queue:
+			ops = append(ops, next)
+		default:
+			return ops
+		}
+	}
+	return ops
+}
+
+// apply updates the index for ops in order and commits them in one
+// transaction. If the commit fails the file is unchanged, so every key the
+// batch touched gets its previous index entry back.
+func (d *Disk) apply(ops []diskOp) {
+	removed := make([]int, len(ops))
+	var writes []diskWrite
+	previous := make(map[string]*diskMeta)
+	var touched []string
+	save := func(key string) {
+		if _, ok := previous[key]; ok {
+			return
+		}
+		var meta *diskMeta
+		if elem, ok := d.items[key]; ok {
+			m := elem.Value.(*diskItem).meta
+			meta = &m
+		}
+		previous[key] = meta
+		touched = append(touched, key)
+	}
+
+	d.mu.Lock()
+	for i, op := range ops {
+		if op.remove != nil {
+			keys := op.remove()
+			for _, key := range keys {
+				save(key)
+				d.removeItem(key)
+				writes = append(writes, diskWrite{key: key})
+			}
+			removed[i] = len(keys)
+			continue
+		}
+
+		for _, victim := range d.victims(op.key, op.meta.Size) {
+			save(victim)
+			d.removeItem(victim)
+			d.metrics.OnEviction(d.Name())
+			writes = append(writes, diskWrite{key: victim})
+		}
+		save(op.key)
+		d.removeItem(op.key)
+		d.addItem(op.key, op.meta)
+		writes = append(writes, diskWrite{key: op.key, data: op.data, meta: op.metaData})
+	}
+	d.mu.Unlock()
+
+	start := time.Now()
+	err := d.db.Update(func(tx *bolt.Tx) error {
+		entries := tx.Bucket(diskEntriesBucket)
+		meta := tx.Bucket(diskMetaBucket)
+		for _, w := range writes {
+			if w.data == nil {
+				if err := deleteDiskKeys(tx, []string{w.key}); err != nil {
+					return err
+				}
+				continue
+			}
+			if err := entries.Put([]byte(w.key), w.data); err != nil {
+				return err
+			}
+			if err := meta.Put([]byte(w.key), w.meta); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	d.metrics.OnOperation(d.Name(), "commit", time.Since(start), err)
+
+	d.mu.Lock()
+	if err != nil {
+		// Restored entries count as recently used
+		for _, key := range touched {
+			d.removeItem(key)
+			if meta := previous[key]; meta != nil {
+				d.addItem(key, *meta)
+			}
+		}
+	}
+	d.metrics.SetSize(d.Name(), len(d.items), d.bytes)
+	d.mu.Unlock()
+
+	for i, op := range ops {
+		if op.done != nil {
+			op.done <- diskResult{removed: removed[i], err: err}
+		}
+	}
+}
+
+// victims returns the least recently used keys to evict so that an entry of
+// size bytes stored under key fits within maxBytes
+func (d *Disk) victims(key string, size int64) []string {
+	if d.maxBytes <= 0 {
+		return nil
+	}
+
+	total := d.bytes + size
+	if elem, ok := d.items[key]; ok {
+		total -= elem.Value.(*diskItem).meta.Size
+	}
+
+	var victims []string
+	for elem := d.lru.Back(); elem != nil && total > d.maxBytes; elem = elem.Prev() {
+		item := elem.Value.(*diskItem)
+		if item.key == key {
+			continue
+		}
+		victims = append(victims, item.key)
+		total -= item.meta.Size
+	}
+	return victims
+}
+
+// deleteDiskKeys removes keys from both buckets
+func deleteDiskKeys(tx *bolt.Tx, keys []string) error {
+	entries := tx.Bucket(diskEntriesBucket)
+	meta := tx.Bucket(diskMetaBucket)
+	for _, key := range keys {
+		if err := entries.Delete([]byte(key)); err != nil {
+			return err
+		}
+		if err := meta.Delete([]byte(key)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (d *Disk) addItem(key string, meta diskMeta) {
+	d.items[key] = d.lru.PushFront(&diskItem{key: key, meta: meta})
+	d.bytes += meta.Size
+	for _, tag := range meta.Tags {
+		keys, ok := d.tagged[tag]
+		if !ok {
+			keys = make(map[string]struct{})
+			d.tagged[tag] = keys
+		}
+		keys[key] = struct{}{}
+	}
+}
+
+func (d *Disk) removeItem(key string) {
+	elem, ok := d.items[key]
+	if !ok {
+		return
+	}
+	item := d.lru.Remove(elem).(*diskItem)
+	delete(d.items, key)
+	d.bytes -= item.meta.Size
+	for _, tag := range item.meta.Tags {
+		delete(d.tagged[tag], key)
+		if len(d.tagged[tag]) == 0 {
+			delete(d.tagged, tag)
+		}
+	}
+}
@@ -0,0 +1,60 @@
+package cache
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"net/url"
+	"strings"
+)
+
+// keyPrefix namespaces and versions cache keys
+const keyPrefix = "nft:v1"
+
+// ignoredParams are query parameters that never reach Alchemy's response
+// (auth tokens consumed by nginx, the projection applied by the proxy) and
+// must not fragment the cache
+var ignoredParams = map[string]bool{
+	"token":        true,
+	"jwt":          true,
+	"access_token": true,
+	"fields":       true,
+}
+
+// Key builds the cache key for a proxied request. chain must be the canonical
+// chain name so that aliases share entries. Query parameters are sorted so
+// that equivalent requests map to the same key.
+func Key(chain, endpoint, method, path, rawQuery string, body []byte) string {
+	h := sha256.New()
+	h.Write([]byte(method))
+	h.Write([]byte{'\n'})
+	h.Write([]byte(path))
+	h.Write([]byte{'\n'})
+	h.Write([]byte(CanonicalQuery(rawQuery)))
+	h.Write([]byte{'\n'})
+	h.Write(body)
+	sum := h.Sum(nil)
+
+	return strings.Join([]string{keyPrefix, chain, endpoint, hex.EncodeToString(sum[:16])}, ":")
+}
+
+// KeyEndpoint returns the endpoint segment of a key built by Key
+func KeyEndpoint(key string) string {
+	parts := strings.Split(key, ":")
+	if len(parts) != 5 {
+		return ""
+	}
+	return parts[3]
+}
+
+// CanonicalQuery sorts query parameters and drops ignored ones. A request
+// replayed with its canonical query maps to the same key.
+func CanonicalQuery(rawQuery string) string {
+	values, err := url.ParseQuery(rawQuery)
+	if err != nil {
+		return rawQuery
+	}
+	for param := range ignoredParams {
+		values.Del(param)
+	}
+	return values.Encode()
+}
@@ -0,0 +1,205 @@
+package cache
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// tagIndexPrefix namespaces the KeyDB sets indexing keys by tag
+const tagIndexPrefix = keyPrefix + ":tag:"
+
+// purgeBatchSize bounds the keys scanned or deleted per round trip in purges
+const purgeBatchSize = 500
+
+// tagScript adds a key to a tag index and extends the index's TTL to at least
+// ARGV[2] milliseconds. It stands in for EXPIRE NX/GT, which KeyDB's Redis 6
+// protocol does not support. A PTTL of -1 (no expiry) is replaced as well.
+var tagScript = redis.NewScript(`
+redis.call('SADD', KEYS[1], ARGV[1])
+local ttl = tonumber(ARGV[2])
+if redis.call('PTTL', KEYS[1]) < ttl then
+  redis.call('PEXPIRE', KEYS[1], ttl)
+end
+return 1
+`)
+
+// KeyDB is a cache tier backed by KeyDB or Redis, shared between proxy
+// instances. Entries are stored as JSON and expire with their TTL. Each tag
+// is a set of keys that lives as long as its longest-lived entry; members
+// whose entry expired are left behind until the set expires or is purged.
+type KeyDB struct {
+	client redis.UniversalClient
+}
+
+// NewKeyDB creates a tier over an existing client. The client's timeouts
+// bound how long a slow KeyDB can delay a request.
+func NewKeyDB(client redis.UniversalClient) *KeyDB {
+	return &KeyDB{client: client}
+}
+
+// Name implements Tier
+func (k *KeyDB) Name() string {
+	return "l2"
+}
+
+// Get implements Tier
+func (k *KeyDB) Get(ctx context.Context, key string) (*Entry, error) {
+	data, err := k.client.Get(ctx, key).Bytes()
+	if errors.Is(err, redis.Nil) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var entry Entry
+	if err := json.Unmarshal(data, &entry); err != nil {
+		return nil, fmt.Errorf("failed to decode cache entry: %w", err)
+	}
+	return &entry, nil
+}
+
+// Set implements Tier
+func (k *KeyDB) Set(ctx context.Context, key string, entry *Entry) error {
+	ttl := time.Until(entry.ExpiresAt)
+	if ttl <= 0 {
+		return nil
+	}
+
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return fmt.Errorf("failed to encode cache entry: %w", err)
+	}
+	if len(entry.Tags) == 0 {
+		return k.client.Set(ctx, key, data, ttl).Err()
+	}
+
+	_, err = k.client.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.Set(ctx, key, data, ttl)
+		for _, tag := range entry.Tags {
+			// EVAL rather than EVALSHA, which cannot fall back to loading
+			// the script inside a pipeline
+			tagScript.Eval(ctx, pipe, []string{tagIndexPrefix + tag}, key, ttl.Milliseconds())
+		}
+		return nil
+	})
+	return err
+}
+
+// Delete implements Tier
+func (k *KeyDB) Delete(ctx context.Context, key string) error {
+	return k.client.Del(ctx, key).Err()
+}
+
+// PurgeTag implements Purger
+func (k *KeyDB) PurgeTag(ctx context.Context, tag string, match func(key string) bool) (int, error) {
+	index := tagIndexPrefix + tag
+	keys, err := k.client.SMembers(ctx, index).Result()
+	if err != nil {
+		return 0, err
+	}
+	if match != nil {
+		keys = slices.DeleteFunc(keys, func(key string) bool { return !match(key) })
+	}
+
+	purged, err := k.deleteKeys(ctx, keys)
+	if err != nil {
+		return purged, err
+	}
+	if match == nil {
+		return purged, k.client.Del(ctx, index).Err()
+	}
+	if len(keys) == 0 {
+		return purged, nil
+	}
+	return purged, k.client.SRem(ctx, index, keys).Err()
+}
+
+// PurgePrefix implements Purger. It scans the keyspace, so it is meant for
+// rare administrative purges only.
+func (k *KeyDB) PurgePrefix(ctx context.Context, prefix string) (int, error) {
+	purged := 0
+	iter := k.client.Scan(ctx, 0, escapePattern(prefix)+"*", purgeBatchSize).Iterator()
+	batch := make([]string, 0, purgeBatchSize)
+	for iter.Next(ctx) {
+		batch = append(batch, iter.Val())
+		if len(batch) == purgeBatchSize {
+			n, err := k.deleteKeys(ctx, batch)
+			purged += n
+			if err != nil {
+				return purged, err
+			}
+			batch = batch[:0]
+		}
+	}
+	if err := iter.Err(); err != nil {
+		return purged, err
+	}
+
+	n, err := k.deleteKeys(ctx, batch)
+	return purged + n, err
+}
+
+// Range implements Ranger. It scans the keyspace for cache entries, skipping
+// the tag indexes.
+func (k *KeyDB) Range(ctx context.Context, fn func(key string, entry *Entry) error) error {
+	iter := k.client.Scan(ctx, 0, escapePattern(keyPrefix+":")+"*", purgeBatchSize).Iterator()
+	for iter.Next(ctx) {
+		key := iter.Val()
+		if strings.HasPrefix(key, tagIndexPrefix) {
+			continue
+		}
+		entry, err := k.Get(ctx, key)
+		if err != nil {
+			return err
+		}
+		// The key may have expired since it was scanned
+		if entry == nil {
+			continue
+		}
+		if err := fn(key, entry); err != nil {
+			return err
+		}
+	}
+	return iter.Err()
+}
+
+// deleteKeys deletes keys in pipelined batches of single-key DELs, which keeps
+// working when keys hash to different cluster slots, and returns how many
+// existed
+func (k *KeyDB) deleteKeys(ctx context.Context, keys []string) (int, error) {
+	purged := 0
+	for len(keys) > 0 {
+		n := min(len(keys), purgeBatchSize)
+		cmds, err := k.client.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+			for _, key := range keys[:n] {
+				pipe.Del(ctx, key)
+			}
+			return nil
+		})
+		for _, cmd := range cmds {
+			if del, ok := cmd.(*redis.IntCmd); ok {
+				purged += int(del.Val())
+			}
+		}
+		if err != nil {
+			return purged, err
+		}
+		keys = keys[n:]
+	}
+	return purged, nil
+}
+
+// escapePattern escapes the glob characters of a SCAN MATCH pattern
+func escapePattern(s string) string {
+	return globReplacer.Replace(s)
+}
+
+var globReplacer = strings.NewReplacer(`\`, `\\`, "*", `\*`, "?", `\?`, "[", `\[`, "]", `\]`)
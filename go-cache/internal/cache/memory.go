@@ -0,0 +1,209 @@
+package cache
+
+import (
+	"container/list"
+	"context"
+	"strings"
+	"sync"
+
+	"nft-proxy/internal/metrics"
+)
+
+// Memory is an in-process LRU cache tier bounded by entry count and total
+// body size. It indexes entries by tag for purges.
+type Memory struct {
+	maxEntries int
+	maxBytes   int64
+	metrics    *metrics.CacheMetrics
+
+	mu    sync.Mutex
+	items map[string]*list.Element
+	lru   *list.List
+	bytes int64
+	// tagged maps every tag to the keys of the entries carrying it
+	tagged map[string]map[string]struct{}
+}
+
+type memoryItem struct {
+	key   string
+	entry *Entry
+}
+
+// NewMemory creates an in-memory tier. A zero limit means unbounded.
+func NewMemory(maxEntries int, maxBytes int64) *Memory {
+	return &Memory{
+		maxEntries: maxEntries,
+		maxBytes:   maxBytes,
+		metrics:    metrics.NewCacheMetrics(),
+		items:      make(map[string]*list.Element),
+		lru:        list.New(),
+		tagged:     make(map[string]map[string]struct{}),
+	}
+}
+
+// Name implements Tier
+func (m *Memory) Name() string {
+	return "l1"
+}
+
+// Get implements Tier
+func (m *Memory) Get(_ context.Context, key string) (*Entry, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	elem, ok := m.items[key]
+	if !ok {
+		return nil, nil
+	}
+	m.lru.MoveToFront(elem)
+	return elem.Value.(*memoryItem).entry, nil
+}
+
+// Set implements Tier
+func (m *Memory) Set(_ context.Context, key string, entry *Entry) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.maxBytes > 0 && entry.Size() > m.maxBytes {
+		// Never let a single entry flush the whole cache
+		return nil
+	}
+
+	if elem, ok := m.items[key]; ok {
+		item := elem.Value.(*memoryItem)
+		m.untag(key, item.entry.Tags)
+		m.bytes += entry.Size() - item.entry.Size()
+		item.entry = entry
+		m.lru.MoveToFront(elem)
+	} else {
+		m.items[key] = m.lru.PushFront(&memoryItem{key: key, entry: entry})
+		m.bytes += entry.Size()
+	}
+	m.tag(key, entry.Tags)
+
+	for m.overLimit() {
+		m.removeElement(m.lru.Back())
+		m.metrics.OnEviction(m.Name())
+	}
+	m.metrics.SetSize(m.Name(), len(m.items), m.bytes)
+	return nil
+}
+
+// Delete implements Tier
+func (m *Memory) Delete(_ context.Context, key string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if elem, ok := m.items[key]; ok {
+		m.removeElement(elem)
+		m.metrics.SetSize(m.Name(), len(m.items), m.bytes)
+	}
+	return nil
+}
+
+// PurgeTag implements Purger
+func (m *Memory) PurgeTag(_ context.Context, tag string, match func(key string) bool) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	purged := 0
+	for key := range m.tagged[tag] {
+		if match != nil && !match(key) {
+			continue
+		}
+		if elem, ok := m.items[key]; ok {
+			m.removeElement(elem)
+			purged++
+		}
+	}
+	m.metrics.SetSize(m.Name(), len(m.items), m.bytes)
+	return purged, nil
+}
+
+// PurgePrefix implements Purger
+func (m *Memory) PurgePrefix(_ context.Context, prefix string) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	purged := 0
+	for key, elem := range m.items {
+		if strings.HasPrefix(key, prefix) {
+			m.removeElement(elem)
+			purged++
+		}
+	}
+	m.metrics.SetSize(m.Name(), len(m.items), m.bytes)
+	return purged, nil
+}
+
+// Range implements Ranger. It lists a copy of the index, so fn may use the
+// tier.
+func (m *Memory) Range(ctx context.Context, fn func(key string, entry *Entry) error) error {
+	m.mu.Lock()
+	items := make([]memoryItem, 0, len(m.items))
+	for elem := m.lru.Front(); elem != nil; elem = elem.Next() {
+		items = append(items, *elem.Value.(*memoryItem))
+	}
+	m.mu.Unlock()
+
+	for _, item := range items {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if err := fn(item.key, item.entry); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Len returns the number of entries held
+func (m *Memory) Len() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return len(m.items)
+}
+
+// Bytes returns the total body size of the entries held
+func (m *Memory) Bytes() int64 {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.bytes
+}
+
+func (m *Memory) overLimit() bool {
+	if m.lru.Len() == 0 {
+		return false
+	}
+	if m.maxEntries > 0 && m.lru.Len() > m.maxEntries {
+		return true
+	}
+	return m.maxBytes > 0 && m.bytes > m.maxBytes
+}
+
+func (m *Memory) removeElement(elem *list.Element) {
+	item := m.lru.Remove(elem).(*memoryItem)
+	delete(m.items, item.key)
+	m.untag(item.key, item.entry.Tags)
+	m.bytes -= item.entry.Size()
+}
+
+func (m *Memory) tag(key string, tags []string) {
+	for _, tag := range tags {
+		keys, ok := m.tagged[tag]
+		if !ok {
+			keys = make(map[string]struct{})
+			m.tagged[tag] = keys
+		}
+		keys[key] = struct{}{}
+	}
+}
+
+func (m *Memory) untag(key string, tags []string) {
+	for _, tag := range tags {
+		delete(m.tagged[tag], key)
+		if len(m.tagged[tag]) == 0 {
+			delete(m.tagged, tag)
+		}
+	}
+}
@@ -0,0 +1,93 @@
+package cache
+
+import (
+	"encoding/json"
+	"net/url"
+	"strings"
+)
+
+// Tag prefixes of the secondary indexes kept for purges
+const (
+	contractTagPrefix = "contract:"
+	ownerTagPrefix    = "owner:"
+)
+
+// taggedParams maps the request parameters that name a contract or owner to
+// the tag prefix they index under. Array parameters such as
+// contractAddresses[] are matched without their brackets.
+var taggedParams = map[string]string{
+	"contractAddress":   contractTagPrefix,
+	"contractAddresses": contractTagPrefix,
+	"owner":             ownerTagPrefix,
+}
+
+// ContractTag returns the tag of entries requested for a contract address
+func ContractTag(address string) string {
+	return contractTagPrefix + strings.ToLower(address)
+}
+
+// OwnerTag returns the tag of entries requested for an owner address
+func OwnerTag(address string) string {
+	return ownerTagPrefix + strings.ToLower(address)
+}
+
+// Tags returns the contract and owner tags of a proxied request, taken from
+// its query parameters and, for POST requests, its JSON body. Only addresses
+// named by the request are indexed, not ones that appear in the response.
+func Tags(rawQuery string, body []byte) []string {
+	seen := make(map[string]bool)
+	var tags []string
+	addTag := func(prefix, address string) {
+		tag := prefix + strings.ToLower(address)
+		if address != "" && !seen[tag] {
+			seen[tag] = true
+			tags = append(tags, tag)
+		}
+	}
+	add := func(param string, value any) {
+		prefix, ok := taggedParams[strings.TrimSuffix(param, "[]")]
+		if !ok {
+			return
+		}
+		switch v := value.(type) {
+		case string:
+			addTag(prefix, v)
+		case []any:
+			for _, item := range v {
+				if address, ok := item.(string); ok {
+					addTag(prefix, address)
+				}
+			}
+		}
+	}
+
+	// ParseQuery skips malformed pairs but still returns the others, which
+	// keep the entry purgeable by the addresses it does name
+	values, _ := url.ParseQuery(rawQuery)
+	for param, list := range values {
+		for _, value := range list {
+			add(param, value)
+		}
+	}
+
+	var decoded any
+	if len(body) > 0 && json.Unmarshal(body, &decoded) == nil {
+		walkJSON(decoded, add)
+	}
+	return tags
+}
+
+// walkJSON calls visit for every object member in a decoded JSON value
+func walkJSON(value any, visit func(name string, value any)) {
+	switch v := value.(type) {
+	case map[string]any:
+		for name, member := range v {
+			visit(name, member)
+			walkJSON(member, visit)
+		}
+	case []any:
+		for _, item := range v {
+			walkJSON(item, visit)
+		}
+	}
+}
@@ -19,22 +19,351 @@ type APIKeysFile struct {
 
 // AlchemyConfig represents Alchemy API configuration
 type AlchemyConfig struct {
-	APIKey   string                  `yaml:"api_key"`
-	BaseURLs map[string]string       `yaml:"base_urls"`
-	Retry    httpclient.RetryOptions `yaml:"retry"`
+	APIKey      string                  `yaml:"api_key"`
+	BaseURLs    map[string]string       `yaml:"base_urls"`
+	Retry       httpclient.RetryOptions `yaml:"retry"`
+	Concurrency ConcurrencyConfig       `yaml:"concurrency"`
+	RateLimit   RateLimitConfig         `yaml:"rate_limit"`
+	Breaker     BreakerConfig           `yaml:"breaker"`
+	// ComputeUnits is the compute-unit cost table for NFT API endpoints
+	ComputeUnits ComputeUnitsConfig `yaml:"compute_units"`
+}
+
+// ConcurrencyConfig represents the limit on concurrent upstream calls
+type ConcurrencyConfig struct {
+	Enabled bool `yaml:"enabled"`
+	// Adaptive lets the limit float between MinLimit and MaxLimit based on observed latency
+	Adaptive     bool `yaml:"adaptive"`
+	InitialLimit int  `yaml:"initial_limit"`
+	MinLimit     int  `yaml:"min_limit"`
+	MaxLimit     int  `yaml:"max_limit"`
+	// MaxQueue bounds the requests waiting for a slot; 0 rejects them right
+	// away. Unset means the default of 100.
+	MaxQueue     *int          `yaml:"max_queue"`
+	QueueTimeout time.Duration `yaml:"queue_timeout"`
+	RetryAfter   time.Duration `yaml:"retry_after"`
+}
+
+// RateLimitConfig represents client-side pacing of Alchemy compute units per API key
+type RateLimitConfig struct {
+	Enabled bool `yaml:"enabled"`
+	// ComputeUnitsPerSecond is the plan's CUPS limit for a single API key
+	ComputeUnitsPerSecond int `yaml:"compute_units_per_second"`
+	Burst                 int `yaml:"burst"`
+	// MaxWait is how long a request may wait for budget before it is rejected
+	MaxWait time.Duration `yaml:"max_wait"`
+}
+
+// BreakerConfig represents per-chain circuit breakers and API key quarantine
+type BreakerConfig struct {
+	Enabled bool `yaml:"enabled"`
+	// Failures is how many consecutive failed calls to a chain open its breaker
+	Failures int `yaml:"failures"`
+	// Cooldown is how long an open breaker or a quarantined key rejects calls
+	Cooldown time.Duration `yaml:"cooldown"`
+}
+
+// ComputeUnitsConfig maps NFT API endpoint names to their compute-unit cost
+type ComputeUnitsConfig struct {
+	Default   int            `yaml:"default"`
+	Endpoints map[string]int `yaml:"endpoints"`
+}
+
+// Cost returns the compute-unit cost of an endpoint, falling back to Default
+func (c ComputeUnitsConfig) Cost(endpoint string) int {
+	if cost, ok := c.Endpoints[endpoint]; ok {
+		return cost
+	}
+	return c.Default
 }
 
 // ServerConfig represents HTTP server configuration
 type ServerConfig struct {
-	Port         string        `yaml:"port"`
-	ReadTimeout  time.Duration `yaml:"read_timeout"`
-	WriteTimeout time.Duration `yaml:"write_timeout"`
+	Port         string           `yaml:"port"`
+	ReadTimeout  time.Duration    `yaml:"read_timeout"`
+	WriteTimeout time.Duration    `yaml:"write_timeout"`
+	AccessLog    AccessLogConfig  `yaml:"access_log"`
+	Projection   ProjectionConfig `yaml:"projection"`
+}
+
+// ProjectionConfig represents response projection with the fields= parameter
+type ProjectionConfig struct {
+	// Presets name lists of dotted field paths that clients can select with
+	// fields=@name
+	Presets map[string][]string `yaml:"presets"`
+}
+
+// AccessLogConfig represents per-request access logging
+type AccessLogConfig struct {
+	Enabled bool `yaml:"enabled"`
+	// SampleRate is the fraction of successful requests logged; failed
+	// requests are always logged
+	SampleRate float64 `yaml:"sample_rate"`
+}
+
+// CacheConfig represents response cache configuration
+type CacheConfig struct {
+	Enabled bool `yaml:"enabled"`
+	// DefaultTTL applies to endpoints without a rule
+	DefaultTTL time.Duration `yaml:"default_ttl"`
+	// NegativeTTL maps deterministic upstream error statuses, such as 400
+	// and 404, to how long those responses are cached. Transient statuses
+	// (429, 5xx) and auth failures are rejected.
+	NegativeTTL map[int]time.Duration      `yaml:"negative_ttl"`
+	Rules       map[string]CacheRuleConfig `yaml:"rules"`
+	// MaxEntryBytes is the largest response body that is cached; larger
+	// responses are streamed through without being buffered
+	MaxEntryBytes int64             `yaml:"max_entry_bytes"`
+	L1            MemoryCacheConfig `yaml:"l1"`
+	Disk          DiskCacheConfig   `yaml:"disk"`
+	L2            KeyDBCacheConfig  `yaml:"l2"`
+}
+
+// CacheRuleConfig represents caching behaviour for a single endpoint
+type CacheRuleConfig struct {
+	TTL time.Duration `yaml:"ttl"`
+	// NegativeTTL overrides CacheConfig.NegativeTTL per status
+	NegativeTTL map[int]time.Duration `yaml:"negative_ttl"`
+}
+
+// MemoryCacheConfig represents the in-memory (L1) cache tier
+type MemoryCacheConfig struct {
+	MaxEntries int   `yaml:"max_entries"`
+	MaxBytes   int64 `yaml:"max_bytes"`
+}
+
+// DiskCacheConfig represents the embedded on-disk cache tier, consulted
+// between L1 and L2
+type DiskCacheConfig struct {
+	// Path of the bbolt file, e.g. /app/data/cache.db; empty disables the tier
+	Path     string `yaml:"path"`
+	MaxBytes int64  `yaml:"max_bytes"`
+	// SweepInterval is how often expired entries are removed
+	SweepInterval time.Duration `yaml:"sweep_interval"`
+}
+
+// KeyDBCacheConfig represents the shared KeyDB/Redis (L2) cache tier
+type KeyDBCacheConfig struct {
+	// URL such as redis://keydb:6379; empty disables the tier
+	URL string `yaml:"url"`
+	// Timeout bounds every KeyDB operation so a slow L2 degrades to a miss
+	Timeout time.Duration `yaml:"timeout"`
+}
+
+// BudgetConfig represents compute-unit budget configuration
+type BudgetConfig struct {
+	Enabled bool `yaml:"enabled"`
+	// StateFile persists usage across restarts
+	StateFile     string        `yaml:"state_file"`
+	FlushInterval time.Duration `yaml:"flush_interval"`
+	Daily         BudgetLimits  `yaml:"daily"`
+	Monthly       BudgetLimits  `yaml:"monthly"`
+}
+
+// BudgetLimits represents the soft and hard budgets of one period (0 disables)
+type BudgetLimits struct {
+	Soft int64 `yaml:"soft"`
+	Hard int64 `yaml:"hard"`
+}
+
+// TracingConfig represents OpenTelemetry tracing configuration
+type TracingConfig struct {
+	Enabled bool `yaml:"enabled"`
+	// Endpoint is the OTLP/HTTP collector URL, e.g. http://otel-collector:4318.
+	// When empty the standard OTEL_EXPORTER_OTLP_* variables apply.
+	Endpoint    string `yaml:"endpoint"`
+	ServiceName string `yaml:"service_name"`
+	// SampleRatio is the fraction of new traces recorded; requests arriving
+	// with a sampled traceparent are always recorded
+	SampleRatio float64 `yaml:"sample_ratio"`
+}
+
+// Listeners the metrics and admin endpoints can be served on
+const (
+	// MetricsListenerPort is the dedicated metrics server on METRICS_PORT
+	MetricsListenerPort = "port"
+	// MetricsListenerSocket is the proxy's Unix socket, reachable through nginx
+	MetricsListenerSocket = "socket"
+)
+
+// MetricsConfig represents where /metrics and /admin are served
+type MetricsConfig struct {
+	// Listeners lists MetricsListenerPort and/or MetricsListenerSocket
+	Listeners []string `yaml:"listeners"`
+	// BearerToken, if set, must be sent as "Authorization: Bearer <token>"
+	// on /metrics and /admin requests
+	BearerToken string `yaml:"bearer_token"`
+}
+
+// On reports whether metrics are served on the given listener
+func (c MetricsConfig) On(listener string) bool {
+	for _, l := range c.Listeners {
+		if l == listener {
+			return true
+		}
+	}
+	return false
+}
+
+// WarmupConfig represents cache warming at startup and of hot keys
+type WarmupConfig struct {
+	Enabled bool `yaml:"enabled"`
+	// Concurrency bounds warmup requests in flight
+	Concurrency int `yaml:"concurrency"`
+	// Seeds maps chain keys such as eth-mainnet to addresses to prefetch
+	Seeds map[string]WarmupSeedConfig `yaml:"seeds"`
+	// ContractRequests and OwnerRequests are request templates in which
+	// {address} is replaced by each seed address
+	ContractRequests []string      `yaml:"contract_requests"`
+	OwnerRequests    []string      `yaml:"owner_requests"`
+	HotKeys          HotKeysConfig `yaml:"hot_keys"`
+}
+
+// WarmupSeedConfig lists the addresses of one chain to prefetch
+type WarmupSeedConfig struct {
+	Contracts []string `yaml:"contracts"`
+	Owners    []string `yaml:"owners"`
+}
+
+// HotKeysConfig represents the refresh of the most requested cache keys
+type HotKeysConfig struct {
+	Enabled bool `yaml:"enabled"`
+	// TopN keys are refreshed every Interval if they expire within
+	// RefreshBefore; Capacity bounds the keys counted
+	TopN          int           `yaml:"top_n"`
+	Capacity      int           `yaml:"capacity"`
+	Interval      time.Duration `yaml:"interval"`
+	RefreshBefore time.Duration `yaml:"refresh_before"`
+}
+
+// WebhookConfig represents the Alchemy Notify webhook endpoint
+type WebhookConfig struct {
+	// SigningKeys verify X-Alchemy-Signature; every Alchemy webhook has its
+	// own key. The endpoint is disabled when no key is set.
+	SigningKeys []string `yaml:"signing_keys"`
+}
+
+// ReadinessConfig represents the /ready checks
+type ReadinessConfig struct {
+	// Timeout bounds a whole readiness check
+	Timeout time.Duration `yaml:"timeout"`
+	Probe   ProbeConfig   `yaml:"probe"`
+}
+
+// ProbeConfig represents the synthetic Alchemy request sent per chain.
+// Results are cached between rounds, so /ready never waits on Alchemy.
+type ProbeConfig struct {
+	Enabled  bool          `yaml:"enabled"`
+	Interval time.Duration `yaml:"interval"`
+	Timeout  time.Duration `yaml:"timeout"`
+	Path     string        `yaml:"path"`
+	Query    string        `yaml:"query"`
 }
 
 // Config represents the main configuration structure
 type Config struct {
-	Alchemy AlchemyConfig `yaml:"alchemy"`
-	Server  ServerConfig  `yaml:"server"`
+	Alchemy         AlchemyConfig         `yaml:"alchemy"`
+	Server          ServerConfig          `yaml:"server"`
+	Cache           CacheConfig           `yaml:"cache"`
+	Budget          BudgetConfig          `yaml:"budget"`
+	Metrics         MetricsConfig         `yaml:"metrics"`
+	Tracing         TracingConfig         `yaml:"tracing"`
+	Readiness       ReadinessConfig       `yaml:"readiness"`
+	Webhook         WebhookConfig         `yaml:"webhook"`
+	Warmup          WarmupConfig          `yaml:"warmup"`
+	Spam            SpamConfig            `yaml:"spam"`
+	Tenants         TenantsConfig         `yaml:"tenants"`
+	ClientRateLimit ClientRateLimitConfig `yaml:"client_rate_limit"`
+	JWTAuth         JWTAuthConfig         `yaml:"jwt_auth"`
+	SignedURLs      SignedURLsConfig      `yaml:"signed_urls"`
+}
+
+// SpamConfig represents the spam collection filter
+type SpamConfig struct {
+	Enabled bool `yaml:"enabled"`
+	// Mode is "flag" to annotate spam items with a reason or "drop" to
+	// remove them from lists
+	Mode string `yaml:"mode"`
+	// ListsFile holds the deny and allow lists and is reloaded when it
+	// changes
+	ListsFile      string        `yaml:"lists_file"`
+	ReloadInterval time.Duration `yaml:"reload_interval"`
+	// Heuristics flags collections by URLs in their name or description
+	Heuristics bool `yaml:"heuristics"`
+}
+
+// TenantsConfig represents per-client policies, keyed on the identity nginx
+// forwards in X-Client-Identity
+type TenantsConfig struct {
+	Enabled bool `yaml:"enabled"`
+	// Default names the policy of unknown identities; empty rejects them
+	// with 403
+	Default  string               `yaml:"default"`
+	Policies []TenantPolicyConfig `yaml:"policies"`
+}
+
+// TenantPolicyConfig represents the policy of one tenant
+type TenantPolicyConfig struct {
+	Name string `yaml:"name"`
+	// Identities are "basic:<user>" for Basic Auth users and
+	// "jwt:<subject>" for JWT callers
+	Identities []string `yaml:"identities"`
+	// Chains and Endpoints restrict access, e.g. "eth-mainnet" and
+	// "getNFTsForOwner"; empty allows all
+	Chains    []string              `yaml:"chains"`
+	Endpoints []string              `yaml:"endpoints"`
+	RateLimit TenantRateLimitConfig `yaml:"rate_limit"`
+	// DailyComputeUnits caps the tenant's cache misses per UTC day; zero
+	// disables it
+	DailyComputeUnits int64 `yaml:"daily_compute_units"`
+	// Priority queues the tenant's upstream calls ahead of lower ones
+	Priority int `yaml:"priority"`
+}
+
+// TenantRateLimitConfig represents a tenant's request rate; zero disables it
+type TenantRateLimitConfig struct {
+	RequestsPerSecond float64 `yaml:"requests_per_second"`
+	Burst             int     `yaml:"burst"`
+}
+
+// ClientRateLimitConfig represents the per-client request rate limit, keyed
+// on the identity nginx forwards or the client's X-Real-IP
+type ClientRateLimitConfig struct {
+	Enabled bool `yaml:"enabled"`
+	// Requests per Period is the sustained rate of each client
+	Requests int           `yaml:"requests"`
+	Period   time.Duration `yaml:"period"`
+	// Burst defaults to Requests
+	Burst int `yaml:"burst"`
+	// HitCost is the share of a request charged for a cache hit, in (0, 1]
+	HitCost float64 `yaml:"hit_cost"`
+	// Store is "memory" for a limit per instance or "keydb" to share it
+	// through the cache's L2 KeyDB
+	Store string `yaml:"store"`
+}
+
+// JWTAuthConfig represents puzzle JWT validation in nft-proxy, as an
+// alternative to the nginx auth_request hop
+type JWTAuthConfig struct {
+	Enabled bool `yaml:"enabled"`
+	// AuthConfigFile is the auth service's auth_config.json, which holds
+	// jwt_secret and requests_per_token
+	AuthConfigFile string `yaml:"auth_config_file"`
+	// Store is "memory" to count token requests per instance or "keydb" to
+	// share the counts through the cache's L2 KeyDB
+	Store string `yaml:"store"`
+	// ListenAddr, such as ":8080", serves clients directly over TCP without
+	// nginx; empty serves only the Unix socket
+	ListenAddr string `yaml:"listen_addr"`
+}
+
+// SignedURLsConfig represents HMAC-signed, expiring request URLs
+type SignedURLsConfig struct {
+	// Keys sign new URLs with the first key and verify them with any, so a
+	// key can be rotated out. Signed URLs are disabled when no key is set.
+	Keys []string `yaml:"keys"`
+	// MaxTTL bounds the lifetime of minted URLs
+	MaxTTL time.Duration `yaml:"max_ttl"`
 }
 
 // LoadConfig loads configuration from file path
@@ -56,6 +385,10 @@ func LoadConfig(configPath string, logger *zap.Logger) (*Config, error) {
 	config.applyDefaults()
 	config.expandEnvVars()
 
+	if err := config.validate(); err != nil {
+		return nil, err
+	}
+
 	return &config, nil
 }
 
@@ -71,6 +404,155 @@ func (c *Config) applyDefaults() {
 		c.Alchemy.Retry.LogPrefix = "Alchemy"
 	}
 
+	if c.Alchemy.Concurrency.InitialLimit == 0 {
+		c.Alchemy.Concurrency.InitialLimit = 20
+	}
+	if c.Alchemy.Concurrency.MinLimit == 0 {
+		c.Alchemy.Concurrency.MinLimit = 5
+	}
+	if c.Alchemy.Concurrency.MaxLimit == 0 {
+		c.Alchemy.Concurrency.MaxLimit = 200
+	}
+	if c.Alchemy.Concurrency.MaxQueue == nil {
+		maxQueue := 100
+		c.Alchemy.Concurrency.MaxQueue = &maxQueue
+	}
+	if c.Alchemy.Concurrency.QueueTimeout == 0 {
+		c.Alchemy.Concurrency.QueueTimeout = 2 * time.Second
+	}
+	if c.Alchemy.Concurrency.RetryAfter == 0 {
+		c.Alchemy.Concurrency.RetryAfter = time.Second
+	}
+
+	if c.Alchemy.RateLimit.ComputeUnitsPerSecond == 0 {
+		c.Alchemy.RateLimit.ComputeUnitsPerSecond = 330
+	}
+	if c.Alchemy.RateLimit.Burst == 0 {
+		c.Alchemy.RateLimit.Burst = c.Alchemy.RateLimit.ComputeUnitsPerSecond
+	}
+	if c.Alchemy.RateLimit.MaxWait == 0 {
+		c.Alchemy.RateLimit.MaxWait = 2 * time.Second
+	}
+	if c.Alchemy.Breaker.Failures == 0 {
+		c.Alchemy.Breaker.Failures = 5
+	}
+	if c.Alchemy.Breaker.Cooldown == 0 {
+		c.Alchemy.Breaker.Cooldown = 30 * time.Second
+	}
+	if c.Alchemy.ComputeUnits.Default == 0 {
+		c.Alchemy.ComputeUnits.Default = 100
+	}
+
+	if c.Cache.DefaultTTL == 0 {
+		c.Cache.DefaultTTL = 5 * time.Minute
+	}
+	if c.Cache.MaxEntryBytes == 0 {
+		c.Cache.MaxEntryBytes = 8 << 20
+	}
+	if c.Cache.L1.MaxEntries == 0 {
+		c.Cache.L1.MaxEntries = 10000
+	}
+	if c.Cache.L1.MaxBytes == 0 {
+		c.Cache.L1.MaxBytes = 256 << 20
+	}
+	if c.Cache.Disk.MaxBytes == 0 {
+		c.Cache.Disk.MaxBytes = 1 << 30
+	}
+	if c.Cache.Disk.SweepInterval == 0 {
+		c.Cache.Disk.SweepInterval = 10 * time.Minute
+	}
+	if c.Cache.L2.Timeout == 0 {
+		c.Cache.L2.Timeout = 200 * time.Millisecond
+	}
+
+	if c.Budget.StateFile == "" {
+		c.Budget.StateFile = "/app/data/compute_units.json"
+	}
+	if c.Budget.FlushInterval == 0 {
+		c.Budget.FlushInterval = 30 * time.Second
+	}
+
+	if c.Metrics.Listeners == nil {
+		c.Metrics.Listeners = []string{MetricsListenerPort, MetricsListenerSocket}
+	}
+
+	if c.Tracing.ServiceName == "" {
+		c.Tracing.ServiceName = "nft-proxy"
+	}
+	if c.Tracing.SampleRatio == 0 {
+		c.Tracing.SampleRatio = 1
+	}
+
+	if c.Warmup.Concurrency == 0 {
+		c.Warmup.Concurrency = 2
+	}
+	if c.Warmup.ContractRequests == nil {
+		c.Warmup.ContractRequests = []string{"/getContractMetadata?contractAddress={address}"}
+	}
+	if c.Warmup.OwnerRequests == nil {
+		c.Warmup.OwnerRequests = []string{"/getNFTsForOwner?owner={address}&withMetadata=true"}
+	}
+	if c.Warmup.HotKeys.TopN == 0 {
+		c.Warmup.HotKeys.TopN = 100
+	}
+	if c.Warmup.HotKeys.Capacity == 0 {
+		c.Warmup.HotKeys.Capacity = 10 * c.Warmup.HotKeys.TopN
+	}
+	if c.Warmup.HotKeys.Interval == 0 {
+		c.Warmup.HotKeys.Interval = time.Minute
+	}
+	if c.Warmup.HotKeys.RefreshBefore == 0 {
+		c.Warmup.HotKeys.RefreshBefore = 2 * c.Warmup.HotKeys.Interval
+	}
+
+	if c.Spam.Mode == "" {
+		c.Spam.Mode = "flag"
+	}
+	if c.Spam.ListsFile == "" {
+		c.Spam.ListsFile = "/app/spam_lists.yaml"
+	}
+	if c.Spam.ReloadInterval == 0 {
+		c.Spam.ReloadInterval = 30 * time.Second
+	}
+
+	if c.ClientRateLimit.Requests == 0 {
+		c.ClientRateLimit.Requests = 600
+	}
+	if c.ClientRateLimit.Period == 0 {
+		c.ClientRateLimit.Period = time.Minute
+	}
+	if c.ClientRateLimit.HitCost == 0 {
+		c.ClientRateLimit.HitCost = 1
+	}
+	if c.ClientRateLimit.Store == "" {
+		c.ClientRateLimit.Store = "memory"
+	}
+
+	if c.JWTAuth.AuthConfigFile == "" {
+		c.JWTAuth.AuthConfigFile = "/app/auth_config.json"
+	}
+	if c.JWTAuth.Store == "" {
+		c.JWTAuth.Store = "memory"
+	}
+
+	if c.SignedURLs.MaxTTL == 0 {
+		c.SignedURLs.MaxTTL = 30 * 24 * time.Hour
+	}
+
+	if c.Readiness.Timeout == 0 {
+		c.Readiness.Timeout = 2 * time.Second
+	}
+	if c.Readiness.Probe.Interval == 0 {
+		c.Readiness.Probe.Interval = time.Minute
+	}
+	if c.Readiness.Probe.Timeout == 0 {
+		c.Readiness.Probe.Timeout = 10 * time.Second
+	}
+	if c.Readiness.Probe.Path == "" {
+		c.Readiness.Probe.Path = "/getContractMetadata"
+		c.Readiness.Probe.Query = "contractAddress=0xBC4CA0EdA7647A8aB7C2061c2E118A18a936f13D"
+	}
+
 	if c.Server.Port == "" {
 		c.Server.Port = "8080"
 	}
@@ -80,11 +562,45 @@ func (c *Config) applyDefaults() {
 	if c.Server.WriteTimeout == 0 {
 		c.Server.WriteTimeout = 30 * time.Second
 	}
+	if c.Server.AccessLog.SampleRate == 0 {
+		c.Server.AccessLog.SampleRate = 1
+	}
 }
 
 // expandEnvVars expands environment variables in configuration
 func (c *Config) expandEnvVars() {
 	c.Alchemy.APIKey = os.ExpandEnv(c.Alchemy.APIKey)
+	c.Cache.Disk.Path = os.ExpandEnv(c.Cache.Disk.Path)
+	c.Cache.L2.URL = os.ExpandEnv(c.Cache.L2.URL)
+	c.Metrics.BearerToken = os.ExpandEnv(c.Metrics.BearerToken)
+	c.Tracing.Endpoint = os.ExpandEnv(c.Tracing.Endpoint)
+
+	// Keys whose variable is unset expand to "" and are dropped
+	var signingKeys []string
+	for _, key := range c.Webhook.SigningKeys {
+		if key = os.ExpandEnv(key); key != "" {
+			signingKeys = append(signingKeys, key)
+		}
+	}
+	c.Webhook.SigningKeys = signingKeys
+
+	var urlKeys []string
+	for _, key := range c.SignedURLs.Keys {
+		if key = os.ExpandEnv(key); key != "" {
+			urlKeys = append(urlKeys, key)
+		}
+	}
+	c.SignedURLs.Keys = urlKeys
+}
+
+// validate rejects configuration values that cannot be applied
+func (c *Config) validate() error {
+	for _, l := range c.Metrics.Listeners {
+		if l != MetricsListenerPort && l != MetricsListenerSocket {
+			return fmt.Errorf("unknown metrics listener %q, expected %q or %q", l, MetricsListenerPort, MetricsListenerSocket)
+		}
+	}
+	return nil
 }
 
 // LoadAPIKeys loads API keys from JSON file
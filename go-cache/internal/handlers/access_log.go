@@ -0,0 +1,159 @@
+package handlers
+
+import (
+	"context"
+	cryptorand "crypto/rand"
+	"encoding/hex"
+	"math/rand/v2"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+
+	"nft-proxy/internal/alchemy"
+)
+
+// requestIDHeader carries the request ID from nginx or the client, and back
+const requestIDHeader = "X-Request-ID"
+
+// maxRequestIDLength bounds inbound request IDs so they cannot bloat logs
+const maxRequestIDLength = 128
+
+// sensitiveQueryParams are redacted from logged query strings
+var sensitiveQueryParams = map[string]bool{
+	"token":        true,
+	"jwt":          true,
+	"access_token": true,
+	"sig":          true,
+}
+
+// requestInfo describes a proxied request as it is resolved. It is shared
+// through the request context by the access log and the proxy handler;
+// fields that cannot be resolved keep their fallback values.
+type requestInfo struct {
+	id       string
+	chain    string
+	endpoint string
+	// tenant is the name of the caller's tenant, if tenants are configured
+	tenant   string
+	upstream alchemy.RequestStats
+}
+
+type requestInfoKey struct{}
+
+func newRequestInfo(id string) *requestInfo {
+	return &requestInfo{id: id, chain: "unknown", endpoint: "other"}
+}
+
+func withRequestInfo(ctx context.Context, info *requestInfo) context.Context {
+	return context.WithValue(ctx, requestInfoKey{}, info)
+}
+
+// requestInfoFrom returns the request's info, or nil if it has none
+func requestInfoFrom(ctx context.Context) *requestInfo {
+	info, _ := ctx.Value(requestInfoKey{}).(*requestInfo)
+	return info
+}
+
+// withAccessLog assigns every request an ID, echoed in X-Request-ID, and
+// writes one structured log entry per request once it completes. Failed
+// requests are always logged; successful ones are sampled at the configured
+// rate.
+func (s *Server) withAccessLog(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+
+		id := r.Header.Get(requestIDHeader)
+		if !validRequestID(id) {
+			id = newRequestID()
+		}
+		w.Header().Set(requestIDHeader, id)
+
+		info := newRequestInfo(id)
+		rec := newStatusRecorder(w)
+		r = r.WithContext(withRequestInfo(r.Context(), info))
+
+		defer func() {
+			// Streaming failures abort the handler with a panic; log them too
+			aborted := recover()
+			if s.accessLogger != nil && (aborted != nil || rec.status >= http.StatusBadRequest || rand.Float64() < s.accessLogSampleRate) {
+				s.logAccess(r, rec, info, time.Since(start), aborted != nil)
+			}
+			if aborted != nil {
+				panic(aborted)
+			}
+		}()
+
+		next.ServeHTTP(rec, r)
+	})
+}
+
+func (s *Server) logAccess(r *http.Request, rec *statusRecorder, info *requestInfo, latency time.Duration, aborted bool) {
+	cacheStatus := rec.Header().Get("X-Cache-Status")
+	if cacheStatus == "" {
+		cacheStatus = "NONE"
+	}
+
+	fields := []zap.Field{
+		zap.String("request_id", info.id),
+		zap.String("method", r.Method),
+		zap.String("path", r.URL.Path),
+		zap.String("query", redactQuery(r.URL.RawQuery)),
+		zap.String("chain", info.chain),
+		zap.String("endpoint", info.endpoint),
+		zap.Int("status", rec.status),
+		zap.String("cache", cacheStatus),
+		zap.Int("upstream_attempts", info.upstream.Attempts),
+		zap.Duration("latency", latency),
+		zap.Int64("bytes", rec.bytes),
+	}
+	if info.tenant != "" {
+		fields = append(fields, zap.String("tenant", info.tenant))
+	}
+	if aborted {
+		fields = append(fields, zap.Bool("aborted", true))
+	}
+	s.accessLogger.Info("request", fields...)
+}
+
+// validRequestID reports whether an inbound request ID can be reused
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLength {
+		return false
+	}
+	for i := 0; i < len(id); i++ {
+		if id[i] <= ' ' || id[i] > '~' {
+			return false
+		}
+	}
+	return true
+}
+
+// newRequestID returns a random 128-bit request ID
+func newRequestID() string {
+	var b [16]byte
+	_, _ = cryptorand.Read(b[:])
+	return hex.EncodeToString(b[:])
+}
+
+// redactQuery replaces the values of sensitive query parameters
+func redactQuery(rawQuery string) string {
+	if rawQuery == "" {
+		return ""
+	}
+
+	parts := strings.Split(rawQuery, "&")
+	for i, part := range parts {
+		name, _, hasValue := strings.Cut(part, "=")
+		decoded, err := url.QueryUnescape(name)
+		if err != nil {
+			decoded = name
+		}
+		if hasValue && sensitiveQueryParams[strings.ToLower(decoded)] {
+			parts[i] = name + "=REDACTED"
+		}
+	}
+	return strings.Join(parts, "&")
+}
@@ -0,0 +1,147 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"nft-proxy/internal/alchemy"
+)
+
+// CacheInspection explains how the cache treats a proxied request
+type CacheInspection struct {
+	URL      string `json:"url"`
+	Method   string `json:"method"`
+	Chain    string `json:"chain"`
+	Endpoint string `json:"endpoint"`
+	Key      string `json:"key"`
+	// Cacheable is false when the endpoint's rule disables caching
+	Cacheable bool             `json:"cacheable"`
+	RuleTTL   float64          `json:"rule_ttl_seconds"`
+	Tiers     []TierInspection `json:"tiers"`
+}
+
+// TierInspection reports what one cache tier holds for the inspected key
+type TierInspection struct {
+	Tier            string  `json:"tier"`
+	Present         bool    `json:"present"`
+	Expired         bool    `json:"expired,omitempty"`
+	Age             float64 `json:"age_seconds,omitempty"`
+	TTLRemaining    float64 `json:"ttl_remaining_seconds,omitempty"`
+	SizeBytes       int64   `json:"size_bytes,omitempty"`
+	StatusCode      int     `json:"status_code,omitempty"`
+	ContentEncoding string  `json:"content_encoding,omitempty"`
+	Error           string  `json:"error,omitempty"`
+}
+
+// errCacheDisabled is returned by InspectCache when the server has no cache
+var errCacheDisabled = errors.New("response cache is disabled")
+
+// errInspectURL is returned by InspectCache for URLs the proxy would not serve
+var errInspectURL = errors.New("url must look like /{chain}/{network}/nft/v3/{endpoint}")
+
+// maxInspectBodyBytes bounds the request body accepted for POST inspections
+const maxInspectBodyBytes = 1 << 20
+
+// InspectCache computes the cache key of a proxied request, given as the URL
+// a client would call such as /eth/mainnet/nft/v3/getNFTsForOwner?owner=0x1,
+// and reports what every cache tier holds for it
+func (s *Server) InspectCache(ctx context.Context, method, rawURL string, body []byte) (*CacheInspection, error) {
+	if s.cache == nil {
+		return nil, errCacheDisabled
+	}
+
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid url: %w", err)
+	}
+	segments := strings.SplitN(strings.TrimPrefix(u.Path, "/"), "/", 3)
+	if len(segments) < 3 {
+		return nil, errInspectURL
+	}
+
+	r, err := http.NewRequestWithContext(ctx, method, u.RequestURI(), bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("invalid request: %w", err)
+	}
+	alchemyPath := ExtractAlchemyPath(r)
+	if alchemyPath == "" {
+		return nil, errInspectURL
+	}
+
+	canonical, err := s.alchemyClient.CanonicalChain(segments[0], segments[1])
+	if err != nil {
+		return nil, err
+	}
+
+	endpoint := alchemy.EndpointName(alchemyPath)
+	rule := s.cache.Rule(endpoint)
+	inspection := &CacheInspection{
+		URL:       u.RequestURI(),
+		Method:    method,
+		Chain:     canonical,
+		Endpoint:  endpoint,
+		Key:       s.cacheKey(canonical, endpoint, alchemyPath, r, body),
+		Cacheable: rule.TTL > 0,
+		RuleTTL:   rule.TTL.Seconds(),
+	}
+
+	for _, state := range s.cache.Inspect(ctx, inspection.Key) {
+		tier := TierInspection{Tier: state.Tier, Present: state.Present}
+		if state.Err != nil {
+			tier.Error = state.Err.Error()
+		}
+		if state.Present {
+			tier.Expired = state.Expired
+			tier.Age = state.Age.Seconds()
+			tier.TTLRemaining = state.TTL.Seconds()
+			tier.SizeBytes = state.Size
+			tier.StatusCode = state.StatusCode
+			tier.ContentEncoding = state.ContentEncoding
+		}
+		inspection.Tiers = append(inspection.Tiers, tier)
+	}
+	return inspection, nil
+}
+
+// handleCacheInspect serves InspectCache on the metrics server. The request
+// to inspect is given by the url query parameter and optionally method; the
+// body of a POST inspection is the body of the inspected request.
+func (ms *MetricsServer) handleCacheInspect(w http.ResponseWriter, r *http.Request) {
+	target := r.URL.Query().Get("url")
+	if target == "" {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "missing url parameter"})
+		return
+	}
+
+	method := strings.ToUpper(r.URL.Query().Get("method"))
+	if method == "" {
+		method = http.MethodGet
+	}
+
+	var body []byte
+	if r.Method == http.MethodPost {
+		var err error
+		body, err = io.ReadAll(io.LimitReader(r.Body, maxInspectBodyBytes))
+		if err != nil {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": "failed to read body"})
+			return
+		}
+	}
+
+	inspection, err := ms.inspector.InspectCache(r.Context(), method, target, body)
+	if errors.Is(err, errCacheDisabled) {
+		writeJSON(w, http.StatusNotFound, map[string]string{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return
+	}
+	writeJSON(w, http.StatusOK, inspection)
+}
@@ -0,0 +1,125 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"go.uber.org/zap"
+
+	"nft-proxy/internal/cache"
+)
+
+// Purge selectors accepted by PurgeCache
+const (
+	PurgeByKey      = "key"
+	PurgeByChain    = "chain"
+	PurgeByContract = "contract"
+	PurgeByOwner    = "owner"
+)
+
+// purgeSelectors lists the selectors in the order they are looked up
+var purgeSelectors = []string{PurgeByKey, PurgeByChain, PurgeByContract, PurgeByOwner}
+
+// errPurgeSelector is returned for requests without exactly one selector
+var errPurgeSelector = errors.New("exactly one of key, chain, contract or owner is required")
+
+// CachePurge reports what a purge removed
+type CachePurge struct {
+	Selector string `json:"selector"`
+	Value    string `json:"value"`
+	// Purged is the number of entries removed across all tiers
+	Purged int                `json:"purged"`
+	Tiers  []TierPurgeOutcome `json:"tiers"`
+}
+
+// TierPurgeOutcome reports what a purge removed from one cache tier
+type TierPurgeOutcome struct {
+	Tier   string `json:"tier"`
+	Purged int    `json:"purged"`
+	Error  string `json:"error,omitempty"`
+}
+
+// PurgeCache removes entries from every cache tier: the entry stored under an
+// exact key, every entry of a chain such as eth-mainnet, or every entry
+// requested for a contract or owner address. Contract and owner purges cover
+// all chains.
+func (s *Server) PurgeCache(ctx context.Context, selector, value string) (*CachePurge, error) {
+	if s.cache == nil {
+		return nil, errCacheDisabled
+	}
+
+	var results []cache.PurgeResult
+	switch selector {
+	case PurgeByKey:
+		results = s.cache.PurgeKey(ctx, value)
+	case PurgeByChain:
+		chain, network, _ := strings.Cut(value, "-")
+		canonical, err := s.alchemyClient.CanonicalChain(chain, network)
+		if err != nil {
+			return nil, err
+		}
+		value = canonical
+		results = s.cache.PurgeChain(ctx, canonical)
+	case PurgeByContract:
+		results = s.cache.PurgeTag(ctx, cache.ContractTag(value))
+	case PurgeByOwner:
+		results = s.cache.PurgeTag(ctx, cache.OwnerTag(value))
+	default:
+		return nil, fmt.Errorf("unknown purge selector %q", selector)
+	}
+
+	purge := &CachePurge{Selector: selector, Value: value}
+	for _, result := range results {
+		tier := TierPurgeOutcome{Tier: result.Tier, Purged: result.Purged}
+		if result.Err != nil {
+			tier.Error = result.Err.Error()
+		}
+		purge.Purged += result.Purged
+		purge.Tiers = append(purge.Tiers, tier)
+	}
+	s.logger.Info("Purged cache entries", zap.String("selector", selector), zap.String("value", value), zap.Int("purged", purge.Purged))
+	return purge, nil
+}
+
+// handleCachePurge serves PurgeCache on the metrics server. The selector is
+// given as exactly one of the key, chain, contract or owner query parameters.
+func (ms *MetricsServer) handleCachePurge(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	selector := ""
+	for _, name := range purgeSelectors {
+		if query.Has(name) {
+			if selector != "" {
+				selector = ""
+				break
+			}
+			selector = name
+		}
+	}
+	value := query.Get(selector)
+	if selector == "" || value == "" {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": errPurgeSelector.Error()})
+		return
+	}
+
+	purge, err := ms.purger.PurgeCache(r.Context(), selector, value)
+	if errors.Is(err, errCacheDisabled) {
+		writeJSON(w, http.StatusNotFound, map[string]string{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return
+	}
+
+	status := http.StatusOK
+	for _, tier := range purge.Tiers {
+		if tier.Error != "" {
+			// Some tiers may still hold the entries
+			status = http.StatusBadGateway
+		}
+	}
+	writeJSON(w, status, purge)
+}
@@ -0,0 +1,52 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"go.uber.org/zap"
+
+	"nft-proxy/internal/snapshot"
+)
+
+// handleSnapshotExport streams a snapshot of the cache of ms.snapshots
+func (ms *MetricsServer) handleSnapshotExport(w http.ResponseWriter, r *http.Request) {
+	if ms.snapshots.cache == nil {
+		writeJSON(w, http.StatusNotFound, map[string]string{"error": errCacheDisabled.Error()})
+		return
+	}
+
+	// Snapshots of large caches take longer than the server's write timeout
+	_ = http.NewResponseController(w).SetWriteDeadline(time.Time{})
+
+	filename := fmt.Sprintf("nft-proxy-cache-%s.jsonl.gz", time.Now().UTC().Format("20060102T150405Z"))
+	w.Header().Set("Content-Type", snapshot.ContentType)
+	w.Header().Set("Content-Disposition", `attachment; filename="`+filename+`"`)
+
+	stats, err := snapshot.Export(r.Context(), ms.snapshots.cache, w)
+	if err != nil {
+		// Headers are sent; abort so the client sees a truncated transfer
+		ms.logger.Error("Cache snapshot export failed", zap.Error(err))
+		panic(http.ErrAbortHandler)
+	}
+	ms.logger.Info("Exported cache snapshot", zap.Int("entries", stats.Entries), zap.Int64("bytes", stats.Bytes))
+}
+
+// handleSnapshotImport loads a snapshot sent as the request body
+func (ms *MetricsServer) handleSnapshotImport(w http.ResponseWriter, r *http.Request) {
+	if ms.snapshots.cache == nil {
+		writeJSON(w, http.StatusNotFound, map[string]string{"error": errCacheDisabled.Error()})
+		return
+	}
+
+	_ = http.NewResponseController(w).SetReadDeadline(time.Time{})
+
+	stats, err := snapshot.Import(r.Context(), ms.snapshots.cache, r.Body)
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]any{"error": err.Error(), "imported": stats})
+		return
+	}
+	ms.logger.Info("Imported cache snapshot", zap.Int("entries", stats.Entries), zap.Int("skipped", stats.Skipped))
+	writeJSON(w, http.StatusOK, stats)
+}
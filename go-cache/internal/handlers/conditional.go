@@ -0,0 +1,59 @@
+package handlers
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// maxBufferedBytes bounds the cache misses read whole before they are served,
+// so that their first response carries an ETag header. Larger ones stream
+// with the ETag in a trailer.
+const maxBufferedBytes = 256 << 10
+
+// entityTag returns a strong ETag for a cached body served with the given
+// content coding. The same body served decoded and compressed gets different
+// tags, as strong validators of different representations must.
+func entityTag(body []byte, coding string) string {
+	sum := sha256.Sum256(body)
+	return formatEntityTag(sum[:], coding)
+}
+
+// formatEntityTag returns the ETag of a body from its SHA-256 sum, for bodies
+// hashed as they stream
+func formatEntityTag(sum []byte, coding string) string {
+	tag := hex.EncodeToString(sum[:16])
+	if coding != "" {
+		tag += "-" + coding
+	}
+	return `"` + tag + `"`
+}
+
+// etagMatches reports whether an If-None-Match header value matches etag.
+// If-None-Match uses the weak comparison, so W/ prefixes are ignored.
+func etagMatches(ifNoneMatch, etag string) bool {
+	etag = strings.TrimPrefix(etag, "W/")
+	for _, candidate := range strings.Split(ifNoneMatch, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" || strings.TrimPrefix(candidate, "W/") == etag {
+			return true
+		}
+	}
+	return false
+}
+
+// setFreshness sets Cache-Control and Age for a response that is fresh for
+// lifetime and was stored age ago. Responses the cache rules do not keep
+// must not be stored downstream either. Every request is authenticated, so
+// only the client may store a response, never a shared cache or CDN.
+func setFreshness(header http.Header, lifetime, age time.Duration) {
+	if lifetime <= 0 {
+		header.Set("Cache-Control", "no-store")
+		return
+	}
+	header.Set("Cache-Control", "private, max-age="+strconv.Itoa(int(lifetime/time.Second)))
+	header.Set("Age", strconv.Itoa(int(max(age, 0)/time.Second)))
+}
@@ -0,0 +1,88 @@
+package handlers
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/andybalholm/brotli"
+)
+
+// forwardedHeaders are upstream response headers that are safe to pass on to
+// clients. Everything else Alchemy sends is dropped.
+var forwardedHeaders = []string{
+	"Content-Type",
+	"Retry-After",
+	"X-Ratelimit-Limit",
+	"X-Ratelimit-Remaining",
+	"X-Ratelimit-Reset",
+}
+
+// copyForwardedHeaders copies the allowlisted headers from src to dst
+func copyForwardedHeaders(dst, src http.Header) {
+	for _, name := range forwardedHeaders {
+		for _, value := range src.Values(name) {
+			dst.Add(name, value)
+		}
+	}
+}
+
+// acceptsEncoding reports whether an Accept-Encoding header value allows the
+// given content coding. The identity coding is always acceptable.
+func acceptsEncoding(acceptEncoding, coding string) bool {
+	if coding == "" || coding == "identity" {
+		return true
+	}
+
+	wildcard := false
+	for _, part := range strings.Split(acceptEncoding, ",") {
+		name, params, _ := strings.Cut(part, ";")
+		name = strings.ToLower(strings.TrimSpace(name))
+
+		q := 1.0
+		for _, param := range strings.Split(params, ";") {
+			key, value, ok := strings.Cut(strings.TrimSpace(param), "=")
+			if ok && strings.EqualFold(key, "q") {
+				if parsed, err := strconv.ParseFloat(value, 64); err == nil {
+					q = parsed
+				}
+			}
+		}
+
+		switch name {
+		case coding:
+			return q > 0
+		case "*":
+			wildcard = q > 0
+		}
+	}
+	return wildcard
+}
+
+// decodingReader returns a reader yielding the decoded form of body
+func decodingReader(coding string, body io.Reader) (io.ReadCloser, error) {
+	switch coding {
+	case "", "identity":
+		return io.NopCloser(body), nil
+	case "gzip":
+		return gzip.NewReader(body)
+	case "br":
+		return io.NopCloser(brotli.NewReader(body)), nil
+	default:
+		return nil, fmt.Errorf("unsupported content encoding: %s", coding)
+	}
+}
+
+// decodeBody decodes a complete body encoded with coding
+func decodeBody(coding string, body []byte) ([]byte, error) {
+	reader, err := decodingReader(coding, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+	return io.ReadAll(reader)
+}
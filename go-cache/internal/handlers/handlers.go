@@ -1,39 +1,175 @@
 package handlers
 
 import (
+	"bytes"
 	"context"
+	"crypto/sha256"
 	"encoding/json"
+	"errors"
+	"hash"
 	"io"
 	"net"
 	"net/http"
 	"os"
+	"strconv"
 	"time"
 
 	"github.com/gorilla/mux"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
 	"go.uber.org/zap"
 
 	"nft-proxy/internal/alchemy"
+	"nft-proxy/internal/budget"
+	"nft-proxy/internal/cache"
+	"nft-proxy/internal/health"
+	"nft-proxy/internal/jwtauth"
+	"nft-proxy/internal/limiter"
+	"nft-proxy/internal/metrics"
+	"nft-proxy/internal/projection"
+	"nft-proxy/internal/ratelimit"
+	"nft-proxy/internal/signedurl"
+	"nft-proxy/internal/spam"
+	"nft-proxy/internal/tenant"
+	"nft-proxy/internal/warmup"
 )
 
+var tracer = otel.Tracer("nft-proxy/internal/handlers")
+
 type Server struct {
 	alchemyClient *alchemy.Client
 	logger        *zap.Logger
 	server        *http.Server
+	// tcpServer serves clients directly, without nginx, when started
+	tcpServer *http.Server
+
+	limiter    *limiter.Limiter
+	retryAfter time.Duration
+	cache      *cache.Cache
+	// maxEntryBytes caps how much of a streamed response is kept for the cache
+	maxEntryBytes int64
+	metrics       *metrics.RequestMetrics
+	// adminHandler serves /metrics and /admin on the Unix socket when set
+	adminHandler http.Handler
+	// accessLogger writes access log entries when set, for a
+	// accessLogSampleRate fraction of successful requests
+	accessLogger        *zap.Logger
+	accessLogSampleRate float64
+	// readiness serves /ready when set
+	readiness *health.Checker
+	// webhookSigningKeys enable the Alchemy webhook endpoint when set
+	webhookSigningKeys []string
+	webhookMetrics     *metrics.WebhookMetrics
+	// hotKeys counts cached requests for warmup when set
+	hotKeys *warmup.Tracker
+	// projectionPresets name field lists clients can select as fields=@name
+	projectionPresets map[string][]string
+	// spamFilter flags or drops spam collections when set
+	spamFilter *spam.Filter
+	// tenants enforce per-client policies when set
+	tenants *tenant.Registry
+	// rateLimit limits the request rate of each client when set
+	rateLimit *ratelimit.Limiter
+	// jwtAuth validates puzzle JWTs in the proxy when set
+	jwtAuth *jwtauth.Authenticator
+	// urlSigner verifies signed URLs when set
+	urlSigner *signedurl.Signer
 }
 
-func NewServer(alchemyClient *alchemy.Client, logger *zap.Logger) *Server {
-	return &Server{
-		alchemyClient: alchemyClient,
-		logger:        logger,
+func NewServer(alchemyClient *alchemy.Client, logger *zap.Logger, opts ...ServerOption) *Server {
+	s := &Server{
+		alchemyClient:  alchemyClient,
+		logger:         logger,
+		metrics:        metrics.NewRequestMetrics(),
+		webhookMetrics: metrics.NewWebhookMetrics(),
+	}
+	for _, opt := range opts {
+		opt(s)
 	}
+	return s
 }
 
 func (s *Server) SetupRoutes(router *mux.Router) {
-	router.PathPrefix("/{chain}/{network}/nft/v3/").HandlerFunc(s.handleProxy)
+	s.setupRoutes(router, false)
+}
+
+// setupRoutes registers the routes of a listener. Direct listeners, which
+// clients reach without nginx, leave out the internal endpoints that nginx
+// restricts to internal networks.
+func (s *Server) setupRoutes(router *mux.Router, direct bool) {
+	router.PathPrefix("/{chain}/{network}/nft/v3/").Handler(s.withAccessLog(s.withSignedURLs(s.withJWTAuth(http.HandlerFunc(s.handleProxy)))))
 	router.HandleFunc("/health", s.handleHealth).Methods("GET")
+	if len(s.webhookSigningKeys) > 0 {
+		router.HandleFunc("/webhooks/alchemy", s.handleAlchemyWebhook).Methods("POST")
+	}
+	if direct {
+		return
+	}
+	if s.readiness != nil {
+		router.HandleFunc("/ready", readinessHandler(s.readiness)).Methods("GET")
+	}
+	if s.adminHandler != nil {
+		router.Handle("/metrics", s.adminHandler)
+		router.PathPrefix("/admin/").Handler(s.adminHandler)
+	}
+}
+
+// MountAdmin serves the metrics server's endpoints, see MetricsServer.Handler,
+// on the proxy's listener. It must be called before the server starts.
+func (s *Server) MountAdmin(h http.Handler) {
+	s.adminHandler = h
 }
 
 func (s *Server) handleProxy(w http.ResponseWriter, r *http.Request) {
+	start := time.Now()
+	rec := newStatusRecorder(w)
+
+	// Continue the caller's trace from its traceparent header, if any
+	ctx := otel.GetTextMapPropagator().Extract(r.Context(), propagation.HeaderCarrier(r.Header))
+
+	info := requestInfoFrom(ctx)
+	if info == nil {
+		info = newRequestInfo("")
+		ctx = withRequestInfo(ctx, info)
+	}
+	ctx = alchemy.WithRequestStats(ctx, &info.upstream)
+
+	ctx, span := tracer.Start(ctx, "nft-proxy.request",
+		trace.WithSpanKind(trace.SpanKindServer),
+		trace.WithAttributes(
+			attribute.String("http.request.method", r.Method),
+			attribute.String("url.path", r.URL.Path),
+		))
+	if info.id != "" {
+		span.SetAttributes(attribute.String("nft.request_id", info.id))
+	}
+	r = r.WithContext(ctx)
+
+	s.metrics.OnStart()
+	defer func() {
+		s.metrics.OnFinish(info.chain, info.endpoint, rec.status, time.Since(start))
+
+		span.SetName(r.Method + " " + info.endpoint)
+		span.SetAttributes(
+			attribute.String("nft.chain", info.chain),
+			attribute.String("nft.endpoint", info.endpoint),
+			attribute.Int("http.response.status_code", rec.status),
+			attribute.String("nft.cache_status", rec.Header().Get("X-Cache-Status")),
+		)
+		if rec.status >= http.StatusInternalServerError {
+			span.SetStatus(codes.Error, http.StatusText(rec.status))
+		}
+		span.End()
+	}()
+
+	s.proxy(rec, r, info)
+}
+
+// proxy serves a request from the cache or Alchemy
+func (s *Server) proxy(w http.ResponseWriter, r *http.Request, info *requestInfo) {
 	vars := mux.Vars(r)
 	chain := vars["chain"]
 	network := vars["network"]
@@ -44,50 +180,378 @@ func (s *Server) handleProxy(w http.ResponseWriter, r *http.Request) {
 		s.writeError(w, "Invalid request path", http.StatusBadRequest)
 		return
 	}
+	endpoint := alchemy.EndpointName(alchemyPath)
+	info.endpoint = alchemy.EndpointLabel(endpoint)
 
-	var respBody []byte
-	var statusCode int
-	var err error
-
+	var body []byte
 	switch r.Method {
 	case http.MethodGet:
-		respBody, statusCode, err = s.alchemyClient.ProxyGET(
-			r.Context(),
-			chain,
-			network,
-			alchemyPath,
-			r.URL.RawQuery,
-		)
 	case http.MethodPost:
-		body, readErr := io.ReadAll(r.Body)
+		var readErr error
+		body, readErr = io.ReadAll(r.Body)
 		if readErr != nil {
 			s.logger.Error("Failed to read request body", zap.Error(readErr))
 			s.writeError(w, "Invalid request body", http.StatusBadRequest)
 			return
 		}
 		defer r.Body.Close()
-
-		respBody, statusCode, err = s.alchemyClient.ProxyPOST(
-			r.Context(),
-			chain,
-			network,
-			alchemyPath,
-			body,
-		)
 	default:
 		s.writeError(w, "Method not allowed", http.StatusMethodNotAllowed)
 		return
 	}
 
+	canonical, err := s.alchemyClient.CanonicalChain(chain, network)
 	if err != nil {
 		s.logger.Error("Alchemy API error", zap.Error(err))
 		s.writeError(w, "Failed to proxy request", http.StatusBadGateway)
 		return
 	}
+	info.chain = canonical
 
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(statusCode)
-	w.Write(respBody)
+	if !s.authorizeSignedURL(w, r, canonical, endpoint) {
+		return
+	}
+
+	t, ok := s.resolveTenant(w, r, info, canonical, endpoint)
+	if !ok {
+		return
+	}
+
+	// The projection is applied on the way out: it is neither sent upstream
+	// nor part of the cache key, so all projections share one entry
+	var proj *projection.Projection
+	upstreamQuery := r.URL.RawQuery
+	if query := r.URL.Query(); query.Has(projection.Param) {
+		proj, err = projection.Parse(query.Get(projection.Param), s.projectionPresets)
+		if err != nil {
+			s.writeError(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		query.Del(projection.Param)
+		upstreamQuery = query.Encode()
+	}
+
+	cacheKey := s.cacheKey(canonical, endpoint, alchemyPath, r, body)
+	s.recordHotKey(cacheKey, endpoint, r, chain, network, alchemyPath, body)
+	if cacheKey != "" {
+		if entry, tier, ok := s.cache.Get(r.Context(), cacheKey, info.endpoint); ok {
+			if !s.takeRateLimit(w, r, true) {
+				return
+			}
+			s.writeEntry(w, r, entry, tier, s.newRewrite(canonical, endpoint, proj))
+			return
+		}
+	}
+	if !s.takeRateLimit(w, r, false) {
+		return
+	}
+
+	if t != nil {
+		if err := t.AllowSpend(); err != nil {
+			s.writeTenantError(w, t, err)
+			return
+		}
+		r = r.WithContext(limiter.WithPriority(r.Context(), t.Priority()))
+	}
+
+	release, err := s.acquireUpstream(r)
+	if err != nil {
+		s.logger.Warn("Shedding upstream request", zap.Error(err))
+		s.writeOverloaded(w)
+		return
+	}
+
+	start := time.Now()
+	resp, err := s.alchemyClient.Stream(r.Context(), r.Method, chain, network, alchemyPath, upstreamQuery, body)
+	latency := time.Since(start)
+	if err != nil {
+		release(latency, isOverloadError(err))
+		s.writeUpstreamError(w, err)
+		return
+	}
+	defer resp.Body.Close()
+	if t != nil {
+		t.Record(endpoint)
+	}
+	// The slot stays taken while the body streams; latency is time to headers
+	defer release(latency, isOverloadStatus(resp.StatusCode))
+
+	var tags []string
+	if cacheKey != "" {
+		tags = cache.Tags(r.URL.RawQuery, body)
+	}
+	if rw := s.newRewrite(canonical, endpoint, proj); rw != nil {
+		s.writeRewritten(w, r, resp, cacheKey, endpoint, tags, rw)
+		return
+	}
+	s.streamResponse(w, r, resp, cacheKey, endpoint, tags)
+}
+
+// writeUpstreamError maps an error from the upstream call to a client response
+func (s *Server) writeUpstreamError(w http.ResponseWriter, err error) {
+	var exhausted *budget.ExhaustedError
+	if errors.As(err, &exhausted) {
+		s.logger.Warn("Rejecting cache miss, compute unit budget exhausted", zap.Error(err))
+		w.Header().Set("Retry-After", retryAfterSeconds(time.Until(exhausted.ResetAt)))
+		s.writeError(w, "Compute unit budget exhausted, only cached responses are available", http.StatusServiceUnavailable)
+		return
+	}
+	if errors.Is(err, alchemy.ErrThrottled) {
+		s.logger.Warn("Rejecting cache miss, compute unit rate throttled", zap.Error(err))
+		s.writeOverloaded(w)
+		return
+	}
+	if errors.Is(err, alchemy.ErrCircuitOpen) || errors.Is(err, alchemy.ErrKeyQuarantined) {
+		s.logger.Warn("Rejecting cache miss, Alchemy unavailable", zap.Error(err))
+		w.Header().Set("Retry-After", retryAfterSeconds(s.retryAfter))
+		s.writeError(w, "Upstream unavailable, only cached responses are available", http.StatusServiceUnavailable)
+		return
+	}
+
+	s.logger.Error("Alchemy API error", zap.Error(err))
+	s.writeError(w, "Failed to proxy request", http.StatusBadGateway)
+}
+
+// streamResponse copies the upstream response to the client as it arrives.
+// Compressed bodies are passed through when the client accepts their encoding
+// and decoded on the fly otherwise. Cacheable responses are also collected,
+// still compressed, for the cache unless they grow past the cache's entry size
+// limit, so memory stays bounded for large payloads. Error statuses are cached
+// only when the endpoint's rule has a negative TTL for them. Cached entries
+// carry tags so they can be purged by contract or owner.
+//
+// Cacheable successful responses carry an ETag from the first request on:
+// bodies of up to maxBufferedBytes are read whole and served like cache hits,
+// larger ones get the ETag as a trailer once streamed.
+func (s *Server) streamResponse(w http.ResponseWriter, r *http.Request, resp *http.Response, cacheKey, endpoint string, tags []string) {
+	encoding := resp.Header.Get("Content-Encoding")
+	passthrough := acceptsEncoding(r.Header.Get("Accept-Encoding"), encoding)
+	cacheable := cacheKey != "" && s.cache.Caches(endpoint, resp.StatusCode) && resp.ContentLength <= s.maxEntryBytes
+	tagged := cacheable && resp.StatusCode == http.StatusOK
+
+	if limit := min(maxBufferedBytes, s.maxEntryBytes); tagged && resp.ContentLength <= limit {
+		raw, err := io.ReadAll(io.LimitReader(resp.Body, limit+1))
+		if err != nil {
+			s.logger.Error("Failed to read upstream response", zap.Error(err))
+			s.writeError(w, "Failed to proxy request", http.StatusBadGateway)
+			return
+		}
+		if int64(len(raw)) <= limit {
+			entry := &cache.Entry{
+				Body:            raw,
+				StatusCode:      resp.StatusCode,
+				ContentType:     resp.Header.Get("Content-Type"),
+				ContentEncoding: encoding,
+				Tags:            tags,
+			}
+			s.cache.Set(r.Context(), cacheKey, endpoint, entry)
+			copyForwardedHeaders(w.Header(), resp.Header)
+			s.writeEntry(w, r, entry, -1, nil)
+			return
+		}
+		resp.Body = struct {
+			io.Reader
+			io.Closer
+		}{io.MultiReader(bytes.NewReader(raw), resp.Body), resp.Body}
+	}
+
+	var raw io.Reader = resp.Body
+	var tee *cappedBuffer
+	if cacheable {
+		tee = newCappedBuffer(s.maxEntryBytes)
+		raw = io.TeeReader(raw, tee)
+	}
+	// The ETag is taken over the body as stored, like on cache hits, even
+	// when it is decoded for the client
+	var digest hash.Hash
+	if tagged {
+		digest = sha256.New()
+		raw = io.TeeReader(raw, digest)
+	}
+
+	src := raw
+	if !passthrough {
+		decoded, err := decodingReader(encoding, raw)
+		if err != nil {
+			s.logger.Error("Failed to decode upstream response", zap.String("encoding", encoding), zap.Error(err))
+			s.writeError(w, "Failed to proxy request", http.StatusBadGateway)
+			return
+		}
+		defer decoded.Close()
+		src = decoded
+	}
+
+	header := w.Header()
+	copyForwardedHeaders(header, resp.Header)
+	if header.Get("Content-Type") == "" {
+		header.Set("Content-Type", "application/json")
+	}
+	if passthrough {
+		if encoding != "" {
+			header.Set("Content-Encoding", encoding)
+		}
+		if resp.ContentLength >= 0 {
+			header.Set("Content-Length", strconv.FormatInt(resp.ContentLength, 10))
+		}
+	}
+	header.Add("Vary", "Accept-Encoding")
+	header.Set("X-Cache-Status", "MISS")
+	if cacheKey != "" {
+		setFreshness(header, s.cache.Rule(endpoint).TTLFor(resp.StatusCode), 0)
+	}
+	if digest != nil {
+		// Trailers need a chunked body
+		header.Del("Content-Length")
+		header.Set("Trailer", "ETag")
+	}
+	w.WriteHeader(resp.StatusCode)
+
+	if _, err := io.Copy(newFlushWriter(w), src); err != nil {
+		s.logger.Error("Failed to stream upstream response", zap.Error(err))
+		// Abort the connection so the client cannot mistake a truncated body for a complete one
+		panic(http.ErrAbortHandler)
+	}
+
+	if tee == nil {
+		return
+	}
+	// Decoders may stop short of the end of the raw stream; the cache and
+	// the ETag need all of it
+	if _, err := io.Copy(io.Discard, raw); err != nil {
+		return
+	}
+	if digest != nil {
+		served := ""
+		if passthrough {
+			served = encoding
+		}
+		header.Set("ETag", formatEntityTag(digest.Sum(nil), served))
+	}
+	if !tee.Overflowed() {
+		s.cache.Set(r.Context(), cacheKey, endpoint, &cache.Entry{
+			Body:            tee.Bytes(),
+			StatusCode:      resp.StatusCode,
+			ContentType:     resp.Header.Get("Content-Type"),
+			ContentEncoding: encoding,
+			Tags:            tags,
+		})
+	}
+}
+
+// cacheKey returns the cache key for the request, or "" if caching is disabled
+func (s *Server) cacheKey(canonical, endpoint, alchemyPath string, r *http.Request, body []byte) string {
+	if s.cache == nil {
+		return ""
+	}
+	return cache.Key(canonical, endpoint, r.Method, alchemyPath, r.URL.RawQuery, body)
+}
+
+// writeEntry serves a response held as a cache entry, pre-compressed if the
+// client accepts the stored encoding. tier is the index of the tier that held
+// it, or -1 for a response just fetched from upstream. Successful responses
+// are rewritten by rw when set and carry an ETag, and GET requests whose
+// If-None-Match matches it get 304 Not Modified without a body.
+func (s *Server) writeEntry(w http.ResponseWriter, r *http.Request, entry *cache.Entry, tier int, rw *rewrite) {
+	header := w.Header()
+	acceptEncoding := r.Header.Get("Accept-Encoding")
+	body, coding := entry.Body, entry.ContentEncoding
+
+	var etag string
+	if !entry.Negative() {
+		if rw != nil {
+			var err error
+			body, coding, err = s.rewriteEntry(entry, rw)
+			if err != nil {
+				s.logger.Error("Failed to decode cached response", zap.String("encoding", entry.ContentEncoding), zap.Error(err))
+				s.writeError(w, "Failed to read cached response", http.StatusInternalServerError)
+				return
+			}
+		}
+		served := ""
+		if acceptsEncoding(acceptEncoding, coding) {
+			served = coding
+		}
+		etag = entityTag(body, served)
+	}
+	inm := r.Header.Get("If-None-Match")
+	notModified := etag != "" && inm != "" && r.Method == http.MethodGet && etagMatches(inm, etag)
+
+	if !acceptsEncoding(acceptEncoding, coding) && !notModified {
+		decoded, err := decodeBody(coding, body)
+		if err != nil {
+			s.logger.Error("Failed to decode cached response", zap.String("encoding", coding), zap.Error(err))
+			s.writeError(w, "Failed to read cached response", http.StatusInternalServerError)
+			return
+		}
+		body, coding = decoded, ""
+	}
+
+	if etag != "" {
+		header.Set("ETag", etag)
+	}
+	setFreshness(header, entry.ExpiresAt.Sub(entry.StoredAt), time.Since(entry.StoredAt))
+	header.Add("Vary", "Accept-Encoding")
+	if tier < 0 {
+		header.Set("X-Cache-Status", "MISS")
+	} else {
+		header.Set("X-Cache-Status", "HIT")
+		header.Set("X-Cache-Level", strconv.Itoa(tier+1))
+	}
+	if notModified {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	if coding != "" {
+		header.Set("Content-Encoding", coding)
+	}
+	contentType := entry.ContentType
+	if contentType == "" {
+		contentType = "application/json"
+	}
+	header.Set("Content-Type", contentType)
+	header.Set("Content-Length", strconv.Itoa(len(body)))
+	w.WriteHeader(entry.StatusCode)
+	w.Write(body)
+}
+
+// acquireUpstream takes a slot from the concurrency limiter, if one is configured
+func (s *Server) acquireUpstream(r *http.Request) (limiter.ReleaseFunc, error) {
+	if s.limiter == nil {
+		return func(time.Duration, bool) {}, nil
+	}
+	return s.limiter.Acquire(r.Context())
+}
+
+// writeOverloaded sheds a request with 503 and a Retry-After hint
+func (s *Server) writeOverloaded(w http.ResponseWriter) {
+	w.Header().Set("Retry-After", retryAfterSeconds(s.retryAfter))
+	s.writeError(w, "Service overloaded, retry later", http.StatusServiceUnavailable)
+}
+
+// retryAfterSeconds formats a Retry-After value, rounding up to whole seconds
+func retryAfterSeconds(d time.Duration) string {
+	seconds := int((d + time.Second - 1) / time.Second)
+	if seconds < 1 {
+		seconds = 1
+	}
+	return strconv.Itoa(seconds)
+}
+
+// isOverloadStatus reports whether an upstream status signals saturation
+func isOverloadStatus(statusCode int) bool {
+	return statusCode == http.StatusTooManyRequests || statusCode >= http.StatusInternalServerError
+}
+
+// isOverloadError reports whether a failed upstream call should shrink the
+// concurrency limit. Rejections made before calling Alchemy and cancelled
+// requests say nothing about upstream health.
+func isOverloadError(err error) bool {
+	return !errors.Is(err, budget.ErrExhausted) &&
+		!errors.Is(err, alchemy.ErrThrottled) &&
+		!errors.Is(err, alchemy.ErrCircuitOpen) &&
+		!errors.Is(err, alchemy.ErrKeyQuarantined) &&
+		!errors.Is(err, context.Canceled)
 }
 
 func (s *Server) writeError(w http.ResponseWriter, message string, status int) {
@@ -117,27 +581,52 @@ func (s *Server) StartUnixSocket(socketPath string) error {
 		s.logger.Warn("Failed to set socket permissions", zap.String("path", socketPath), zap.Error(err))
 	}
 
+	s.server = s.newHTTPServer(false)
+
+	s.logger.Info("Starting NFT proxy server on Unix socket", zap.String("socket_path", socketPath))
+	return s.server.Serve(listener)
+}
+
+// StartTCP serves clients directly on addr, without nginx in front. Clients
+// must authenticate with a JWT, see WithJWTAuth, and cannot set the identity
+// and address headers nginx would. Metrics, admin and readiness endpoints
+// are not served.
+func (s *Server) StartTCP(addr string) error {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+
+	s.tcpServer = s.newHTTPServer(true)
+	s.tcpServer.BaseContext = func(net.Listener) context.Context {
+		return context.WithValue(context.Background(), directListenerKey{}, true)
+	}
+
+	s.logger.Info("Starting NFT proxy server on TCP", zap.String("addr", addr))
+	return s.tcpServer.Serve(listener)
+}
+
+func (s *Server) newHTTPServer(direct bool) *http.Server {
 	router := mux.NewRouter()
-	s.SetupRoutes(router)
+	s.setupRoutes(router, direct)
 
-	s.server = &http.Server{
+	return &http.Server{
 		Handler:      router,
 		ReadTimeout:  30 * time.Second,
 		WriteTimeout: 30 * time.Second,
 		IdleTimeout:  60 * time.Second,
 	}
-
-	s.logger.Info("Starting NFT proxy server on Unix socket", zap.String("socket_path", socketPath))
-	return s.server.Serve(listener)
 }
 
-// Stop stops the HTTP server
+// Stop stops the HTTP servers
 func (s *Server) Stop(ctx context.Context) error {
 	s.logger.Info("Stopping NFT proxy HTTP server")
 
-	if s.server != nil {
-		return s.server.Shutdown(ctx)
+	var errs []error
+	for _, server := range []*http.Server{s.server, s.tcpServer} {
+		if server != nil {
+			errs = append(errs, server.Shutdown(ctx))
+		}
 	}
-
-	return nil
+	return errors.Join(errs...)
 }
@@ -2,18 +2,76 @@ package handlers
 
 import (
 	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/gorilla/mux"
+	"github.com/prometheus/client_golang/prometheus"
 	"github.com/status-im/proxy-common/httpclient"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace/noop"
 	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest/observer"
 
 	"nft-proxy/internal/alchemy"
+	"nft-proxy/internal/budget"
+	"nft-proxy/internal/cache"
+	"nft-proxy/internal/health"
+	"nft-proxy/internal/jwtauth"
+	"nft-proxy/internal/limiter"
+	"nft-proxy/internal/ratelimit"
+	"nft-proxy/internal/signedurl"
+	"nft-proxy/internal/spam"
+	"nft-proxy/internal/tenant"
+	"nft-proxy/internal/tracing"
+	"nft-proxy/internal/warmup"
 )
 
+// newTestCache returns an in-memory response cache of one-minute entries
+func newTestCache() *cache.Cache {
+	return cache.New(zap.NewNop(), cache.Rules{Default: cache.Rule{TTL: time.Minute}}, cache.NewMemory(10, 0))
+}
+
+// newCachedTestServer starts a mock Alchemy serving handler as eth-mainnet,
+// also known as ethereum-mainnet, and returns a server in front of it with
+// the cache of newTestCache. opts are applied after the cache, so they can
+// replace it.
+func newCachedTestServer(t *testing.T, handler http.HandlerFunc, opts ...ServerOption) (*Server, *cache.Cache) {
+	t.Helper()
+
+	mockAlchemy := httptest.NewServer(handler)
+	t.Cleanup(mockAlchemy.Close)
+
+	baseURLs := map[string]string{
+		"eth-mainnet":      mockAlchemy.URL,
+		"ethereum-mainnet": mockAlchemy.URL,
+	}
+	client := alchemy.NewClient("test-api-key", baseURLs, httpclient.DefaultRetryOptions())
+	responseCache := newTestCache()
+	server := NewServer(client, zap.NewNop(), append([]ServerOption{WithCache(responseCache, 1<<20)}, opts...)...)
+	return server, responseCache
+}
+
 func TestExtractAlchemyPath(t *testing.T) {
 	tests := []struct {
 		name     string
@@ -306,3 +364,1399 @@ func TestSetupRoutes(t *testing.T) {
 		t.Error("NFT proxy route not registered")
 	}
 }
+
+func TestHandleProxy_ShedsWhenLimiterSaturated(t *testing.T) {
+	mockAlchemy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Error("Shed request must not reach upstream")
+	}))
+	defer mockAlchemy.Close()
+
+	baseURLs := map[string]string{
+		"eth-mainnet": mockAlchemy.URL,
+	}
+	client := alchemy.NewClient("test-api-key", baseURLs, httpclient.DefaultRetryOptions())
+	l := limiter.New(limiter.Options{InitialLimit: 1, MinLimit: 1, MaxLimit: 1, MaxQueue: 0})
+	server := NewServer(client, zap.NewNop(), WithConcurrencyLimiter(l, 3*time.Second))
+
+	release, err := l.Acquire(context.Background())
+	if err != nil {
+		t.Fatalf("Failed to occupy limiter slot: %v", err)
+	}
+	defer release(0, false)
+
+	req := httptest.NewRequest(http.MethodGet, "/eth/mainnet/nft/v3/getNFTsForOwner?owner=0x123", nil)
+	req = mux.SetURLVars(req, map[string]string{
+		"chain":   "eth",
+		"network": "mainnet",
+	})
+	w := httptest.NewRecorder()
+
+	server.handleProxy(w, req)
+
+	if w.Code != http.StatusServiceUnavailable {
+		t.Errorf("Expected status 503, got %d", w.Code)
+	}
+	if got := w.Header().Get("Retry-After"); got != "3" {
+		t.Errorf("Expected Retry-After 3, got %q", got)
+	}
+}
+
+func TestHandleProxy_ServesCacheHits(t *testing.T) {
+	calls := 0
+	server, _ := newCachedTestServer(t, func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte(`{"ownedNfts":[]}`))
+	})
+
+	for i, chain := range []string{"eth", "ethereum"} {
+		req := httptest.NewRequest(http.MethodGet, "/"+chain+"/mainnet/nft/v3/getNFTsForOwner?owner=0x123", nil)
+		req = mux.SetURLVars(req, map[string]string{
+			"chain":   chain,
+			"network": "mainnet",
+		})
+		w := httptest.NewRecorder()
+
+		server.handleProxy(w, req)
+
+		if w.Code != http.StatusOK {
+			t.Errorf("Request %d: expected status 200, got %d", i, w.Code)
+		}
+		expected := map[int]string{0: "MISS", 1: "HIT"}[i]
+		if got := w.Header().Get("X-Cache-Status"); got != expected {
+			t.Errorf("Request %d: expected X-Cache-Status %s, got %q", i, expected, got)
+		}
+	}
+
+	if calls != 1 {
+		t.Errorf("Expected 1 upstream call, got %d", calls)
+	}
+}
+
+func TestHandleProxy_HardBudgetServesCacheOnly(t *testing.T) {
+	mockAlchemy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte(`{"ownedNfts":[]}`))
+	}))
+	defer mockAlchemy.Close()
+
+	tracker, err := budget.NewTracker(budget.Options{
+		Cost:  func(string) int { return 100 },
+		Daily: budget.Limits{Hard: 100},
+	}, zap.NewNop())
+	if err != nil {
+		t.Fatalf("Failed to create budget tracker: %v", err)
+	}
+
+	baseURLs := map[string]string{
+		"eth-mainnet": mockAlchemy.URL,
+	}
+	client := alchemy.NewClient("test-api-key", baseURLs, httpclient.DefaultRetryOptions(), alchemy.WithUsageTracker(tracker))
+	server := NewServer(client, zap.NewNop(), WithCache(newTestCache(), 1<<20))
+
+	serve := func(owner string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/eth/mainnet/nft/v3/getNFTsForOwner?owner="+owner, nil)
+		req = mux.SetURLVars(req, map[string]string{
+			"chain":   "eth",
+			"network": "mainnet",
+		})
+		w := httptest.NewRecorder()
+		server.handleProxy(w, req)
+		return w
+	}
+
+	if w := serve("0x1"); w.Code != http.StatusOK {
+		t.Fatalf("Expected first request to succeed, got %d", w.Code)
+	}
+	if w := serve("0x1"); w.Code != http.StatusOK || w.Header().Get("X-Cache-Status") != "HIT" {
+		t.Errorf("Expected cached response past the hard budget, got %d %q", w.Code, w.Header().Get("X-Cache-Status"))
+	}
+
+	w := serve("0x2")
+	if w.Code != http.StatusServiceUnavailable {
+		t.Errorf("Expected miss to be rejected with 503, got %d", w.Code)
+	}
+	if w.Header().Get("Retry-After") == "" {
+		t.Error("Expected Retry-After header on budget rejection")
+	}
+}
+
+func TestHandleProxy_StreamsBeforeUpstreamFinishes(t *testing.T) {
+	release := make(chan struct{})
+	mockAlchemy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte(`{"owners":[`))
+		w.(http.Flusher).Flush()
+		<-release
+		w.Write([]byte(`]}`))
+	}))
+	defer mockAlchemy.Close()
+
+	baseURLs := map[string]string{
+		"eth-mainnet": mockAlchemy.URL,
+	}
+	client := alchemy.NewClient("test-api-key", baseURLs, httpclient.DefaultRetryOptions())
+	server := NewServer(client, zap.NewNop())
+
+	router := mux.NewRouter()
+	server.SetupRoutes(router)
+	proxy := httptest.NewServer(router)
+	defer proxy.Close()
+
+	resp, err := http.Get(proxy.URL + "/eth/mainnet/nft/v3/getOwnersForContract?contractAddress=0x1")
+	if err != nil {
+		t.Fatalf("Request failed: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d", resp.StatusCode)
+	}
+
+	chunk := make([]byte, len(`{"owners":[`))
+	if _, err := io.ReadFull(resp.Body, chunk); err != nil {
+		t.Fatalf("Expected first chunk before upstream finished: %v", err)
+	}
+	if string(chunk) != `{"owners":[` {
+		t.Errorf("Unexpected first chunk %q", chunk)
+	}
+
+	close(release)
+	rest, err := io.ReadAll(resp.Body)
+	if err != nil || string(rest) != `]}` {
+		t.Errorf("Expected remainder of the body, got %q (%v)", rest, err)
+	}
+}
+
+func TestHandleProxy_DoesNotCacheOversizedResponses(t *testing.T) {
+	calls := 0
+	payload := bytes.Repeat([]byte("x"), 2048)
+	server, _ := newCachedTestServer(t, func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.WriteHeader(http.StatusOK)
+		w.Write(payload)
+	}, WithCache(newTestCache(), 1024))
+
+	for i := 0; i < 2; i++ {
+		req := httptest.NewRequest(http.MethodGet, "/eth/mainnet/nft/v3/getOwnersForContract?contractAddress=0x1", nil)
+		req = mux.SetURLVars(req, map[string]string{
+			"chain":   "eth",
+			"network": "mainnet",
+		})
+		w := httptest.NewRecorder()
+
+		server.handleProxy(w, req)
+
+		if !bytes.Equal(w.Body.Bytes(), payload) {
+			t.Errorf("Request %d: expected full payload to be streamed, got %d bytes", i, w.Body.Len())
+		}
+	}
+
+	if calls != 2 {
+		t.Errorf("Expected oversized response not to be cached, got %d upstream calls", calls)
+	}
+}
+
+func TestHandleProxy_NegotiatesCompression(t *testing.T) {
+	payload := `{"ownedNfts":[]}`
+	var compressed bytes.Buffer
+	gz := gzip.NewWriter(&compressed)
+	gz.Write([]byte(payload))
+	gz.Close()
+
+	calls := 0
+	server, _ := newCachedTestServer(t, func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Content-Encoding", "gzip")
+		w.Header().Set("Set-Cookie", "session=upstream")
+		w.WriteHeader(http.StatusOK)
+		w.Write(compressed.Bytes())
+	})
+
+	tests := []struct {
+		name           string
+		acceptEncoding string
+		wantEncoding   string
+		wantCache      string
+	}{
+		{name: "gzip client on miss", acceptEncoding: "gzip", wantEncoding: "gzip", wantCache: "MISS"},
+		{name: "identity client on hit", acceptEncoding: "", wantEncoding: "", wantCache: "HIT"},
+		{name: "gzip client on hit", acceptEncoding: "br;q=1, gzip;q=0.5", wantEncoding: "gzip", wantCache: "HIT"},
+		{name: "gzip refused on hit", acceptEncoding: "gzip;q=0", wantEncoding: "", wantCache: "HIT"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/eth/mainnet/nft/v3/getNFTsForOwner?owner=0x123", nil)
+			req = mux.SetURLVars(req, map[string]string{
+				"chain":   "eth",
+				"network": "mainnet",
+			})
+			if tt.acceptEncoding != "" {
+				req.Header.Set("Accept-Encoding", tt.acceptEncoding)
+			}
+			w := httptest.NewRecorder()
+
+			server.handleProxy(w, req)
+
+			if got := w.Header().Get("X-Cache-Status"); got != tt.wantCache {
+				t.Errorf("Expected X-Cache-Status %s, got %q", tt.wantCache, got)
+			}
+			if got := w.Header().Get("Content-Encoding"); got != tt.wantEncoding {
+				t.Errorf("Expected Content-Encoding %q, got %q", tt.wantEncoding, got)
+			}
+			if got := w.Header().Get("Set-Cookie"); got != "" {
+				t.Errorf("Expected upstream Set-Cookie to be dropped, got %q", got)
+			}
+
+			body := w.Body.Bytes()
+			if tt.wantEncoding == "gzip" {
+				body, _ = decodeBody("gzip", body)
+			}
+			if string(body) != payload {
+				t.Errorf("Expected body %q, got %q", payload, body)
+			}
+		})
+	}
+
+	if calls != 1 {
+		t.Errorf("Expected 1 upstream call, got %d", calls)
+	}
+}
+
+func TestHandleProxy_ForwardsRateLimitHeaders(t *testing.T) {
+	mockAlchemy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Retry-After", "7")
+		w.Header().Set("X-Ratelimit-Remaining", "0")
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(`{"error":"bad owner"}`))
+	}))
+	defer mockAlchemy.Close()
+
+	baseURLs := map[string]string{
+		"eth-mainnet": mockAlchemy.URL,
+	}
+	client := alchemy.NewClient("test-api-key", baseURLs, httpclient.DefaultRetryOptions())
+	server := NewServer(client, zap.NewNop())
+
+	req := httptest.NewRequest(http.MethodGet, "/eth/mainnet/nft/v3/getNFTsForOwner?owner=nope", nil)
+	req = mux.SetURLVars(req, map[string]string{
+		"chain":   "eth",
+		"network": "mainnet",
+	})
+	w := httptest.NewRecorder()
+
+	server.handleProxy(w, req)
+
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("Expected status 400, got %d", w.Code)
+	}
+	if got := w.Header().Get("Retry-After"); got != "7" {
+		t.Errorf("Expected Retry-After 7, got %q", got)
+	}
+	if got := w.Header().Get("X-Ratelimit-Remaining"); got != "0" {
+		t.Errorf("Expected X-Ratelimit-Remaining 0, got %q", got)
+	}
+}
+
+func TestAcceptsEncoding(t *testing.T) {
+	tests := []struct {
+		header string
+		coding string
+		want   bool
+	}{
+		{header: "", coding: "", want: true},
+		{header: "", coding: "gzip", want: false},
+		{header: "gzip, deflate", coding: "gzip", want: true},
+		{header: "GZIP", coding: "gzip", want: true},
+		{header: "gzip;q=0", coding: "gzip", want: false},
+		{header: "*", coding: "br", want: true},
+		{header: "*, br;q=0", coding: "br", want: false},
+	}
+
+	for _, tt := range tests {
+		if got := acceptsEncoding(tt.header, tt.coding); got != tt.want {
+			t.Errorf("acceptsEncoding(%q, %q) = %v, want %v", tt.header, tt.coding, got, tt.want)
+		}
+	}
+}
+
+func TestHandleProxy_RecordsRequestMetrics(t *testing.T) {
+	mockAlchemy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer mockAlchemy.Close()
+
+	baseURLs := map[string]string{
+		"opt-mainnet":      mockAlchemy.URL,
+		"optimism-mainnet": mockAlchemy.URL,
+	}
+	client := alchemy.NewClient("test-api-key", baseURLs, httpclient.DefaultRetryOptions())
+	server := NewServer(client, zap.NewNop())
+
+	for _, path := range []string{"getNFTsForOwner", "notARealMethod"} {
+		req := httptest.NewRequest(http.MethodGet, "/optimism/mainnet/nft/v3/"+path, nil)
+		req = mux.SetURLVars(req, map[string]string{
+			"chain":   "optimism",
+			"network": "mainnet",
+		})
+		server.handleProxy(httptest.NewRecorder(), req)
+	}
+
+	families, err := prometheus.DefaultGatherer.Gather()
+	if err != nil {
+		t.Fatalf("Failed to gather metrics: %v", err)
+	}
+
+	counts := map[string]float64{}
+	for _, family := range families {
+		if family.GetName() != "nft_proxy_http_requests_total" && family.GetName() != "nft_proxy_upstream_requests_total" {
+			continue
+		}
+		for _, metric := range family.GetMetric() {
+			labels := map[string]string{}
+			for _, pair := range metric.GetLabel() {
+				labels[pair.GetName()] = pair.GetValue()
+			}
+			if labels["chain"] != "opt-mainnet" {
+				continue
+			}
+			key := family.GetName() + "/" + labels["endpoint"] + "/" + labels["status_class"]
+			counts[key] += metric.GetCounter().GetValue()
+		}
+	}
+
+	for _, key := range []string{
+		"nft_proxy_http_requests_total/getNFTsForOwner/4xx",
+		"nft_proxy_http_requests_total/other/4xx",
+		"nft_proxy_upstream_requests_total/getNFTsForOwner/4xx",
+		"nft_proxy_upstream_requests_total/other/4xx",
+	} {
+		if counts[key] != 1 {
+			t.Errorf("Expected %s to be 1, got %v", key, counts[key])
+		}
+	}
+}
+
+func TestMetricsServer_InspectsCache(t *testing.T) {
+	responseCache := cache.New(zap.NewNop(), cache.Rules{
+		Default:   cache.Rule{TTL: time.Minute},
+		Endpoints: map[string]cache.Rule{"getNFTSales": {TTL: 0}},
+	}, cache.NewMemory(10, 0))
+
+	server, _ := newCachedTestServer(t, func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte(`{"ownedNfts":[]}`))
+	}, WithCache(responseCache, 1<<20))
+	metricsServer := NewMetricsServer(zap.NewNop(), WithCacheInspector(server))
+
+	inspect := func(target string) (int, CacheInspection) {
+		req := httptest.NewRequest(http.MethodGet, "/admin/cache/inspect?url="+url.QueryEscape(target), nil)
+		w := httptest.NewRecorder()
+		metricsServer.Handler().ServeHTTP(w, req)
+
+		var inspection CacheInspection
+		json.NewDecoder(w.Body).Decode(&inspection)
+		return w.Code, inspection
+	}
+
+	code, before := inspect("/ethereum/mainnet/nft/v3/getNFTsForOwner?owner=0x123")
+	if code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d", code)
+	}
+	if before.Chain != "eth-mainnet" || !before.Cacheable || len(before.Tiers) != 1 || before.Tiers[0].Present {
+		t.Fatalf("Unexpected inspection before request: %+v", before)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/eth/mainnet/nft/v3/getNFTsForOwner?owner=0x123", nil)
+	req = mux.SetURLVars(req, map[string]string{
+		"chain":   "eth",
+		"network": "mainnet",
+	})
+	server.handleProxy(httptest.NewRecorder(), req)
+
+	_, after := inspect("/ethereum/mainnet/nft/v3/getNFTsForOwner?owner=0x123")
+	if after.Key != before.Key {
+		t.Errorf("Expected a stable cache key, got %q and %q", before.Key, after.Key)
+	}
+	if !after.Tiers[0].Present || after.Tiers[0].TTLRemaining <= 0 || after.Tiers[0].TTLRemaining > 60 {
+		t.Errorf("Expected fresh entry in L1, got %+v", after.Tiers[0])
+	}
+
+	if _, sales := inspect("/eth/mainnet/nft/v3/getNFTSales"); sales.Cacheable {
+		t.Error("Expected endpoint with zero TTL to be reported as not cacheable")
+	}
+	if code, _ := inspect("/eth/mainnet/getNFTsForOwner"); code != http.StatusBadRequest {
+		t.Errorf("Expected status 400 for a non-proxy URL, got %d", code)
+	}
+}
+
+func TestSetupRoutes_MountsMetricsBehindBearerToken(t *testing.T) {
+	client := alchemy.NewClient("test-api-key", map[string]string{}, httpclient.DefaultRetryOptions())
+	server := NewServer(client, zap.NewNop())
+	metricsServer := NewMetricsServer(zap.NewNop(), WithBearerToken("secret"))
+	server.MountAdmin(metricsServer.Handler())
+
+	router := mux.NewRouter()
+	server.SetupRoutes(router)
+
+	tests := []struct {
+		name          string
+		path          string
+		authorization string
+		expected      int
+	}{
+		{name: "metrics without token", path: "/metrics", expected: http.StatusUnauthorized},
+		{name: "metrics with wrong token", path: "/metrics", authorization: "Bearer wrong", expected: http.StatusUnauthorized},
+		{name: "metrics with token", path: "/metrics", authorization: "Bearer secret", expected: http.StatusOK},
+		{name: "admin without token", path: "/admin/cache/inspect", expected: http.StatusUnauthorized},
+		{name: "health stays open", path: "/health", expected: http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, tt.path, nil)
+			if tt.authorization != "" {
+				req.Header.Set("Authorization", tt.authorization)
+			}
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			if w.Code != tt.expected {
+				t.Errorf("Expected status %d, got %d", tt.expected, w.Code)
+			}
+		})
+	}
+}
+
+func TestHandleProxy_TracesRequest(t *testing.T) {
+	exporter := tracetest.NewInMemoryExporter()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+	otel.SetTracerProvider(provider)
+	otel.SetTextMapPropagator(tracing.Propagator())
+	defer func() {
+		otel.SetTracerProvider(noop.NewTracerProvider())
+		otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator())
+	}()
+
+	calls := 0
+	mockAlchemy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		if calls == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte(`{"ownedNfts":[]}`))
+	}))
+	defer mockAlchemy.Close()
+
+	const apiKey = "secret-api-key"
+	retryOpts := httpclient.RetryOptions{MaxRetries: 2, BaseBackoff: time.Millisecond, ConnectionTimeout: time.Second, RequestTimeout: time.Second}
+	client := alchemy.NewClient(apiKey, map[string]string{"eth-mainnet": mockAlchemy.URL}, retryOpts)
+	server := NewServer(client, zap.NewNop(), WithCache(newTestCache(), 1<<20))
+
+	const traceID = "4bf92f3577b34da6a3ce929d0e0e4736"
+	req := httptest.NewRequest(http.MethodGet, "/eth/mainnet/nft/v3/getNFTsForOwner?owner=0x123", nil)
+	req.Header.Set("traceparent", "00-"+traceID+"-00f067aa0ba902b7-01")
+	req = mux.SetURLVars(req, map[string]string{
+		"chain":   "eth",
+		"network": "mainnet",
+	})
+	server.handleProxy(httptest.NewRecorder(), req)
+
+	counts := map[string]int{}
+	for _, span := range exporter.GetSpans() {
+		counts[span.Name]++
+		if got := span.SpanContext.TraceID().String(); got != traceID {
+			t.Errorf("Span %s: expected trace %s from traceparent, got %s", span.Name, traceID, got)
+		}
+		for _, attr := range span.Attributes {
+			if strings.Contains(attr.Value.Emit(), apiKey) {
+				t.Errorf("Span %s: attribute %s leaks the API key", span.Name, attr.Key)
+			}
+		}
+	}
+
+	expected := map[string]int{
+		"GET getNFTsForOwner": 1,
+		"cache.get":           1,
+		"alchemy.request":     1,
+		"alchemy.attempt":     2,
+		"cache.set":           1,
+	}
+	for name, count := range expected {
+		if counts[name] != count {
+			t.Errorf("Expected %d %q spans, got %d (all spans: %v)", count, name, counts[name], counts)
+		}
+	}
+}
+
+func TestAccessLog_RecordsRequest(t *testing.T) {
+	core, logs := observer.New(zap.InfoLevel)
+
+	server, _ := newCachedTestServer(t, func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte(`{"ownedNfts":[]}`))
+	}, WithAccessLog(zap.New(core), 1))
+
+	router := mux.NewRouter()
+	server.SetupRoutes(router)
+
+	req := httptest.NewRequest(http.MethodGet, "/eth/mainnet/nft/v3/getNFTsForOwner?owner=0x123&token=secret", nil)
+	req.Header.Set("X-Request-ID", "req-123")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	if got := w.Header().Get("X-Request-ID"); got != "req-123" {
+		t.Errorf("Expected request ID to be echoed, got %q", got)
+	}
+
+	entries := logs.All()
+	if len(entries) != 1 {
+		t.Fatalf("Expected 1 access log entry, got %d", len(entries))
+	}
+	fields := entries[0].ContextMap()
+	expected := map[string]interface{}{
+		"request_id":        "req-123",
+		"chain":             "eth-mainnet",
+		"endpoint":          "getNFTsForOwner",
+		"status":            int64(http.StatusOK),
+		"cache":             "MISS",
+		"upstream_attempts": int64(1),
+		"bytes":             int64(len(`{"ownedNfts":[]}`)),
+		"query":             "owner=0x123&token=REDACTED",
+	}
+	for key, value := range expected {
+		if fields[key] != value {
+			t.Errorf("Expected %s=%v, got %v", key, value, fields[key])
+		}
+	}
+}
+
+func TestAccessLog_SamplesSuccessfulRequests(t *testing.T) {
+	mockAlchemy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer mockAlchemy.Close()
+
+	client := alchemy.NewClient("test-api-key", map[string]string{"eth-mainnet": mockAlchemy.URL}, httpclient.DefaultRetryOptions())
+	core, logs := observer.New(zap.InfoLevel)
+	server := NewServer(client, zap.NewNop(), WithAccessLog(zap.New(core), 0))
+
+	router := mux.NewRouter()
+	server.SetupRoutes(router)
+
+	for _, path := range []string{"/eth/mainnet/nft/v3/getNFTsForOwner", "/unknown/mainnet/nft/v3/getNFTsForOwner"} {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+
+		if got := w.Header().Get("X-Request-ID"); len(got) != 32 {
+			t.Errorf("Expected a generated 32 character request ID, got %q", got)
+		}
+	}
+
+	entries := logs.All()
+	if len(entries) != 1 || entries[0].ContextMap()["status"] != int64(http.StatusBadGateway) {
+		t.Errorf("Expected only the failed request to be logged, got %d entries", len(entries))
+	}
+}
+
+func TestRedactQuery(t *testing.T) {
+	tests := []struct {
+		query    string
+		expected string
+	}{
+		{query: "", expected: ""},
+		{query: "owner=0x1", expected: "owner=0x1"},
+		{query: "jwt=abc&owner=0x1", expected: "jwt=REDACTED&owner=0x1"},
+		{query: "Access_Token=abc", expected: "Access_Token=REDACTED"},
+		{query: "owner=0x1&token", expected: "owner=0x1&token"},
+	}
+
+	for _, tt := range tests {
+		if got := redactQuery(tt.query); got != tt.expected {
+			t.Errorf("redactQuery(%q) = %q, want %q", tt.query, got, tt.expected)
+		}
+	}
+}
+
+func TestHandleProxy_DoesNotLogAPIKey(t *testing.T) {
+	// A closed server makes the upstream call fail with an error quoting the URL
+	mockAlchemy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	mockAlchemy.Close()
+
+	const apiKey = "secret-api-key"
+	retryOpts := httpclient.RetryOptions{MaxRetries: 1, BaseBackoff: time.Millisecond, ConnectionTimeout: time.Second, RequestTimeout: time.Second}
+	client := alchemy.NewClient(apiKey, map[string]string{"eth-mainnet": mockAlchemy.URL}, retryOpts)
+	core, logs := observer.New(zap.DebugLevel)
+	logger := zap.New(core)
+	server := NewServer(client, logger, WithAccessLog(logger, 1))
+
+	router := mux.NewRouter()
+	server.SetupRoutes(router)
+
+	for _, method := range []string{http.MethodGet, http.MethodPost} {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(method, "/eth/mainnet/nft/v3/getNFTMetadataBatch", strings.NewReader(`{"tokens":[]}`)))
+
+		if w.Code != http.StatusBadGateway {
+			t.Errorf("%s: expected status 502, got %d", method, w.Code)
+		}
+		if strings.Contains(w.Body.String(), apiKey) {
+			t.Errorf("%s: response leaks the API key", method)
+		}
+	}
+
+	if logs.Len() == 0 {
+		t.Fatal("Expected the failures to be logged")
+	}
+	for _, entry := range logs.All() {
+		if rendered := fmt.Sprint(entry.Message, entry.ContextMap()); strings.Contains(rendered, apiKey) {
+			t.Errorf("Log entry leaks the API key: %s", rendered)
+		}
+	}
+}
+
+func TestReady_ReportsFailingComponents(t *testing.T) {
+	client := alchemy.NewClient("test-api-key", map[string]string{}, httpclient.DefaultRetryOptions())
+	checker := health.NewChecker(time.Second)
+	checker.Add("config", func(context.Context) (any, error) { return nil, nil })
+	failing := true
+	checker.Add("l2_cache", func(context.Context) (any, error) {
+		if failing {
+			return nil, errors.New("connection refused")
+		}
+		return nil, nil
+	})
+
+	server := NewServer(client, zap.NewNop(), WithReadiness(checker))
+	router := mux.NewRouter()
+	server.SetupRoutes(router)
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/ready", nil))
+	if w.Code != http.StatusServiceUnavailable {
+		t.Fatalf("Expected status 503, got %d", w.Code)
+	}
+	var report health.Report
+	if err := json.NewDecoder(w.Body).Decode(&report); err != nil {
+		t.Fatalf("Failed to decode report: %v", err)
+	}
+	if report.Ready || report.Components["l2_cache"].Error != "connection refused" || report.Components["config"].Status != health.StatusOK {
+		t.Errorf("Unexpected report %+v", report)
+	}
+
+	failing = false
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/ready", nil))
+	if w.Code != http.StatusOK {
+		t.Errorf("Expected status 200 once every check passes, got %d", w.Code)
+	}
+}
+
+func TestMetricsServer_PurgesCache(t *testing.T) {
+	mockAlchemy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte(`{"ownedNfts":[]}`))
+	}))
+	defer mockAlchemy.Close()
+
+	baseURLs := map[string]string{
+		"eth-mainnet":  mockAlchemy.URL,
+		"base-mainnet": mockAlchemy.URL + "/base",
+	}
+	client := alchemy.NewClient("test-api-key", baseURLs, httpclient.DefaultRetryOptions())
+	server := NewServer(client, zap.NewNop(), WithCache(newTestCache(), 1<<20))
+	metricsServer := NewMetricsServer(zap.NewNop(), WithCachePurger(server))
+
+	fetch := func(chain, target string) string {
+		req := httptest.NewRequest(http.MethodGet, "/"+chain+"/mainnet/nft/v3"+target, nil)
+		req = mux.SetURLVars(req, map[string]string{"chain": chain, "network": "mainnet"})
+		w := httptest.NewRecorder()
+		server.handleProxy(w, req)
+		return w.Header().Get("X-Cache-Status")
+	}
+	purge := func(query string) (int, CachePurge) {
+		w := httptest.NewRecorder()
+		metricsServer.Handler().ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/admin/cache/purge?"+query, nil))
+		var purge CachePurge
+		json.NewDecoder(w.Body).Decode(&purge)
+		return w.Code, purge
+	}
+
+	fetch("eth", "/getNFTsForOwner?owner=0xAbC")
+	fetch("base", "/getNFTsForOwner?owner=0xabc")
+	fetch("eth", "/getNFTsForContract?contractAddress=0x1")
+
+	code, result := purge("owner=0xABC")
+	if code != http.StatusOK || result.Purged != 2 {
+		t.Fatalf("Expected both chains' entries of the owner to be purged, got %d %+v", code, result)
+	}
+	if status := fetch("eth", "/getNFTsForContract?contractAddress=0x1"); status != "HIT" {
+		t.Errorf("Expected unrelated entry to stay cached, got %s", status)
+	}
+
+	if _, result := purge("chain=eth-mainnet"); result.Purged != 1 {
+		t.Errorf("Expected chain purge to remove the contract entry, got %+v", result)
+	}
+	if code, _ := purge("owner=0x1&contract=0x1"); code != http.StatusBadRequest {
+		t.Errorf("Expected status 400 for two selectors, got %d", code)
+	}
+	if code, _ := purge("chain=unknown-chain"); code != http.StatusBadRequest {
+		t.Errorf("Expected status 400 for an unknown chain, got %d", code)
+	}
+}
+
+func TestAlchemyWebhook_InvalidatesTransferredHoldings(t *testing.T) {
+	responseCache := cache.New(zap.NewNop(), cache.Rules{Default: cache.Rule{TTL: time.Hour}}, cache.NewMemory(10, 0))
+
+	server, _ := newCachedTestServer(t, func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte(`{}`))
+	}, WithCache(responseCache, 1<<20), WithAlchemyWebhook([]string{"old-key", "signing-key"}))
+	router := mux.NewRouter()
+	server.SetupRoutes(router)
+
+	fetch := func(target string) string {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/eth/mainnet/nft/v3"+target, nil))
+		return w.Header().Get("X-Cache-Status")
+	}
+	deliver := func(payload, key string) *httptest.ResponseRecorder {
+		mac := hmac.New(sha256.New, []byte(key))
+		mac.Write([]byte(payload))
+		req := httptest.NewRequest(http.MethodPost, "/webhooks/alchemy", strings.NewReader(payload))
+		req.Header.Set("X-Alchemy-Signature", hex.EncodeToString(mac.Sum(nil)))
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	targets := []string{
+		"/getNFTsForOwner?owner=0xAAA",
+		"/getNFTsForOwner?owner=0xbbb",
+		"/getContractsForOwner?owner=0xaaa",
+		"/getOwnersForContract?contractAddress=0xC",
+		"/getContractMetadata?contractAddress=0xc",
+	}
+	for _, target := range targets {
+		fetch(target)
+	}
+
+	payload := `{"id":"whevt_1","type":"NFT_ACTIVITY","event":{"network":"ETH_MAINNET","activity":[` +
+		`{"fromAddress":"0xaaa","toAddress":"0xBBB","contractAddress":"0xC"}]}}`
+
+	if w := deliver(payload, "wrong-key"); w.Code != http.StatusUnauthorized {
+		t.Fatalf("Expected status 401 for a bad signature, got %d", w.Code)
+	}
+	w := deliver(payload, "signing-key")
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d", w.Code)
+	}
+	var response map[string]int
+	json.NewDecoder(w.Body).Decode(&response)
+	if response["invalidated"] != 3 {
+		t.Errorf("Expected 3 entries invalidated, got %d", response["invalidated"])
+	}
+
+	want := []string{"MISS", "MISS", "HIT", "MISS", "HIT"}
+	for i, target := range targets {
+		if status := fetch(target); status != want[i] {
+			t.Errorf("Expected %s for %s after the webhook, got %s", want[i], target, status)
+		}
+	}
+}
+
+func TestPrefetch_FillsCacheForHotKeys(t *testing.T) {
+	upstreamCalls := 0
+	tracker := warmup.NewTracker(10)
+
+	server, responseCache := newCachedTestServer(t, func(w http.ResponseWriter, r *http.Request) {
+		upstreamCalls++
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte(`{"ownedNfts":[]}`))
+	}, WithHotKeyTracker(tracker))
+
+	req := httptest.NewRequest(http.MethodGet, "/eth/mainnet/nft/v3/getNFTsForOwner?owner=0x1&token=secret", nil)
+	req = mux.SetURLVars(req, map[string]string{"chain": "eth", "network": "mainnet"})
+	server.handleProxy(httptest.NewRecorder(), req)
+
+	top := tracker.Top(1)
+	if len(top) != 1 || strings.Contains(top[0].Request.RawQuery, "secret") {
+		t.Fatalf("Expected the request to be tracked without its token, got %+v", top)
+	}
+	if remaining := server.Remaining(context.Background(), top[0].Request); remaining <= 0 {
+		t.Fatalf("Expected the tracked request to map to the cached entry")
+	}
+
+	responseCache.PurgeKey(context.Background(), top[0].Key)
+	if err := server.Prefetch(context.Background(), top[0].Request); err != nil {
+		t.Fatalf("Prefetch failed: %v", err)
+	}
+	if upstreamCalls != 2 {
+		t.Errorf("Expected prefetch to call upstream, got %d calls", upstreamCalls)
+	}
+
+	w := httptest.NewRecorder()
+	server.handleProxy(w, req)
+	if w.Header().Get("X-Cache-Status") != "HIT" || w.Body.String() != `{"ownedNfts":[]}` {
+		t.Errorf("Expected prefetched response to be served from cache, got %s %q", w.Header().Get("X-Cache-Status"), w.Body.String())
+	}
+}
+
+func TestMetricsServer_ExportsAndImportsSnapshots(t *testing.T) {
+	client := alchemy.NewClient("test-api-key", map[string]string{}, httpclient.DefaultRetryOptions())
+	rules := cache.Rules{Default: cache.Rule{TTL: time.Minute}}
+
+	sourceCache := cache.New(zap.NewNop(), rules, cache.NewMemory(10, 0))
+	sourceCache.Set(context.Background(), "nft:v1:eth-mainnet:getNFTsForOwner:a", "getNFTsForOwner", &cache.Entry{StatusCode: http.StatusOK, Body: []byte("{}")})
+	source := NewMetricsServer(zap.NewNop(), WithCacheSnapshots(NewServer(client, zap.NewNop(), WithCache(sourceCache, 1<<20))))
+
+	w := httptest.NewRecorder()
+	source.Handler().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/admin/cache/snapshot", nil))
+	if w.Code != http.StatusOK || w.Header().Get("Content-Type") != "application/gzip" {
+		t.Fatalf("Expected gzip snapshot, got %d %s", w.Code, w.Header().Get("Content-Type"))
+	}
+
+	targetCache := cache.New(zap.NewNop(), rules, cache.NewMemory(10, 0))
+	target := NewMetricsServer(zap.NewNop(), WithCacheSnapshots(NewServer(client, zap.NewNop(), WithCache(targetCache, 1<<20))))
+
+	imported := httptest.NewRecorder()
+	target.Handler().ServeHTTP(imported, httptest.NewRequest(http.MethodPost, "/admin/cache/snapshot", w.Body))
+	if imported.Code != http.StatusOK {
+		t.Fatalf("Expected status 200 on import, got %d: %s", imported.Code, imported.Body.String())
+	}
+	if _, _, ok := targetCache.Get(context.Background(), "nft:v1:eth-mainnet:getNFTsForOwner:a", "getNFTsForOwner"); !ok {
+		t.Error("Expected imported entry in the target cache")
+	}
+
+	bad := httptest.NewRecorder()
+	target.Handler().ServeHTTP(bad, httptest.NewRequest(http.MethodPost, "/admin/cache/snapshot", strings.NewReader("nope")))
+	if bad.Code != http.StatusBadRequest {
+		t.Errorf("Expected status 400 for an invalid snapshot, got %d", bad.Code)
+	}
+}
+
+func TestHandleProxy_CachesDeterministicErrors(t *testing.T) {
+	calls := map[string]int{}
+	mockAlchemy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		owner := r.URL.Query().Get("owner")
+		calls[owner]++
+		w.Header().Set("Content-Type", "application/json")
+		switch owner {
+		case "0x404":
+			w.WriteHeader(http.StatusNotFound)
+		default:
+			w.WriteHeader(http.StatusTooManyRequests)
+		}
+		w.Write([]byte(`{"error":"nope"}`))
+	}))
+	defer mockAlchemy.Close()
+
+	retryOpts := httpclient.RetryOptions{MaxRetries: 0, ConnectionTimeout: time.Second, RequestTimeout: time.Second}
+	client := alchemy.NewClient("test-api-key", map[string]string{"eth-mainnet": mockAlchemy.URL}, retryOpts)
+	responseCache := cache.New(zap.NewNop(), cache.Rules{Default: cache.Rule{
+		TTL:         time.Minute,
+		NegativeTTL: map[int]time.Duration{http.StatusNotFound: time.Minute},
+	}}, cache.NewMemory(10, 0))
+	server := NewServer(client, zap.NewNop(), WithCache(responseCache, 1<<20))
+
+	for _, owner := range []string{"0x404", "0x429"} {
+		for i := range 2 {
+			req := httptest.NewRequest(http.MethodGet, "/eth/mainnet/nft/v3/getNFTsForOwner?owner="+owner, nil)
+			req = mux.SetURLVars(req, map[string]string{"chain": "eth", "network": "mainnet"})
+			w := httptest.NewRecorder()
+
+			server.handleProxy(w, req)
+
+			if owner == "0x404" && w.Code != http.StatusNotFound {
+				t.Errorf("Request %d for %s: expected status 404, got %d", i, owner, w.Code)
+			}
+			if owner == "0x404" && i == 1 && w.Header().Get("X-Cache-Status") != "HIT" {
+				t.Errorf("Expected repeated 404 to be served from the cache")
+			}
+		}
+	}
+
+	if calls["0x404"] != 1 {
+		t.Errorf("Expected 1 upstream call for the 404, got %d", calls["0x404"])
+	}
+	if calls["0x429"] != 2 {
+		t.Errorf("Expected 429 never to be cached, got %d upstream calls", calls["0x429"])
+	}
+}
+
+func TestHandleProxy_ConditionalRequests(t *testing.T) {
+	server, _ := newCachedTestServer(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte(`{"ownedNfts":[]}`))
+	})
+
+	serve := func(ifNoneMatch string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/eth/mainnet/nft/v3/getNFTsForOwner?owner=0x123", nil)
+		req = mux.SetURLVars(req, map[string]string{"chain": "eth", "network": "mainnet"})
+		if ifNoneMatch != "" {
+			req.Header.Set("If-None-Match", ifNoneMatch)
+		}
+		w := httptest.NewRecorder()
+		server.handleProxy(w, req)
+		return w
+	}
+
+	miss := serve("")
+	if got := miss.Header().Get("Cache-Control"); got != "private, max-age=60" {
+		t.Errorf("Expected Cache-Control from the TTL rule on a miss, got %q", got)
+	}
+	if got := miss.Header().Get("Age"); got != "0" {
+		t.Errorf("Expected Age 0 on a miss, got %q", got)
+	}
+
+	hit := serve("")
+	etag := hit.Header().Get("ETag")
+	if hit.Code != http.StatusOK || !strings.HasPrefix(etag, `"`) {
+		t.Fatalf("Expected cache hit with a strong ETag, got status %d ETag %q", hit.Code, etag)
+	}
+	if got := miss.Header().Get("ETag"); got != etag {
+		t.Errorf("Expected the miss to carry the hit's ETag %q, got %q", etag, got)
+	}
+	if got := hit.Header().Get("Cache-Control"); got != "private, max-age=60" {
+		t.Errorf("Expected Cache-Control from the stored entry, got %q", got)
+	}
+
+	notModified := serve(`"stale", W/` + etag)
+	if notModified.Code != http.StatusNotModified {
+		t.Fatalf("Expected 304 for a matching If-None-Match, got %d", notModified.Code)
+	}
+	if notModified.Body.Len() != 0 || notModified.Header().Get("ETag") != etag {
+		t.Errorf("Expected empty 304 carrying the ETag, got %q and ETag %q", notModified.Body.String(), notModified.Header().Get("ETag"))
+	}
+
+	if changed := serve(`"other"`); changed.Code != http.StatusOK || changed.Body.Len() == 0 {
+		t.Errorf("Expected full response for a stale ETag, got status %d", changed.Code)
+	}
+}
+
+func TestHandleProxy_StreamsLargeMissWithETagTrailer(t *testing.T) {
+	// Random hex compresses to about half, so the gzipped body is still
+	// too large to buffer
+	random := make([]byte, maxBufferedBytes)
+	rand.Read(random)
+	body := `{"ownedNfts":"` + hex.EncodeToString(random) + `"}`
+	calls := 0
+	server, _ := newCachedTestServer(t, func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Content-Encoding", "gzip")
+		w.WriteHeader(http.StatusOK)
+		gz := gzip.NewWriter(w)
+		gz.Write([]byte(body))
+		gz.Close()
+	})
+
+	// The client does not accept gzip, so the miss is decoded as it streams
+	serve := func(ifNoneMatch string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/eth/mainnet/nft/v3/getNFTsForOwner?owner=0x123", nil)
+		req = mux.SetURLVars(req, map[string]string{"chain": "eth", "network": "mainnet"})
+		if ifNoneMatch != "" {
+			req.Header.Set("If-None-Match", ifNoneMatch)
+		}
+		w := httptest.NewRecorder()
+		server.handleProxy(w, req)
+		return w
+	}
+
+	miss := serve("")
+	etag := miss.Result().Trailer.Get("ETag")
+	if miss.Header().Get("X-Cache-Status") != "MISS" || etag == "" {
+		t.Fatalf("Expected a streamed miss with an ETag trailer, got %q and %q", miss.Header().Get("X-Cache-Status"), etag)
+	}
+	if miss.Body.String() != body {
+		t.Errorf("Expected the whole body streamed decoded, got %d bytes", miss.Body.Len())
+	}
+
+	hit := serve(etag)
+	if hit.Code != http.StatusNotModified || hit.Header().Get("X-Cache-Status") != "HIT" {
+		t.Errorf("Expected the miss's ETag to get 304 from the cache, got %d (%s)", hit.Code, hit.Header().Get("X-Cache-Status"))
+	}
+	if calls != 1 {
+		t.Errorf("Expected 1 upstream call, got %d", calls)
+	}
+}
+
+func TestHandleProxy_ProjectsCachedResponses(t *testing.T) {
+	calls := 0
+	server, _ := newCachedTestServer(t, func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		if r.URL.Query().Has("fields") {
+			t.Errorf("Expected fields not to be sent upstream, got %q", r.URL.RawQuery)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Content-Encoding", "gzip")
+		w.WriteHeader(http.StatusOK)
+		gz := gzip.NewWriter(w)
+		gz.Write([]byte(`{"ownedNfts":[{"tokenId":"1","name":"Ape","raw":{"metadata":{"big":true}}}],"pageKey":"k"}`))
+		gz.Close()
+	},
+		WithProjectionPresets(map[string][]string{"ids": {"ownedNfts.tokenId"}}))
+
+	tests := []struct {
+		fields   string
+		expected string
+	}{
+		{fields: "ownedNfts.name,pageKey", expected: `{"ownedNfts":[{"name":"Ape"}],"pageKey":"k"}`},
+		{fields: "@ids", expected: `{"ownedNfts":[{"tokenId":"1"}]}`},
+		{fields: "@unknown"},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(http.MethodGet, "/eth/mainnet/nft/v3/getNFTsForOwner?owner=0x123&fields="+url.QueryEscape(tt.fields), nil)
+		req = mux.SetURLVars(req, map[string]string{"chain": "eth", "network": "mainnet"})
+		w := httptest.NewRecorder()
+
+		server.handleProxy(w, req)
+
+		if tt.expected == "" {
+			if w.Code != http.StatusBadRequest {
+				t.Errorf("fields=%s: expected status 400, got %d", tt.fields, w.Code)
+			}
+			continue
+		}
+		if w.Code != http.StatusOK || w.Body.String() != tt.expected {
+			t.Errorf("fields=%s: expected 200 %s, got %d %s", tt.fields, tt.expected, w.Code, w.Body.String())
+		}
+		if w.Header().Get("ETag") == "" {
+			t.Errorf("fields=%s: expected projected response to carry an ETag", tt.fields)
+		}
+	}
+
+	if calls != 1 {
+		t.Errorf("Expected projections to share one cache entry, got %d upstream calls", calls)
+	}
+}
+
+func TestHandleProxy_FiltersSpam(t *testing.T) {
+	calls := 0
+	lists := filepath.Join(t.TempDir(), "spam_lists.yaml")
+	if err := os.WriteFile(lists, []byte("deny: [0xbad]\n"), 0o644); err != nil {
+		t.Fatalf("Failed to write spam lists: %v", err)
+	}
+	filter, err := spam.New(spam.Options{Mode: spam.ModeDrop, ListsFile: lists, ReloadInterval: time.Hour}, zap.NewNop())
+	if err != nil {
+		t.Fatalf("Failed to create spam filter: %v", err)
+	}
+
+	server, _ := newCachedTestServer(t, func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte(`{"ownedNfts":[{"tokenId":"1","contract":{"address":"0xAAA"}},{"tokenId":"2","contract":{"address":"0xBAD"}}]}`))
+	}, WithSpamFilter(filter))
+
+	for i := range 2 {
+		req := httptest.NewRequest(http.MethodGet, "/eth/mainnet/nft/v3/getNFTsForOwner?owner=0x123", nil)
+		req = mux.SetURLVars(req, map[string]string{"chain": "eth", "network": "mainnet"})
+		w := httptest.NewRecorder()
+
+		server.handleProxy(w, req)
+
+		if expected := `{"ownedNfts":[{"contract":{"address":"0xAAA"},"tokenId":"1"}]}`; w.Body.String() != expected {
+			t.Errorf("Request %d: expected %s, got %s", i, expected, w.Body.String())
+		}
+	}
+	if calls != 1 {
+		t.Errorf("Expected the unfiltered response to be cached, got %d upstream calls", calls)
+	}
+}
+
+func TestHandleProxy_EnforcesTenantPolicies(t *testing.T) {
+	calls := 0
+	tenants, err := tenant.New(tenant.Options{Policies: []tenant.Policy{{
+		Name:              "wallet",
+		Identities:        []string{"basic:wallet"},
+		Endpoints:         []string{"getNFTsForOwner"},
+		DailyComputeUnits: 1,
+	}}})
+	if err != nil {
+		t.Fatalf("Failed to create tenants: %v", err)
+	}
+
+	server, _ := newCachedTestServer(t, func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte(`{"ownedNfts":[]}`))
+	}, WithTenants(tenants))
+
+	tests := []struct {
+		name     string
+		identity string
+		path     string
+		status   int
+	}{
+		{"unknown identity", "basic:other", "/eth/mainnet/nft/v3/getNFTsForOwner?owner=0x1", http.StatusForbidden},
+		{"disallowed endpoint", "basic:wallet", "/eth/mainnet/nft/v3/getOwnersForContract?contractAddress=0x1", http.StatusForbidden},
+		{"first miss", "basic:wallet", "/eth/mainnet/nft/v3/getNFTsForOwner?owner=0x1", http.StatusOK},
+		{"hit after budget is spent", "basic:wallet", "/eth/mainnet/nft/v3/getNFTsForOwner?owner=0x1", http.StatusOK},
+		{"miss after budget is spent", "basic:wallet", "/eth/mainnet/nft/v3/getNFTsForOwner?owner=0x2", http.StatusTooManyRequests},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(http.MethodGet, tt.path, nil)
+		req = mux.SetURLVars(req, map[string]string{"chain": "eth", "network": "mainnet"})
+		req.Header.Set(tenant.Header, tt.identity)
+		w := httptest.NewRecorder()
+
+		server.handleProxy(w, req)
+
+		if w.Code != tt.status {
+			t.Errorf("%s: expected status %d, got %d", tt.name, tt.status, w.Code)
+		}
+		if tt.status == http.StatusTooManyRequests && w.Header().Get("Retry-After") == "" {
+			t.Errorf("%s: expected a Retry-After header", tt.name)
+		}
+	}
+	if calls != 1 {
+		t.Errorf("Expected one upstream call, got %d", calls)
+	}
+}
+
+func TestHandleProxy_RateLimitsClients(t *testing.T) {
+	rateLimit, err := ratelimit.New(ratelimit.Options{Requests: 1, Period: time.Hour, Burst: 2, HitCost: 0.5}, ratelimit.NewMemory())
+	if err != nil {
+		t.Fatalf("Failed to create rate limit: %v", err)
+	}
+
+	server, _ := newCachedTestServer(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte(`{"ownedNfts":[]}`))
+	}, WithRateLimit(rateLimit))
+
+	// A miss costs 1 and two hits cost 0.5 each, using up the burst of 2
+	tests := []struct {
+		realIP    string
+		status    int
+		remaining string
+	}{
+		{"10.0.0.1", http.StatusOK, "1"},
+		{"10.0.0.1", http.StatusOK, "0"},
+		{"10.0.0.1", http.StatusOK, "0"},
+		{"10.0.0.1", http.StatusTooManyRequests, "0"},
+		{"10.0.0.2", http.StatusOK, "1"},
+	}
+	for i, tt := range tests {
+		req := httptest.NewRequest(http.MethodGet, "/eth/mainnet/nft/v3/getNFTsForOwner?owner=0x1", nil)
+		req = mux.SetURLVars(req, map[string]string{"chain": "eth", "network": "mainnet"})
+		req.Header.Set("X-Real-IP", tt.realIP)
+		w := httptest.NewRecorder()
+
+		server.handleProxy(w, req)
+
+		if w.Code != tt.status {
+			t.Errorf("Request %d: expected status %d, got %d", i, tt.status, w.Code)
+		}
+		if got := w.Header().Get("X-RateLimit-Remaining"); got != tt.remaining {
+			t.Errorf("Request %d: expected %s remaining, got %q", i, tt.remaining, got)
+		}
+		if w.Header().Get("X-RateLimit-Limit") != "2" {
+			t.Errorf("Request %d: expected limit 2, got %q", i, w.Header().Get("X-RateLimit-Limit"))
+		}
+		if tt.status == http.StatusTooManyRequests && w.Header().Get("Retry-After") == "" {
+			t.Errorf("Request %d: expected a Retry-After header", i)
+		}
+	}
+}
+
+func TestWithJWTAuth(t *testing.T) {
+	dir := t.TempDir()
+	authConfig := filepath.Join(dir, "auth_config.json")
+	if err := os.WriteFile(authConfig, []byte(`{"jwt_secret":"secret","requests_per_token":10}`), 0o600); err != nil {
+		t.Fatalf("Failed to write auth config: %v", err)
+	}
+	secrets, err := jwtauth.LoadSecrets(authConfig)
+	if err != nil {
+		t.Fatalf("Failed to load secrets: %v", err)
+	}
+	clientLimit, err := ratelimit.New(ratelimit.Options{Requests: 60, Period: time.Minute, Burst: 5}, ratelimit.NewMemory())
+	if err != nil {
+		t.Fatalf("Failed to create rate limiter: %v", err)
+	}
+	server := NewServer(nil, zap.NewNop(), WithJWTAuth(jwtauth.New(secrets, jwtauth.NewMemory())), WithRateLimit(clientLimit))
+
+	signingInput := base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"HS256"}`)) + "." +
+		base64.RawURLEncoding.EncodeToString([]byte(fmt.Sprintf(`{"sub":"abc","exp":%d}`, time.Now().Add(time.Hour).Unix())))
+	mac := hmac.New(sha256.New, []byte("secret"))
+	mac.Write([]byte(signingInput))
+	token := signingInput + "." + base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+
+	var seen *http.Request
+	handler := server.withJWTAuth(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		seen = r
+		server.takeRateLimit(w, r, false)
+	}))
+
+	tests := []struct {
+		name     string
+		direct   bool
+		query    string
+		status   int
+		identity string
+	}{
+		{"socket without token", false, "owner=0x1", http.StatusOK, "basic:wallet"},
+		{"direct without token", true, "owner=0x1", http.StatusUnauthorized, ""},
+		{"direct with token", true, "owner=0x1&token=" + token, http.StatusOK, "jwt:abc"},
+		{"tampered token", true, "owner=0x1&token=" + token + "x", http.StatusUnauthorized, ""},
+	}
+	for _, tt := range tests {
+		seen = nil
+		req := httptest.NewRequest(http.MethodGet, "/eth/mainnet/nft/v3/getNFTsForOwner?"+tt.query, nil)
+		req.RemoteAddr = "203.0.113.7:4242"
+		req.Header.Set(tenant.Header, "basic:wallet")
+		req.Header.Set("X-Real-IP", "10.0.0.1")
+		if tt.direct {
+			req = req.WithContext(context.WithValue(req.Context(), directListenerKey{}, true))
+		}
+		w := httptest.NewRecorder()
+
+		handler.ServeHTTP(w, req)
+
+		if w.Code != tt.status {
+			t.Errorf("%s: expected status %d, got %d", tt.name, tt.status, w.Code)
+		}
+		if tt.status != http.StatusOK {
+			continue
+		}
+		if got := seen.Header.Get(tenant.Header); got != tt.identity {
+			t.Errorf("%s: expected identity %q, got %q", tt.name, tt.identity, got)
+		}
+		if seen.URL.Query().Has("token") {
+			t.Errorf("%s: expected the token to be removed from the query", tt.name)
+		}
+		if tt.direct && seen.Header.Get("X-Real-IP") != "203.0.113.7" {
+			t.Errorf("%s: expected X-Real-IP from the peer address, got %q", tt.name, seen.Header.Get("X-Real-IP"))
+		}
+		if tt.identity == "jwt:abc" {
+			// The token quota and the client rate limit report separately
+			if w.Header().Get("X-Quota-Limit") != "10" || w.Header().Get("X-Quota-Remaining") != "9" {
+				t.Errorf("%s: expected token quota 9 of 10, got %q of %q", tt.name, w.Header().Get("X-Quota-Remaining"), w.Header().Get("X-Quota-Limit"))
+			}
+			if w.Header().Get("X-RateLimit-Limit") != "5" {
+				t.Errorf("%s: expected the client rate limit's burst, got %q", tt.name, w.Header().Get("X-RateLimit-Limit"))
+			}
+		}
+	}
+}
+
+func TestSignedURLs(t *testing.T) {
+	var upstreamQueries []string
+	mockAlchemy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		upstreamQueries = append(upstreamQueries, r.URL.RawQuery)
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte(`{"ownedNfts":[]}`))
+	}))
+	defer mockAlchemy.Close()
+
+	signer, err := signedurl.New([]string{"key"}, 24*time.Hour)
+	if err != nil {
+		t.Fatalf("Failed to create signer: %v", err)
+	}
+	client := alchemy.NewClient("test-api-key", map[string]string{"eth-mainnet": mockAlchemy.URL}, httpclient.DefaultRetryOptions())
+	server := NewServer(client, zap.NewNop(), WithSignedURLs(signer))
+	metricsServer := NewMetricsServer(zap.NewNop(), WithURLSigning(server))
+	router := mux.NewRouter()
+	server.SetupRoutes(router)
+
+	mint := func(target, scope string) string {
+		t.Helper()
+		req := httptest.NewRequest(http.MethodPost, "/admin/signed-urls?ttl=1h&scope="+scope+"&url="+url.QueryEscape(target), nil)
+		w := httptest.NewRecorder()
+		metricsServer.Handler().ServeHTTP(w, req)
+		if w.Code != http.StatusOK {
+			t.Fatalf("Expected status 200 minting a URL, got %d: %s", w.Code, w.Body.String())
+		}
+		var signed SignedURL
+		json.NewDecoder(w.Body).Decode(&signed)
+		return signed.URL
+	}
+	get := func(target string, header ...string) int {
+		req := httptest.NewRequest(http.MethodGet, target, nil)
+		for i := 0; i+1 < len(header); i += 2 {
+			req.Header.Set(header[i], header[i+1])
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	signed := mint("/eth/mainnet/nft/v3/getNFTsForOwner?owner=0x1", "")
+	if code := get(signed); code != http.StatusOK {
+		t.Errorf("Expected signed URL to be served, got %d", code)
+	}
+	if len(upstreamQueries) != 1 || upstreamQueries[0] != "owner=0x1" {
+		t.Errorf("Expected signature parameters to be stripped upstream, got %v", upstreamQueries)
+	}
+	if code := get(strings.Replace(signed, "owner=0x1", "owner=0x2", 1)); code != http.StatusUnauthorized {
+		t.Errorf("Expected tampered URL to get 401, got %d", code)
+	}
+
+	// Requests nginx let through as signed must verify, even when the
+	// signature pair is malformed or missing
+	for _, target := range []string{
+		"/eth/mainnet/nft/v3/getNFTsForOwner?owner=0x1&sig=abc;x",
+		"/eth/mainnet/nft/v3/getNFTsForOwner?owner=0x1&sig=%zz",
+	} {
+		if code := get(target, signedURLHeader, "1"); code != http.StatusUnauthorized {
+			t.Errorf("%s: expected malformed signature to get 401, got %d", target, code)
+		}
+		if code := get(target); code != http.StatusUnauthorized {
+			t.Errorf("%s: expected malformed signature to get 401 without the nginx marker, got %d", target, code)
+		}
+	}
+	if code := get("/eth/mainnet/nft/v3/getNFTsForOwner?owner=0x1", signedURLHeader, "1"); code != http.StatusUnauthorized {
+		t.Errorf("Expected a marked request without a signature to get 401, got %d", code)
+	}
+
+	scoped := mint("/eth/mainnet/nft/v3/getNFTsForOwner?owner=0x1", "eth-mainnet:getNFTsForOwner")
+	if code := get(strings.Replace(scoped, "owner=0x1", "owner=0x2", 1)); code != http.StatusUnauthorized {
+		t.Errorf("Expected scoped URL with another owner to get 401, got %d", code)
+	}
+	outside := mint("/eth/mainnet/nft/v3/getOwnersForContract?contractAddress=0x1", "eth-mainnet:getNFTsForOwner")
+	if code := get(outside); code != http.StatusForbidden {
+		t.Errorf("Expected request outside the scope to get 403, got %d", code)
+	}
+
+	req := httptest.NewRequest(http.MethodPost, "/admin/signed-urls?ttl=1h&scope=*:*&url="+url.QueryEscape("/eth/mainnet/nft/v3/getNFTsForOwner"), nil)
+	w := httptest.NewRecorder()
+	metricsServer.Handler().ServeHTTP(w, req)
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("Expected a wildcard scope to be rejected, got %d", w.Code)
+	}
+}
+
+func TestSignedURLs_IgnoreClaimedIdentity(t *testing.T) {
+	signer, err := signedurl.New([]string{"key"}, 24*time.Hour)
+	if err != nil {
+		t.Fatalf("Failed to create signer: %v", err)
+	}
+	server := NewServer(nil, zap.NewNop(), WithSignedURLs(signer))
+	signed, err := server.SignURL("/eth/mainnet/nft/v3/getNFTsForOwner?owner=0x1", time.Hour, "eth-mainnet:getNFTsForOwner")
+	if err != nil {
+		t.Fatalf("Failed to sign URL: %v", err)
+	}
+
+	var identity string
+	handler := server.withSignedURLs(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		identity = r.Header.Get(tenant.Header)
+	}))
+	req := httptest.NewRequest(http.MethodGet, signed.URL, nil)
+	req.Header.Set(tenant.Header, "basic:victim")
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+
+	if identity != "signed:eth-mainnet:getNFTsForOwner" {
+		t.Errorf("Expected the signed URL's own identity, got %q", identity)
+	}
+}
@@ -0,0 +1,120 @@
+package handlers
+
+import (
+	"errors"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"go.uber.org/zap"
+
+	"nft-proxy/internal/jwtauth"
+	"nft-proxy/internal/tenant"
+)
+
+// directListenerKey marks requests accepted on the TCP listener, where
+// clients reach nft-proxy without nginx in front
+type directListenerKey struct{}
+
+// tokenParams are the query parameters that can carry a JWT, as accepted by
+// the nginx validator
+var tokenParams = []string{"token", "jwt", "access_token"}
+
+// withJWTAuth validates puzzle JWTs in nft-proxy. Requests with a valid
+// token are attributed to "jwt:<subject>" for tenant policies and rate
+// limits. On the Unix socket, requests without a token were authenticated
+// by nginx and pass; on the TCP listener a token is required and the
+// headers nginx would set are not taken from the client.
+func (s *Server) withJWTAuth(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		direct, _ := r.Context().Value(directListenerKey{}).(bool)
+		if direct {
+			// Signed URLs set their own identity
+			if signedGrantFrom(r.Context()) == nil {
+				r.Header.Del(tenant.Header)
+			}
+			r.Header.Set(realIPHeader, remoteHost(r))
+		}
+		if s.jwtAuth == nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		token, r := extractToken(r)
+		if token == "" {
+			// Signed URLs stand in for credentials
+			if direct && signedGrantFrom(r.Context()) == nil {
+				s.writeUnauthorized(w, "Authentication required")
+				return
+			}
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		result, err := s.jwtAuth.Authenticate(r.Context(), token)
+		if result.Limit > 0 {
+			// Not X-RateLimit-*, which the client rate limit sets
+			w.Header().Set("X-Quota-Limit", strconv.FormatInt(result.Limit, 10))
+			w.Header().Set("X-Quota-Remaining", strconv.FormatInt(result.Remaining, 10))
+		}
+		switch {
+		case errors.Is(err, jwtauth.ErrExpiredToken):
+			s.writeUnauthorized(w, "Token expired")
+			return
+		case errors.Is(err, jwtauth.ErrInvalidToken):
+			s.writeUnauthorized(w, "Invalid token")
+			return
+		case errors.Is(err, jwtauth.ErrQuotaExceeded):
+			s.writeError(w, "Token request quota exceeded, get a new token", http.StatusTooManyRequests)
+			return
+		case err != nil:
+			// The token is valid; only its count is unavailable
+			s.logger.Warn("Token quota unavailable, allowing request", zap.Error(err))
+		}
+
+		subject := result.Claims.Subject
+		if subject == "" {
+			subject = "anonymous"
+		}
+		r.Header.Set(tenant.Header, "jwt:"+subject)
+		next.ServeHTTP(w, r)
+	})
+}
+
+// extractToken returns the JWT of a request from its bearer Authorization
+// header or its query. A token in the query is removed from the returned
+// request so it is neither sent upstream nor logged.
+func extractToken(r *http.Request) (string, *http.Request) {
+	if scheme, token, ok := strings.Cut(r.Header.Get("Authorization"), " "); ok && scheme == "Bearer" {
+		return strings.TrimSpace(token), r
+	}
+
+	query := r.URL.Query()
+	for _, param := range tokenParams {
+		if token := query.Get(param); token != "" {
+			for _, p := range tokenParams {
+				query.Del(p)
+			}
+			r = r.Clone(r.Context())
+			r.URL.RawQuery = query.Encode()
+			return token, r
+		}
+	}
+	return "", r
+}
+
+// writeUnauthorized rejects a request with 401 and a bearer challenge
+func (s *Server) writeUnauthorized(w http.ResponseWriter, message string) {
+	w.Header().Set("WWW-Authenticate", `Bearer realm="nft-proxy"`)
+	s.writeError(w, message, http.StatusUnauthorized)
+}
+
+// remoteHost returns the address of a request's peer without its port
+func remoteHost(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
@@ -2,34 +2,58 @@ package handlers
 
 import (
 	"context"
+	"crypto/subtle"
+	"encoding/json"
 	"net/http"
 	"time"
 
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"go.uber.org/zap"
+
+	"nft-proxy/internal/health"
 )
 
 // MetricsServer represents a separate HTTP server for metrics
 type MetricsServer struct {
 	logger *zap.Logger
 	server *http.Server
+
+	// inspector serves the cache inspection endpoint when set
+	inspector *Server
+	// purger serves the cache purge endpoint when set
+	purger *Server
+	// snapshots serves cache snapshot export and import when set
+	snapshots *Server
+	// urlSigner serves the signed URL minting endpoint when set
+	urlSigner *Server
+	// bearerToken guards /metrics and /admin when set
+	bearerToken string
+	// readiness serves /ready when set
+	readiness *health.Checker
 }
 
 // NewMetricsServer creates a new metrics HTTP server
-func NewMetricsServer(logger *zap.Logger) *MetricsServer {
-	return &MetricsServer{
+func NewMetricsServer(logger *zap.Logger, opts ...MetricsServerOption) *MetricsServer {
+	ms := &MetricsServer{
 		logger: logger,
 	}
+	for _, opt := range opts {
+		opt(ms)
+	}
+	return ms
 }
 
 // Start starts the metrics HTTP server on the specified port
 func (ms *MetricsServer) Start(port string) error {
 	mux := http.NewServeMux()
-	mux.Handle("/metrics", promhttp.Handler())
+	mux.Handle("/", ms.Handler())
 	mux.HandleFunc("/health", func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("Content-Type", "application/json")
 		w.Write([]byte(`{"status":"ok"}`))
 	})
+	if ms.readiness != nil {
+		mux.HandleFunc("GET /ready", readinessHandler(ms.readiness))
+	}
 
 	ms.server = &http.Server{
 		Addr:         ":" + port,
@@ -43,6 +67,52 @@ func (ms *MetricsServer) Start(port string) error {
 	return ms.server.ListenAndServe()
 }
 
+// Handler returns the /metrics and /admin endpoints behind the bearer token
+// guard, so they can be mounted on the proxy's Unix socket as well as served
+// on the metrics port
+func (ms *MetricsServer) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", promhttp.Handler())
+	if ms.inspector != nil {
+		mux.HandleFunc("GET /admin/cache/inspect", ms.handleCacheInspect)
+		mux.HandleFunc("POST /admin/cache/inspect", ms.handleCacheInspect)
+	}
+	if ms.purger != nil {
+		mux.HandleFunc("POST /admin/cache/purge", ms.handleCachePurge)
+	}
+	if ms.snapshots != nil {
+		mux.HandleFunc("GET /admin/cache/snapshot", ms.handleSnapshotExport)
+		mux.HandleFunc("POST /admin/cache/snapshot", ms.handleSnapshotImport)
+	}
+	if ms.urlSigner != nil {
+		mux.HandleFunc("POST /admin/signed-urls", ms.handleSignURL)
+	}
+	return ms.requireBearerToken(mux)
+}
+
+// requireBearerToken rejects requests without the configured bearer token
+func (ms *MetricsServer) requireBearerToken(next http.Handler) http.Handler {
+	if ms.bearerToken == "" {
+		return next
+	}
+	expected := []byte("Bearer " + ms.bearerToken)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if subtle.ConstantTimeCompare([]byte(r.Header.Get("Authorization")), expected) != 1 {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "Unauthorized"})
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// writeJSON writes v as a JSON response with the given status
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
 // Stop stops the metrics HTTP server
 func (ms *MetricsServer) Stop(ctx context.Context) error {
 	if ms.server == nil {
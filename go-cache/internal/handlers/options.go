@@ -0,0 +1,171 @@
+package handlers
+
+import (
+	"time"
+
+	"go.uber.org/zap"
+
+	"nft-proxy/internal/cache"
+	"nft-proxy/internal/health"
+	"nft-proxy/internal/jwtauth"
+	"nft-proxy/internal/limiter"
+	"nft-proxy/internal/ratelimit"
+	"nft-proxy/internal/signedurl"
+	"nft-proxy/internal/spam"
+	"nft-proxy/internal/tenant"
+	"nft-proxy/internal/warmup"
+)
+
+// ServerOption configures optional dependencies of the NFT proxy Server
+type ServerOption func(*Server)
+
+// WithConcurrencyLimiter bounds concurrent upstream calls. Requests that cannot
+// get a slot are shed with 503 and a Retry-After of retryAfter.
+func WithConcurrencyLimiter(l *limiter.Limiter, retryAfter time.Duration) ServerOption {
+	return func(s *Server) {
+		s.limiter = l
+		s.retryAfter = retryAfter
+	}
+}
+
+// WithCache serves responses from the given cache and stores upstream
+// responses of up to maxEntryBytes in it
+func WithCache(c *cache.Cache, maxEntryBytes int64) ServerOption {
+	return func(s *Server) {
+		s.cache = c
+		s.maxEntryBytes = maxEntryBytes
+	}
+}
+
+// WithAccessLog writes an access log entry for every failed request and for a
+// sampleRate fraction (0 to 1) of successful ones
+func WithAccessLog(logger *zap.Logger, sampleRate float64) ServerOption {
+	return func(s *Server) {
+		s.accessLogger = logger
+		s.accessLogSampleRate = sampleRate
+	}
+}
+
+// WithReadiness serves /ready, which runs the checker's component checks
+func WithReadiness(c *health.Checker) ServerOption {
+	return func(s *Server) {
+		s.readiness = c
+	}
+}
+
+// WithAlchemyWebhook serves POST /webhooks/alchemy, which invalidates cached
+// holdings on Alchemy Notify NFT activity. Deliveries must be signed with one
+// of signingKeys.
+func WithAlchemyWebhook(signingKeys []string) ServerOption {
+	return func(s *Server) {
+		s.webhookSigningKeys = signingKeys
+	}
+}
+
+// WithHotKeyTracker counts requests to cached endpoints in t, so warmup can
+// refresh the hottest keys before they expire
+func WithHotKeyTracker(t *warmup.Tracker) ServerOption {
+	return func(s *Server) {
+		s.hotKeys = t
+	}
+}
+
+// MetricsServerOption configures optional endpoints of the MetricsServer
+type MetricsServerOption func(*MetricsServer)
+
+// WithCacheInspector serves /admin/cache/inspect, which reports the cache key
+// and per-tier state of a proxied request as seen by s
+func WithCacheInspector(s *Server) MetricsServerOption {
+	return func(ms *MetricsServer) {
+		ms.inspector = s
+	}
+}
+
+// WithCachePurger serves POST /admin/cache/purge, which removes entries of
+// s's cache by key, chain, contract or owner
+func WithCachePurger(s *Server) MetricsServerOption {
+	return func(ms *MetricsServer) {
+		ms.purger = s
+	}
+}
+
+// WithCacheSnapshots serves GET /admin/cache/snapshot, which downloads a
+// snapshot of s's cache, and POST /admin/cache/snapshot, which loads one
+func WithCacheSnapshots(s *Server) MetricsServerOption {
+	return func(ms *MetricsServer) {
+		ms.snapshots = s
+	}
+}
+
+// WithURLSigning serves POST /admin/signed-urls, which mints signed URLs
+// with s's keys
+func WithURLSigning(s *Server) MetricsServerOption {
+	return func(ms *MetricsServer) {
+		ms.urlSigner = s
+	}
+}
+
+// WithBearerToken requires "Authorization: Bearer <token>" on /metrics and
+// /admin. An empty token leaves them open.
+func WithBearerToken(token string) MetricsServerOption {
+	return func(ms *MetricsServer) {
+		ms.bearerToken = token
+	}
+}
+
+// WithMetricsReadiness serves /ready on the metrics port, next to /health
+func WithMetricsReadiness(c *health.Checker) MetricsServerOption {
+	return func(ms *MetricsServer) {
+		ms.readiness = c
+	}
+}
+
+// WithProjectionPresets names field lists that clients can select with
+// fields=@name, see projection.Parse
+func WithProjectionPresets(presets map[string][]string) ServerOption {
+	return func(s *Server) {
+		s.projectionPresets = presets
+	}
+}
+
+// WithSpamFilter flags or drops spam collections in the responses of the
+// endpoints the filter applies to
+func WithSpamFilter(f *spam.Filter) ServerOption {
+	return func(s *Server) {
+		s.spamFilter = f
+	}
+}
+
+// WithTenants resolves the client identity nginx forwards in tenant.Header
+// and enforces the tenant's policy. Unknown identities fall back to the
+// registry's default tenant or are rejected with 403.
+func WithTenants(r *tenant.Registry) ServerOption {
+	return func(s *Server) {
+		s.tenants = r
+	}
+}
+
+// WithRateLimit limits the request rate of each client, identified by the
+// identity nginx forwards or by X-Real-IP, and reports the client's
+// allowance in X-RateLimit-* headers
+func WithRateLimit(l *ratelimit.Limiter) ServerOption {
+	return func(s *Server) {
+		s.rateLimit = l
+	}
+}
+
+// WithJWTAuth validates puzzle JWTs in the proxy instead of relying on the
+// nginx auth_request hop, and enforces their per-token request quota
+func WithJWTAuth(a *jwtauth.Authenticator) ServerOption {
+	return func(s *Server) {
+		s.jwtAuth = a
+	}
+}
+
+// WithSignedURLs accepts requests whose URL is signed by the signer in place
+// of client credentials
+func WithSignedURLs(signer *signedurl.Signer) ServerOption {
+	return func(s *Server) {
+		s.urlSigner = signer
+	}
+}
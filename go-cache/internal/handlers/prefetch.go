@@ -0,0 +1,92 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"nft-proxy/internal/alchemy"
+	"nft-proxy/internal/cache"
+	"nft-proxy/internal/warmup"
+)
+
+// Prefetch fetches a request from Alchemy into the cache, as a cache miss by a
+// client would, without serving it. It implements warmup.Fetcher.
+func (s *Server) Prefetch(ctx context.Context, req warmup.Request) error {
+	if s.cache == nil {
+		return errCacheDisabled
+	}
+	key, endpoint, err := s.warmupKey(req)
+	if err != nil {
+		return err
+	}
+	if s.cache.Rule(endpoint).TTL <= 0 {
+		return nil
+	}
+
+	resp, err := s.alchemyClient.Stream(ctx, req.Method, req.Chain, req.Network, req.Path, req.RawQuery, req.Body)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if !s.cache.Caches(endpoint, resp.StatusCode) {
+		return fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, s.maxEntryBytes+1))
+	if err != nil {
+		return err
+	}
+	if int64(len(body)) > s.maxEntryBytes {
+		return fmt.Errorf("response larger than %d bytes", s.maxEntryBytes)
+	}
+
+	s.cache.Set(ctx, key, endpoint, &cache.Entry{
+		Body:            body,
+		StatusCode:      resp.StatusCode,
+		ContentType:     resp.Header.Get("Content-Type"),
+		ContentEncoding: resp.Header.Get("Content-Encoding"),
+		Tags:            cache.Tags(req.RawQuery, req.Body),
+	})
+	return nil
+}
+
+// Remaining implements warmup.Fetcher
+func (s *Server) Remaining(ctx context.Context, req warmup.Request) time.Duration {
+	if s.cache == nil {
+		return 0
+	}
+	key, _, err := s.warmupKey(req)
+	if err != nil {
+		return 0
+	}
+	return s.cache.Remaining(ctx, key)
+}
+
+// warmupKey returns the cache key and endpoint of a warmup request
+func (s *Server) warmupKey(req warmup.Request) (string, string, error) {
+	canonical, err := s.alchemyClient.CanonicalChain(req.Chain, req.Network)
+	if err != nil {
+		return "", "", err
+	}
+	endpoint := alchemy.EndpointName(req.Path)
+	return cache.Key(canonical, endpoint, req.Method, req.Path, req.RawQuery, req.Body), endpoint, nil
+}
+
+// recordHotKey counts a request to a cached endpoint for warmup. The query is
+// stored in canonical form, which drops client auth tokens.
+func (s *Server) recordHotKey(key, endpoint string, r *http.Request, chain, network, alchemyPath string, body []byte) {
+	if s.hotKeys == nil || key == "" || s.cache.Rule(endpoint).TTL <= 0 {
+		return
+	}
+	s.hotKeys.Record(key, warmup.Request{
+		Method:   r.Method,
+		Chain:    chain,
+		Network:  network,
+		Path:     alchemyPath,
+		RawQuery: cache.CanonicalQuery(r.URL.RawQuery),
+		Body:     body,
+	})
+}
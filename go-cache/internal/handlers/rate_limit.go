@@ -0,0 +1,52 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+
+	"go.uber.org/zap"
+
+	"nft-proxy/internal/tenant"
+)
+
+// realIPHeader carries the client address set by nginx
+const realIPHeader = "X-Real-IP"
+
+// takeRateLimit charges a request to its client's rate limit and sets the
+// X-RateLimit-* headers. It writes a 429 response and returns false when
+// the client is over its limit.
+func (s *Server) takeRateLimit(w http.ResponseWriter, r *http.Request, hit bool) bool {
+	if s.rateLimit == nil {
+		return true
+	}
+
+	result, err := s.rateLimit.Take(r.Context(), clientKey(r), hit)
+	if err != nil {
+		// Fail open: a KeyDB outage must not reject every request
+		s.logger.Warn("Rate limit unavailable, allowing request", zap.Error(err))
+		return true
+	}
+
+	header := w.Header()
+	header.Set("X-RateLimit-Limit", strconv.Itoa(result.Limit))
+	header.Set("X-RateLimit-Remaining", strconv.Itoa(result.Remaining))
+	header.Set("X-RateLimit-Reset", retryAfterSeconds(result.Reset))
+	if !result.Allowed {
+		header.Set("Retry-After", retryAfterSeconds(result.RetryAfter))
+		s.writeError(w, "Rate limit exceeded", http.StatusTooManyRequests)
+		return false
+	}
+	return true
+}
+
+// clientKey identifies the caller of a request for rate limiting: its
+// identity from nginx when authenticated, otherwise its address
+func clientKey(r *http.Request) string {
+	if identity := r.Header.Get(tenant.Header); identity != "" {
+		return identity
+	}
+	if ip := r.Header.Get(realIPHeader); ip != "" {
+		return "ip:" + ip
+	}
+	return "ip:" + remoteHost(r)
+}
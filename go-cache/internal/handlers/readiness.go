@@ -0,0 +1,21 @@
+package handlers
+
+import (
+	"net/http"
+
+	"nft-proxy/internal/health"
+)
+
+// readinessHandler serves /ready: 200 when every component check passes and
+// 503 otherwise, with per-component details in both cases. Unlike /health it
+// checks dependencies, so it should not be used as a liveness probe.
+func readinessHandler(checker *health.Checker) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		report := checker.Run(r.Context())
+		status := http.StatusOK
+		if !report.Ready {
+			status = http.StatusServiceUnavailable
+		}
+		writeJSON(w, status, report)
+	}
+}
@@ -0,0 +1,109 @@
+package handlers
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+
+	"go.uber.org/zap"
+
+	"nft-proxy/internal/cache"
+	"nft-proxy/internal/projection"
+	"nft-proxy/internal/spam"
+)
+
+// defaultMaxRewrittenBytes caps the responses buffered for rewriting when no
+// cache sets a limit
+const defaultMaxRewrittenBytes = 8 << 20
+
+// rewrite transforms successful JSON responses on the way out: spam items are
+// flagged or dropped, then the projection is applied. Upstream responses are
+// cached whole, so list reloads and different projections share one entry.
+type rewrite struct {
+	chain    string
+	endpoint string
+	spam     *spam.Filter
+	proj     *projection.Projection
+}
+
+// newRewrite returns the rewrite of a request's responses, or nil if they are
+// served as is
+func (s *Server) newRewrite(chain, endpoint string, proj *projection.Projection) *rewrite {
+	rw := &rewrite{chain: chain, endpoint: endpoint, proj: proj}
+	if s.spamFilter != nil && s.spamFilter.Applies(endpoint) {
+		rw.spam = s.spamFilter
+	}
+	if rw.spam == nil && rw.proj == nil {
+		return nil
+	}
+	return rw
+}
+
+// writeRewritten reads a complete upstream response, stores it in the cache
+// as is and serves it rewritten. Responses too large to hold in memory are
+// streamed whole and not cached.
+func (s *Server) writeRewritten(w http.ResponseWriter, r *http.Request, resp *http.Response, cacheKey, endpoint string, tags []string, rw *rewrite) {
+	limit := s.maxEntryBytes
+	if limit <= 0 {
+		limit = defaultMaxRewrittenBytes
+	}
+	raw, err := io.ReadAll(io.LimitReader(resp.Body, limit+1))
+	if err != nil {
+		s.logger.Error("Failed to read upstream response", zap.Error(err))
+		s.writeError(w, "Failed to proxy request", http.StatusBadGateway)
+		return
+	}
+	if int64(len(raw)) > limit {
+		s.logger.Warn("Response too large to rewrite, serving it whole", zap.String("endpoint", endpoint))
+		resp.Body = struct {
+			io.Reader
+			io.Closer
+		}{io.MultiReader(bytes.NewReader(raw), resp.Body), resp.Body}
+		s.streamResponse(w, r, resp, "", endpoint, nil)
+		return
+	}
+
+	entry := &cache.Entry{
+		Body:            raw,
+		StatusCode:      resp.StatusCode,
+		ContentType:     resp.Header.Get("Content-Type"),
+		ContentEncoding: resp.Header.Get("Content-Encoding"),
+		Tags:            tags,
+	}
+	if cacheKey != "" {
+		s.cache.Set(r.Context(), cacheKey, endpoint, entry)
+	}
+	copyForwardedHeaders(w.Header(), resp.Header)
+	s.writeEntry(w, r, entry, -1, rw)
+}
+
+// rewriteEntry returns an entry's body rewritten and its content coding.
+// Bodies the rewrite leaves untouched keep their stored coding; bodies that
+// are not JSON are returned whole.
+func (s *Server) rewriteEntry(entry *cache.Entry, rw *rewrite) ([]byte, string, error) {
+	body, err := decodeBody(entry.ContentEncoding, entry.Body)
+	if err != nil {
+		return nil, "", err
+	}
+	changed := false
+	if rw.spam != nil {
+		filtered, filteredChanged, err := rw.spam.Apply(rw.chain, rw.endpoint, body)
+		if err != nil {
+			s.logger.Warn("Failed to filter spam, serving the response unfiltered", zap.Error(err))
+		} else {
+			body, changed = filtered, filteredChanged
+		}
+	}
+	if rw.proj != nil {
+		projected, err := rw.proj.Apply(body)
+		if err != nil {
+			s.logger.Warn("Failed to project response, serving it whole", zap.Error(err))
+		} else {
+			body, changed = projected, true
+		}
+	}
+	if !changed {
+		return entry.Body, entry.ContentEncoding, nil
+	}
+	return body, "", nil
+}
@@ -0,0 +1,142 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/url"
+	"time"
+
+	"nft-proxy/internal/signedurl"
+	"nft-proxy/internal/tenant"
+)
+
+// errSignedURLsDisabled is returned when no URL signing key is configured
+var errSignedURLsDisabled = errors.New("signed URLs are not enabled")
+
+// signedURLHeader is set by nginx on requests it let through without
+// credentials because they carry a URL signature. Such requests must verify.
+const signedURLHeader = "X-Signed-URL"
+
+type signedGrantKey struct{}
+
+// signedGrantFrom returns the grant of a request made with a signed URL, or
+// nil for other requests
+func signedGrantFrom(ctx context.Context) *signedurl.Grant {
+	grant, _ := ctx.Value(signedGrantKey{}).(*signedurl.Grant)
+	return grant
+}
+
+// withSignedURLs authorizes requests that carry a URL signature, which nginx
+// lets through without credentials. It fails closed: a request marked by
+// nginx or naming a signature in any query pair, even a malformed one, must
+// carry a valid signature in a well-formed query. Tampered URLs get 401 and
+// expired ones 403. Verified requests are attributed to "signed:<scope>",
+// or "signed:url" for unscoped URLs, whatever identity they claim. The
+// signature parameters are removed before the request goes on, so they are
+// neither sent upstream nor part of the cache key.
+func (s *Server) withSignedURLs(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		marked := r.Header.Get(signedURLHeader) != ""
+		r.Header.Del(signedURLHeader)
+		if !marked && !signedurl.HasSignature(r.URL.RawQuery) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if s.urlSigner == nil {
+			s.writeError(w, errSignedURLsDisabled.Error(), http.StatusUnauthorized)
+			return
+		}
+
+		query, err := url.ParseQuery(r.URL.RawQuery)
+		if err != nil || !signedurl.Signed(query) {
+			s.writeError(w, "Invalid URL signature", http.StatusUnauthorized)
+			return
+		}
+		grant, err := s.urlSigner.Verify(r.URL)
+		if errors.Is(err, signedurl.ErrExpired) {
+			s.writeError(w, "Signed URL expired", http.StatusForbidden)
+			return
+		}
+		if err != nil {
+			s.writeError(w, "Invalid URL signature", http.StatusUnauthorized)
+			return
+		}
+
+		signedurl.Strip(query)
+		r = r.Clone(context.WithValue(r.Context(), signedGrantKey{}, grant))
+		r.URL.RawQuery = query.Encode()
+		identity := "signed:url"
+		if grant.Scope != "" {
+			identity = "signed:" + grant.Scope
+		}
+		r.Header.Set(tenant.Header, identity)
+		next.ServeHTTP(w, r)
+	})
+}
+
+// authorizeSignedURL checks a signed request against its URL's scope once
+// the canonical chain is known. It writes a 403 response and returns false
+// when the request falls outside the scope.
+func (s *Server) authorizeSignedURL(w http.ResponseWriter, r *http.Request, chain, endpoint string) bool {
+	grant := signedGrantFrom(r.Context())
+	if grant == nil {
+		return true
+	}
+	if err := s.urlSigner.Authorize(grant, chain, endpoint); err != nil {
+		s.writeError(w, err.Error(), http.StatusForbidden)
+		return false
+	}
+	return true
+}
+
+// SignedURL is a URL minted by SignURL
+type SignedURL struct {
+	URL       string    `json:"url"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// SignURL signs a request URL, such as
+// "/eth/mainnet/nft/v3/getNFTsForOwner?owner=0x...", for ttl. The signature
+// covers the whole path and query. A scope such as
+// "eth-mainnet:getNFTsForOwner" also binds the URL to that chain and
+// endpoint; wildcard scopes are rejected.
+func (s *Server) SignURL(rawURL string, ttl time.Duration, scope string) (*SignedURL, error) {
+	if s.urlSigner == nil {
+		return nil, errSignedURLsDisabled
+	}
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, err
+	}
+	signed, expiresAt, err := s.urlSigner.Sign(u, ttl, scope)
+	if err != nil {
+		return nil, err
+	}
+	return &SignedURL{URL: signed.String(), ExpiresAt: expiresAt}, nil
+}
+
+func (ms *MetricsServer) handleSignURL(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	target := query.Get("url")
+	if target == "" {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "url is required"})
+		return
+	}
+	ttl, err := time.ParseDuration(query.Get("ttl"))
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "ttl must be a duration such as 24h"})
+		return
+	}
+
+	signed, err := ms.urlSigner.SignURL(target, ttl, query.Get("scope"))
+	if errors.Is(err, errSignedURLsDisabled) {
+		writeJSON(w, http.StatusNotFound, map[string]string{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return
+	}
+	writeJSON(w, http.StatusOK, signed)
+}
@@ -0,0 +1,97 @@
+package handlers
+
+import (
+	"bytes"
+	"errors"
+	"net/http"
+)
+
+// cappedBuffer collects a copy of a streamed body, giving up and releasing
+// its memory once the body grows past limit. Writes never fail so it can sit
+// in an io.MultiWriter next to the client connection.
+type cappedBuffer struct {
+	buf        bytes.Buffer
+	limit      int64
+	overflowed bool
+}
+
+func newCappedBuffer(limit int64) *cappedBuffer {
+	return &cappedBuffer{limit: limit}
+}
+
+func (b *cappedBuffer) Write(p []byte) (int, error) {
+	if b.overflowed {
+		return len(p), nil
+	}
+	if int64(b.buf.Len()+len(p)) > b.limit {
+		b.overflowed = true
+		b.buf = bytes.Buffer{}
+		return len(p), nil
+	}
+	return b.buf.Write(p)
+}
+
+// Bytes returns the collected body
+func (b *cappedBuffer) Bytes() []byte {
+	return b.buf.Bytes()
+}
+
+// Overflowed reports whether the body exceeded the limit
+func (b *cappedBuffer) Overflowed() bool {
+	return b.overflowed
+}
+
+// flushWriter flushes the response after every write so the client receives
+// data as soon as it arrives from upstream instead of when buffers fill
+type flushWriter struct {
+	w  http.ResponseWriter
+	rc *http.ResponseController
+}
+
+func newFlushWriter(w http.ResponseWriter) *flushWriter {
+	return &flushWriter{w: w, rc: http.NewResponseController(w)}
+}
+
+func (f *flushWriter) Write(p []byte) (int, error) {
+	n, err := f.w.Write(p)
+	if err != nil {
+		return n, err
+	}
+	if err := f.rc.Flush(); err != nil && !errors.Is(err, http.ErrNotSupported) {
+		return n, err
+	}
+	return n, nil
+}
+
+// statusRecorder remembers the status code and body size written to a
+// response. It unwraps to the underlying writer so http.ResponseController
+// can still flush.
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+	bytes  int64
+}
+
+func newStatusRecorder(w http.ResponseWriter) *statusRecorder {
+	return &statusRecorder{ResponseWriter: w}
+}
+
+func (r *statusRecorder) WriteHeader(status int) {
+	if r.status == 0 {
+		r.status = status
+	}
+	r.ResponseWriter.WriteHeader(status)
+}
+
+func (r *statusRecorder) Write(p []byte) (int, error) {
+	if r.status == 0 {
+		r.status = http.StatusOK
+	}
+	n, err := r.ResponseWriter.Write(p)
+	r.bytes += int64(n)
+	return n, err
+}
+
+func (r *statusRecorder) Unwrap() http.ResponseWriter {
+	return r.ResponseWriter
+}
@@ -0,0 +1,47 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"go.uber.org/zap"
+
+	"nft-proxy/internal/tenant"
+)
+
+// resolveTenant returns the tenant of a request for endpoint on a canonical
+// chain once its policy admits it. It writes a 403 or 429 response and
+// returns false when the request is rejected. Without tenants configured
+// every request is admitted with a nil tenant.
+func (s *Server) resolveTenant(w http.ResponseWriter, r *http.Request, info *requestInfo, chain, endpoint string) (*tenant.Tenant, bool) {
+	if s.tenants == nil {
+		return nil, true
+	}
+
+	identity := r.Header.Get(tenant.Header)
+	t := s.tenants.Resolve(identity)
+	if t == nil {
+		s.logger.Warn("Rejecting request from unknown client", zap.String("identity", identity))
+		s.writeError(w, "Client not allowed", http.StatusForbidden)
+		return nil, false
+	}
+	info.tenant = t.Name()
+
+	if err := t.Admit(chain, endpoint); err != nil {
+		s.writeTenantError(w, t, err)
+		return nil, false
+	}
+	return t, true
+}
+
+// writeTenantError maps a rejection by a tenant's policy to a client response
+func (s *Server) writeTenantError(w http.ResponseWriter, t *tenant.Tenant, err error) {
+	var limited *tenant.LimitedError
+	if errors.As(err, &limited) {
+		s.logger.Debug("Rejecting request over tenant limit", zap.String("tenant", t.Name()), zap.Error(err))
+		w.Header().Set("Retry-After", retryAfterSeconds(limited.RetryAfter))
+		s.writeError(w, err.Error(), http.StatusTooManyRequests)
+		return
+	}
+	s.writeError(w, "Request not allowed for this client", http.StatusForbidden)
+}
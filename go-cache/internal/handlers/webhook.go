@@ -0,0 +1,128 @@
+package handlers
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+
+	"go.uber.org/zap"
+
+	"nft-proxy/internal/cache"
+)
+
+// alchemySignatureHeader carries the hex HMAC-SHA256 of a webhook body
+const alchemySignatureHeader = "X-Alchemy-Signature"
+
+// maxWebhookBodyBytes bounds the webhook payloads read
+const maxWebhookBodyBytes = 1 << 20
+
+// nftActivityType is the webhook type of NFT transfers
+const nftActivityType = "NFT_ACTIVITY"
+
+// zeroAddress is the sender of mints and recipient of burns
+const zeroAddress = "0x0000000000000000000000000000000000000000"
+
+// alchemyWebhook is the part of an Alchemy Notify payload used for
+// invalidation
+type alchemyWebhook struct {
+	ID    string `json:"id"`
+	Type  string `json:"type"`
+	Event struct {
+		Network  string `json:"network"`
+		Activity []struct {
+			FromAddress     string `json:"fromAddress"`
+			ToAddress       string `json:"toAddress"`
+			ContractAddress string `json:"contractAddress"`
+		} `json:"activity"`
+	} `json:"event"`
+}
+
+// handleAlchemyWebhook accepts Alchemy Notify NFT activity webhooks and
+// removes the cached holdings of every sender and recipient and the cached
+// owners of every contract involved. Addresses are invalidated on all chains.
+func (s *Server) handleAlchemyWebhook(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxWebhookBodyBytes))
+	if err != nil {
+		s.webhookMetrics.OnRequest("bad_request", 0)
+		s.writeError(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if !s.validWebhookSignature(body, r.Header.Get(alchemySignatureHeader)) {
+		s.webhookMetrics.OnRequest("invalid_signature", 0)
+		s.writeError(w, "Invalid signature", http.StatusUnauthorized)
+		return
+	}
+
+	var payload alchemyWebhook
+	if err := json.Unmarshal(body, &payload); err != nil {
+		s.webhookMetrics.OnRequest("bad_request", 0)
+		s.writeError(w, "Invalid webhook payload", http.StatusBadRequest)
+		return
+	}
+	if payload.Type != nftActivityType || s.cache == nil {
+		s.webhookMetrics.OnRequest("ignored", 0)
+		writeJSON(w, http.StatusOK, map[string]int{"invalidated": 0})
+		return
+	}
+
+	owners := make(map[string]bool)
+	contracts := make(map[string]bool)
+	for _, activity := range payload.Event.Activity {
+		for _, owner := range []string{activity.FromAddress, activity.ToAddress} {
+			if owner != "" && !strings.EqualFold(owner, zeroAddress) {
+				owners[strings.ToLower(owner)] = true
+			}
+		}
+		if activity.ContractAddress != "" {
+			contracts[strings.ToLower(activity.ContractAddress)] = true
+		}
+	}
+
+	invalidated := 0
+	for owner := range owners {
+		invalidated += totalPurged(s.cache.PurgeTag(r.Context(), cache.OwnerTag(owner), "getNFTsForOwner"))
+	}
+	for contract := range contracts {
+		invalidated += totalPurged(s.cache.PurgeTag(r.Context(), cache.ContractTag(contract), "getOwnersForContract"))
+	}
+
+	s.logger.Info("Invalidated cache from webhook",
+		zap.String("event_id", payload.ID),
+		zap.String("network", payload.Event.Network),
+		zap.Int("owners", len(owners)),
+		zap.Int("contracts", len(contracts)),
+		zap.Int("invalidated", invalidated),
+	)
+	s.webhookMetrics.OnRequest("ok", invalidated)
+	writeJSON(w, http.StatusOK, map[string]int{"invalidated": invalidated})
+}
+
+// validWebhookSignature reports whether signature is the HMAC of body under
+// one of the configured signing keys
+func (s *Server) validWebhookSignature(body []byte, signature string) bool {
+	got, err := hex.DecodeString(signature)
+	if err != nil || len(got) == 0 {
+		return false
+	}
+	for _, key := range s.webhookSigningKeys {
+		mac := hmac.New(sha256.New, []byte(key))
+		mac.Write(body)
+		if hmac.Equal(got, mac.Sum(nil)) {
+			return true
+		}
+	}
+	return false
+}
+
+// totalPurged sums the entries a purge removed across tiers
+func totalPurged(results []cache.PurgeResult) int {
+	total := 0
+	for _, result := range results {
+		total += result.Purged
+	}
+	return total
+}
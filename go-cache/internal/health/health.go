@@ -0,0 +1,84 @@
+package health
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// Component statuses reported by a readiness Report
+const (
+	StatusOK   = "ok"
+	StatusFail = "fail"
+)
+
+// CheckFunc checks one component. It may return details to include in the
+// report whether or not the check fails.
+type CheckFunc func(ctx context.Context) (details any, err error)
+
+// ComponentStatus is the result of one check
+type ComponentStatus struct {
+	Status  string `json:"status"`
+	Error   string `json:"error,omitempty"`
+	Details any    `json:"details,omitempty"`
+}
+
+// Report is the result of a readiness check
+type Report struct {
+	Ready      bool                       `json:"ready"`
+	Components map[string]ComponentStatus `json:"components"`
+}
+
+type namedCheck struct {
+	name  string
+	check CheckFunc
+}
+
+// Checker runs the registered component checks concurrently. The service is
+// ready only if every check passes.
+type Checker struct {
+	timeout time.Duration
+	checks  []namedCheck
+}
+
+// NewChecker creates a Checker that gives each run at most timeout
+func NewChecker(timeout time.Duration) *Checker {
+	return &Checker{timeout: timeout}
+}
+
+// Add registers a component check. Checks must be added before Run is used.
+func (c *Checker) Add(name string, check CheckFunc) {
+	c.checks = append(c.checks, namedCheck{name: name, check: check})
+}
+
+// Run executes every check and reports the per-component results
+func (c *Checker) Run(ctx context.Context) Report {
+	ctx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+
+	report := Report{Ready: true, Components: make(map[string]ComponentStatus, len(c.checks))}
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for _, nc := range c.checks {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			details, err := nc.check(ctx)
+			status := ComponentStatus{Status: StatusOK, Details: details}
+			if err != nil {
+				status.Status = StatusFail
+				status.Error = err.Error()
+			}
+
+			mu.Lock()
+			defer mu.Unlock()
+			report.Components[nc.name] = status
+			if err != nil {
+				report.Ready = false
+			}
+		}()
+	}
+	wg.Wait()
+	return report
+}
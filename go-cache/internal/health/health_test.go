@@ -0,0 +1,97 @@
+package health
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+
+	"nft-proxy/internal/budget"
+)
+
+func TestChecker_FailsWhenAnyCheckFails(t *testing.T) {
+	c := NewChecker(time.Second)
+	c.Add("ok", func(context.Context) (any, error) { return map[string]int{"n": 1}, nil })
+	c.Add("broken", func(context.Context) (any, error) { return nil, errors.New("down") })
+
+	report := c.Run(context.Background())
+	if report.Ready {
+		t.Error("Expected report not to be ready")
+	}
+	if got := report.Components["broken"]; got.Status != StatusFail || got.Error != "down" {
+		t.Errorf("Unexpected status of failing check %+v", got)
+	}
+	if got := report.Components["ok"]; got.Status != StatusOK || got.Details == nil {
+		t.Errorf("Unexpected status of passing check %+v", got)
+	}
+}
+
+func TestChecker_TimesOutSlowChecks(t *testing.T) {
+	c := NewChecker(20 * time.Millisecond)
+	c.Add("slow", func(ctx context.Context) (any, error) {
+		<-ctx.Done()
+		return nil, ctx.Err()
+	})
+
+	start := time.Now()
+	if report := c.Run(context.Background()); report.Ready {
+		t.Error("Expected timed out check to fail")
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("Expected check to be cut off by the timeout, took %s", elapsed)
+	}
+}
+
+type probeClientFunc func(chain, network string) (int, error)
+
+func (f probeClientFunc) ProxyGET(_ context.Context, chain, network, _, _ string) ([]byte, int, error) {
+	status, err := f(chain, network)
+	return nil, status, err
+}
+
+func TestProber_FailsOnlyWhenEveryChainFails(t *testing.T) {
+	statuses := map[string]int{"eth": http.StatusOK, "base": http.StatusBadGateway}
+	client := probeClientFunc(func(chain, _ string) (int, error) {
+		return statuses[chain], nil
+	})
+	p := NewProber(client, ProbeOptions{Chains: []string{"eth-mainnet", "base-mainnet"}, Timeout: time.Second}, zap.NewNop())
+
+	if _, err := p.Check(context.Background()); err == nil {
+		t.Error("Expected check to fail before the first probe round")
+	}
+
+	p.ProbeAll(context.Background())
+	details, err := p.Check(context.Background())
+	if err != nil {
+		t.Fatalf("Expected one healthy chain to keep the service ready, got %v", err)
+	}
+	results := details.(map[string]ProbeResult)
+	if results["base-mainnet"].Status != StatusFail || results["eth-mainnet"].Status != StatusOK {
+		t.Errorf("Unexpected probe results %+v", results)
+	}
+
+	statuses["eth"] = http.StatusUnauthorized
+	p.ProbeAll(context.Background())
+	if _, err := p.Check(context.Background()); err == nil {
+		t.Error("Expected check to fail when every chain fails")
+	}
+}
+
+func TestProber_SkipsBudgetRejections(t *testing.T) {
+	client := probeClientFunc(func(string, string) (int, error) {
+		return 0, budget.ErrExhausted
+	})
+	p := NewProber(client, ProbeOptions{Chains: []string{"eth-mainnet"}, Timeout: time.Second}, zap.NewNop())
+
+	p.ProbeAll(context.Background())
+	details, err := p.Check(context.Background())
+	if err != nil {
+		t.Errorf("Expected exhausted budget not to fail readiness, got %v", err)
+	}
+	if got := details.(map[string]ProbeResult)["eth-mainnet"].Status; got != probeSkipped {
+		t.Errorf("Expected skipped probe, got %q", got)
+	}
+}
@@ -0,0 +1,190 @@
+package health
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+
+	"nft-proxy/internal/alchemy"
+	"nft-proxy/internal/budget"
+)
+
+// ProbeClient makes the synthetic upstream requests of a Prober
+type ProbeClient interface {
+	ProxyGET(ctx context.Context, chain, network, path, rawQuery string) ([]byte, int, error)
+}
+
+// ProbeOptions configures a Prober
+type ProbeOptions struct {
+	// Chains are canonical chain keys such as "eth-mainnet"
+	Chains []string
+	// Path and Query select a cheap NFT API request, e.g. "/getContractMetadata"
+	Path  string
+	Query string
+	// Interval between probe rounds; Check serves the latest results
+	Interval time.Duration
+	// Timeout bounds each probe request
+	Timeout time.Duration
+}
+
+// ProbeResult is the latest probe outcome of one chain
+type ProbeResult struct {
+	Status     string    `json:"status"`
+	StatusCode int       `json:"status_code,omitempty"`
+	Error      string    `json:"error,omitempty"`
+	CheckedAt  time.Time `json:"checked_at"`
+	LatencyMs  int64     `json:"latency_ms"`
+}
+
+// Probe statuses; skipped probes were held back by the compute-unit budget or
+// throttle and say nothing about upstream health
+const (
+	probeSkipped = "skipped"
+)
+
+// Prober periodically sends a cheap request to Alchemy for every chain and
+// caches the results, so readiness checks never wait on upstream calls
+type Prober struct {
+	client ProbeClient
+	opts   ProbeOptions
+	logger *zap.Logger
+
+	mu      sync.RWMutex
+	results map[string]ProbeResult
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+// NewProber creates a prober. Call Start to begin probing.
+func NewProber(client ProbeClient, opts ProbeOptions, logger *zap.Logger) *Prober {
+	chains := append([]string(nil), opts.Chains...)
+	sort.Strings(chains)
+	opts.Chains = chains
+
+	return &Prober{
+		client:  client,
+		opts:    opts,
+		logger:  logger,
+		results: make(map[string]ProbeResult, len(chains)),
+		stop:    make(chan struct{}),
+		done:    make(chan struct{}),
+	}
+}
+
+// Start probes every chain now and then once per interval until Stop
+func (p *Prober) Start() {
+	go func() {
+		defer close(p.done)
+
+		ticker := time.NewTicker(p.opts.Interval)
+		defer ticker.Stop()
+
+		for {
+			p.ProbeAll(context.Background())
+			select {
+			case <-ticker.C:
+			case <-p.stop:
+				return
+			}
+		}
+	}()
+}
+
+// Stop stops probing and waits for a running round to finish
+func (p *Prober) Stop() {
+	close(p.stop)
+	<-p.done
+}
+
+// ProbeAll probes every chain once, concurrently
+func (p *Prober) ProbeAll(ctx context.Context) {
+	var wg sync.WaitGroup
+	for _, chain := range p.opts.Chains {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			p.probe(ctx, chain)
+		}()
+	}
+	wg.Wait()
+}
+
+func (p *Prober) probe(ctx context.Context, chainKey string) {
+	ctx, cancel := context.WithTimeout(ctx, p.opts.Timeout)
+	defer cancel()
+
+	chain, network, _ := strings.Cut(chainKey, "-")
+	start := time.Now()
+	_, statusCode, err := p.client.ProxyGET(ctx, chain, network, p.opts.Path, p.opts.Query)
+
+	result := ProbeResult{
+		Status:     StatusOK,
+		StatusCode: statusCode,
+		CheckedAt:  start,
+		LatencyMs:  time.Since(start).Milliseconds(),
+	}
+	switch {
+	case errors.Is(err, budget.ErrExhausted) || errors.Is(err, alchemy.ErrThrottled):
+		result.Status = probeSkipped
+		result.Error = err.Error()
+	case err != nil:
+		result.Status = StatusFail
+		result.Error = err.Error()
+	case !probeHealthy(statusCode):
+		result.Status = StatusFail
+		result.Error = fmt.Sprintf("unexpected status %d", statusCode)
+	}
+	if result.Status == StatusFail {
+		p.logger.Warn("Alchemy probe failed", zap.String("chain", chainKey), zap.String("error", result.Error))
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.results[chainKey] = result
+}
+
+// probeHealthy reports whether a probe response shows a usable upstream.
+// Client errors other than auth failures still prove Alchemy answers.
+func probeHealthy(statusCode int) bool {
+	switch {
+	case statusCode >= http.StatusInternalServerError:
+		return false
+	case statusCode == http.StatusUnauthorized || statusCode == http.StatusForbidden:
+		return false
+	default:
+		return true
+	}
+}
+
+// Check is a CheckFunc over the latest probe results. It fails only when no
+// chain has a healthy result, since one unhealthy chain should not take the
+// whole service out of rotation.
+func (p *Prober) Check(_ context.Context) (any, error) {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	if len(p.results) == 0 {
+		return nil, errors.New("no probe results yet")
+	}
+
+	results := make(map[string]ProbeResult, len(p.results))
+	healthy := 0
+	for chain, result := range p.results {
+		results[chain] = result
+		if result.Status != StatusFail {
+			healthy++
+		}
+	}
+	if healthy == 0 {
+		return results, errors.New("alchemy probes failed on every chain")
+	}
+	return results, nil
+}
@@ -0,0 +1,88 @@
+package jwtauth
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// counterGrace keeps a token's count a little past its expiry, so a clock
+// skew cannot reset it while the token is still accepted somewhere
+const counterGrace = time.Minute
+
+// sweepInterval is how often a Memory counter drops expired tokens
+const sweepInterval = time.Minute
+
+// Memory counts token requests in one proxy instance
+type Memory struct {
+	now func() time.Time
+
+	mu        sync.Mutex
+	counts    map[string]*memoryCount
+	lastSweep time.Time
+}
+
+type memoryCount struct {
+	used      int64
+	expiresAt time.Time
+}
+
+// NewMemory creates an empty in-memory counter
+func NewMemory() *Memory {
+	return &Memory{now: time.Now, counts: make(map[string]*memoryCount)}
+}
+
+// Increment implements Counter
+func (m *Memory) Increment(_ context.Context, tokenID string, expiresAt time.Time) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := m.now()
+	if now.Sub(m.lastSweep) >= sweepInterval {
+		m.lastSweep = now
+		for id, count := range m.counts {
+			if now.After(count.expiresAt) {
+				delete(m.counts, id)
+			}
+		}
+	}
+
+	count, ok := m.counts[tokenID]
+	if !ok {
+		count = &memoryCount{expiresAt: expiresAt.Add(counterGrace)}
+		m.counts[tokenID] = count
+	}
+	count.used++
+	return count.used, nil
+}
+
+// keyPrefix namespaces the token counters in KeyDB
+const keyPrefix = "nft:jwt:"
+
+// KeyDB counts token requests across every proxy instance using the same
+// KeyDB. Counters expire shortly after their token.
+type KeyDB struct {
+	client redis.UniversalClient
+}
+
+// NewKeyDB creates a counter over an existing client
+func NewKeyDB(client redis.UniversalClient) *KeyDB {
+	return &KeyDB{client: client}
+}
+
+// Increment implements Counter
+func (k *KeyDB) Increment(ctx context.Context, tokenID string, expiresAt time.Time) (int64, error) {
+	key := keyPrefix + tokenID
+	var incr *redis.IntCmd
+	_, err := k.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		incr = pipe.Incr(ctx, key)
+		pipe.ExpireAt(ctx, key, expiresAt.Add(counterGrace))
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return incr.Val(), nil
+}
@@ -0,0 +1,198 @@
+// Package jwtauth validates the puzzle JWTs issued by the proxy-common auth
+// service and enforces their per-token request quota, so nft-proxy can
+// authenticate callers without the nginx auth_request hop.
+package jwtauth
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"nft-proxy/internal/metrics"
+)
+
+// Errors returned by Authenticate
+var (
+	ErrInvalidToken  = errors.New("invalid token")
+	ErrExpiredToken  = errors.New("token expired")
+	ErrQuotaExceeded = errors.New("token request quota exceeded")
+)
+
+// Secrets are the fields of the auth service's auth_config.json that
+// nft-proxy needs
+type Secrets struct {
+	JWTSecret        string `json:"jwt_secret"`
+	RequestsPerToken int64  `json:"requests_per_token"`
+}
+
+// LoadSecrets reads the auth service's configuration file
+func LoadSecrets(path string) (Secrets, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return Secrets{}, fmt.Errorf("failed to read auth config: %w", err)
+	}
+	var secrets Secrets
+	if err := json.Unmarshal(data, &secrets); err != nil {
+		return Secrets{}, fmt.Errorf("failed to parse auth config: %w", err)
+	}
+	if secrets.JWTSecret == "" {
+		return Secrets{}, fmt.Errorf("auth config %s has no jwt_secret", path)
+	}
+	return secrets, nil
+}
+
+// Claims are the validated claims of a token
+type Claims struct {
+	Subject   string
+	ExpiresAt time.Time
+}
+
+// Result describes an authenticated request
+type Result struct {
+	Claims Claims
+	// Limit and Remaining are the token's request quota, as reported in the
+	// X-Quota-* headers; Limit is 0 when tokens have no quota
+	Limit     int64
+	Remaining int64
+}
+
+// Counter counts the requests made with each token until it expires
+type Counter interface {
+	Increment(ctx context.Context, tokenID string, expiresAt time.Time) (int64, error)
+}
+
+// Authenticator validates tokens signed with the shared HS256 secret and
+// counts their requests
+type Authenticator struct {
+	secret  []byte
+	quota   int64
+	counter Counter
+	metrics *metrics.JWTAuthMetrics
+	now     func() time.Time
+}
+
+// New creates an authenticator. A zero RequestsPerToken disables the quota.
+func New(secrets Secrets, counter Counter) *Authenticator {
+	return &Authenticator{
+		secret:  []byte(secrets.JWTSecret),
+		quota:   secrets.RequestsPerToken,
+		counter: counter,
+		metrics: metrics.NewJWTAuthMetrics(),
+		now:     time.Now,
+	}
+}
+
+// Authenticate validates a token and charges one request to its quota. It
+// returns an error matching ErrInvalidToken, ErrExpiredToken or
+// ErrQuotaExceeded when the request must be rejected; the Result of a
+// request over quota is still filled in for the response headers.
+func (a *Authenticator) Authenticate(ctx context.Context, token string) (Result, error) {
+	claims, err := a.validate(token)
+	if err != nil {
+		if errors.Is(err, ErrExpiredToken) {
+			a.metrics.OnRequest("expired")
+		} else {
+			a.metrics.OnRequest("invalid")
+		}
+		return Result{}, err
+	}
+
+	result := Result{Claims: claims, Limit: a.quota}
+	if a.quota == 0 {
+		a.metrics.OnRequest("valid")
+		return result, nil
+	}
+
+	used, err := a.counter.Increment(ctx, TokenID(token), claims.ExpiresAt)
+	if err != nil {
+		return result, fmt.Errorf("failed to count token request: %w", err)
+	}
+	result.Remaining = max(0, a.quota-used)
+	if used > a.quota {
+		a.metrics.OnRequest("quota_exceeded")
+		return result, ErrQuotaExceeded
+	}
+	a.metrics.OnRequest("valid")
+	return result, nil
+}
+
+// header is the JOSE header of a token
+type header struct {
+	Alg string `json:"alg"`
+}
+
+// payload holds the registered claims nft-proxy checks
+type payload struct {
+	Subject   string   `json:"sub"`
+	ExpiresAt *float64 `json:"exp"`
+	NotBefore *float64 `json:"nbf"`
+}
+
+// validate checks a token's signature and validity period
+func (a *Authenticator) validate(token string) (Claims, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return Claims{}, fmt.Errorf("%w: malformed", ErrInvalidToken)
+	}
+
+	var h header
+	if err := decodeSegment(parts[0], &h); err != nil {
+		return Claims{}, err
+	}
+	// Only the algorithm the auth service signs with; never "none"
+	if h.Alg != "HS256" {
+		return Claims{}, fmt.Errorf("%w: unexpected algorithm %q", ErrInvalidToken, h.Alg)
+	}
+
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return Claims{}, fmt.Errorf("%w: malformed signature", ErrInvalidToken)
+	}
+	mac := hmac.New(sha256.New, a.secret)
+	mac.Write([]byte(parts[0] + "." + parts[1]))
+	if !hmac.Equal(signature, mac.Sum(nil)) {
+		return Claims{}, fmt.Errorf("%w: bad signature", ErrInvalidToken)
+	}
+
+	var p payload
+	if err := decodeSegment(parts[1], &p); err != nil {
+		return Claims{}, err
+	}
+	if p.ExpiresAt == nil {
+		return Claims{}, fmt.Errorf("%w: no expiry", ErrInvalidToken)
+	}
+	now := a.now()
+	expiresAt := time.Unix(int64(*p.ExpiresAt), 0)
+	if !now.Before(expiresAt) {
+		return Claims{}, ErrExpiredToken
+	}
+	if p.NotBefore != nil && now.Before(time.Unix(int64(*p.NotBefore), 0)) {
+		return Claims{}, fmt.Errorf("%w: not valid yet", ErrInvalidToken)
+	}
+	return Claims{Subject: p.Subject, ExpiresAt: expiresAt}, nil
+}
+
+func decodeSegment(segment string, v any) error {
+	data, err := base64.RawURLEncoding.DecodeString(segment)
+	if err != nil {
+		return fmt.Errorf("%w: malformed segment", ErrInvalidToken)
+	}
+	if err := json.Unmarshal(data, v); err != nil {
+		return fmt.Errorf("%w: malformed segment", ErrInvalidToken)
+	}
+	return nil
+}
+
+// TokenID identifies a token in counters without storing the token itself
+func TokenID(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:16])
+}
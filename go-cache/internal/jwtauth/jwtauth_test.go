@@ -0,0 +1,113 @@
+package jwtauth
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+)
+
+const testSecret = "test-secret"
+
+// signToken builds an HS256 token like the auth service does
+func signToken(t *testing.T, secret, header, payload string) string {
+	t.Helper()
+
+	signingInput := base64.RawURLEncoding.EncodeToString([]byte(header)) + "." + base64.RawURLEncoding.EncodeToString([]byte(payload))
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(signingInput))
+	return signingInput + "." + base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+func newTestAuthenticator(quota int64, counter Counter, now time.Time) *Authenticator {
+	a := New(Secrets{JWTSecret: testSecret, RequestsPerToken: quota}, counter)
+	a.now = func() time.Time { return now }
+	return a
+}
+
+func TestAuthenticate_ValidatesTokens(t *testing.T) {
+	now := time.Unix(1_800_000_000, 0)
+	a := newTestAuthenticator(0, NewMemory(), now)
+	hs256 := `{"alg":"HS256","typ":"JWT"}`
+
+	tests := []struct {
+		name  string
+		token string
+		err   error
+	}{
+		{"valid", signToken(t, testSecret, hs256, `{"sub":"abc","exp":1800000060}`), nil},
+		{"expired", signToken(t, testSecret, hs256, `{"exp":1800000000}`), ErrExpiredToken},
+		{"no expiry", signToken(t, testSecret, hs256, `{"sub":"abc"}`), ErrInvalidToken},
+		{"not valid yet", signToken(t, testSecret, hs256, `{"exp":1800000060,"nbf":1800000030}`), ErrInvalidToken},
+		{"other secret", signToken(t, "other", hs256, `{"exp":1800000060}`), ErrInvalidToken},
+		{"alg none", signToken(t, testSecret, `{"alg":"none"}`, `{"exp":1800000060}`), ErrInvalidToken},
+		{"malformed", "not.a.token", ErrInvalidToken},
+	}
+	for _, tt := range tests {
+		result, err := a.Authenticate(context.Background(), tt.token)
+		if !errors.Is(err, tt.err) {
+			t.Errorf("%s: expected %v, got %v", tt.name, tt.err, err)
+		}
+		if tt.err == nil && result.Claims.Subject != "abc" {
+			t.Errorf("%s: expected subject abc, got %q", tt.name, result.Claims.Subject)
+		}
+	}
+}
+
+func TestAuthenticate_EnforcesQuota(t *testing.T) {
+	now := time.Unix(1_800_000_000, 0)
+	a := newTestAuthenticator(2, NewMemory(), now)
+	token := signToken(t, testSecret, `{"alg":"HS256"}`, `{"exp":1800000600}`)
+
+	for i := range 2 {
+		result, err := a.Authenticate(context.Background(), token)
+		if err != nil {
+			t.Fatalf("Request %d: unexpected error %v", i, err)
+		}
+		if result.Limit != 2 || result.Remaining != int64(1-i) {
+			t.Errorf("Request %d: expected 2 limit and %d remaining, got %+v", i, 1-i, result)
+		}
+	}
+	if _, err := a.Authenticate(context.Background(), token); !errors.Is(err, ErrQuotaExceeded) {
+		t.Errorf("Expected ErrQuotaExceeded, got %v", err)
+	}
+}
+
+func TestKeyDB_CountsUntilTokenExpires(t *testing.T) {
+	server := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: server.Addr()})
+	defer client.Close()
+
+	counter := NewKeyDB(client)
+	expiresAt := time.Now().Add(10 * time.Minute)
+	for want := int64(1); want <= 2; want++ {
+		used, err := counter.Increment(context.Background(), "token", expiresAt)
+		if err != nil {
+			t.Fatalf("Increment failed: %v", err)
+		}
+		if used != want {
+			t.Errorf("Expected count %d, got %d", want, used)
+		}
+	}
+	if ttl := server.TTL(keyPrefix + "token"); ttl <= 10*time.Minute-time.Second || ttl > 11*time.Minute {
+		t.Errorf("Expected counter to expire shortly after the token, got TTL %s", ttl)
+	}
+}
+
+func TestLoadSecrets_RequiresSecret(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "auth_config.json")
+	if err := os.WriteFile(path, []byte(`{"jwt_secret":"","requests_per_token":100}`), 0o600); err != nil {
+		t.Fatalf("Failed to write auth config: %v", err)
+	}
+	if _, err := LoadSecrets(path); err == nil {
+		t.Error("Expected an error for an empty jwt_secret")
+	}
+}
@@ -0,0 +1,233 @@
+package limiter
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"sync"
+	"time"
+
+	"nft-proxy/internal/metrics"
+)
+
+var (
+	// ErrQueueFull is returned when no slot is free and the wait queue is full
+	ErrQueueFull = errors.New("upstream wait queue is full")
+	// ErrQueueTimeout is returned when a queued request did not get a slot in time
+	ErrQueueTimeout = errors.New("timed out waiting for upstream slot")
+)
+
+const (
+	// latencyTolerance is how far above the baseline latency a sample may be
+	// before it is treated as a sign of upstream saturation
+	latencyTolerance = 2.0
+	// backoffRatio is the multiplicative decrease applied on saturation
+	backoffRatio = 0.9
+	// baselineDrift lets the baseline slowly follow latency upwards so a
+	// permanently slower upstream does not pin the limit at the minimum
+	baselineDrift = 0.01
+)
+
+// Options configures a Limiter
+type Options struct {
+	Adaptive     bool
+	InitialLimit int
+	MinLimit     int
+	MaxLimit     int
+	MaxQueue     int
+	QueueTimeout time.Duration
+}
+
+// ReleaseFunc returns a slot to the limiter. latency is the observed duration
+// of the upstream call and overloaded reports whether the upstream signalled
+// saturation (errors, 429 or 5xx).
+type ReleaseFunc func(latency time.Duration, overloaded bool)
+
+// Limiter bounds the number of concurrent upstream calls. Requests that find
+// no free slot wait in a bounded queue, ordered by priority and then FIFO.
+// When Adaptive is set the limit is adjusted with AIMD: it grows while latency
+// stays near the observed baseline and shrinks when latency climbs or the
+// upstream reports overload.
+type Limiter struct {
+	opts    Options
+	metrics *metrics.ConcurrencyMetrics
+
+	mu       sync.Mutex
+	limit    float64
+	inflight int
+	queue    []waiter
+	baseline time.Duration
+}
+
+// waiter is a request queued for a slot
+type waiter struct {
+	ready    chan struct{}
+	priority int
+}
+
+type priorityKey struct{}
+
+// WithPriority returns a context whose Acquire calls are queued ahead of
+// those with a lower priority. The default priority is 0.
+func WithPriority(ctx context.Context, priority int) context.Context {
+	return context.WithValue(ctx, priorityKey{}, priority)
+}
+
+// New creates a new concurrency limiter
+func New(opts Options) *Limiter {
+	if opts.MinLimit < 1 {
+		opts.MinLimit = 1
+	}
+	if opts.MaxLimit < opts.MinLimit {
+		opts.MaxLimit = opts.MinLimit
+	}
+	if opts.InitialLimit < opts.MinLimit {
+		opts.InitialLimit = opts.MinLimit
+	}
+	if opts.InitialLimit > opts.MaxLimit {
+		opts.InitialLimit = opts.MaxLimit
+	}
+
+	l := &Limiter{
+		opts:    opts,
+		metrics: metrics.NewConcurrencyMetrics(),
+		limit:   float64(opts.InitialLimit),
+	}
+	l.metrics.SetLimit(opts.InitialLimit)
+	return l
+}
+
+// Acquire takes an upstream slot, waiting in the queue if none is free. It
+// returns ErrQueueFull or ErrQueueTimeout when the request should be shed.
+func (l *Limiter) Acquire(ctx context.Context) (ReleaseFunc, error) {
+	l.mu.Lock()
+	if l.inflight < int(l.limit) && len(l.queue) == 0 {
+		l.inflight++
+		l.reportLocked()
+		l.mu.Unlock()
+		return l.releaseFunc(), nil
+	}
+
+	if len(l.queue) >= l.opts.MaxQueue {
+		l.mu.Unlock()
+		l.metrics.OnShed("queue_full")
+		return nil, ErrQueueFull
+	}
+
+	ready := make(chan struct{})
+	priority, _ := ctx.Value(priorityKey{}).(int)
+	i := len(l.queue)
+	for i > 0 && l.queue[i-1].priority < priority {
+		i--
+	}
+	l.queue = slices.Insert(l.queue, i, waiter{ready: ready, priority: priority})
+	l.reportLocked()
+	l.mu.Unlock()
+
+	var timeout <-chan time.Time
+	if l.opts.QueueTimeout > 0 {
+		timer := time.NewTimer(l.opts.QueueTimeout)
+		defer timer.Stop()
+		timeout = timer.C
+	}
+
+	select {
+	case <-ready:
+		return l.releaseFunc(), nil
+	case <-timeout:
+		if l.dequeue(ready) {
+			l.metrics.OnShed("queue_timeout")
+			return nil, ErrQueueTimeout
+		}
+		// The slot was handed over just as the wait timed out
+		return l.releaseFunc(), nil
+	case <-ctx.Done():
+		if !l.dequeue(ready) {
+			// The slot was handed over while the caller was leaving; give it back
+			l.releaseFunc()(0, false)
+		}
+		return nil, ctx.Err()
+	}
+}
+
+// Limit returns the current concurrency limit
+func (l *Limiter) Limit() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return int(l.limit)
+}
+
+// releaseFunc returns a ReleaseFunc that is safe to call more than once
+func (l *Limiter) releaseFunc() ReleaseFunc {
+	var once sync.Once
+	return func(latency time.Duration, overloaded bool) {
+		once.Do(func() {
+			l.mu.Lock()
+			defer l.mu.Unlock()
+
+			l.inflight--
+			if latency > 0 || overloaded {
+				l.adjustLocked(latency, overloaded)
+			}
+			for len(l.queue) > 0 && l.inflight < int(l.limit) {
+				next := l.queue[0]
+				l.queue = l.queue[1:]
+				l.inflight++
+				close(next.ready)
+			}
+			l.reportLocked()
+		})
+	}
+}
+
+// dequeue removes a waiter from the queue. It returns false if the waiter
+// was already granted a slot.
+func (l *Limiter) dequeue(ready chan struct{}) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	for i, w := range l.queue {
+		if w.ready == ready {
+			l.queue = append(l.queue[:i], l.queue[i+1:]...)
+			l.reportLocked()
+			return true
+		}
+	}
+	return false
+}
+
+// adjustLocked applies one AIMD step for a completed upstream call
+func (l *Limiter) adjustLocked(latency time.Duration, overloaded bool) {
+	if !l.opts.Adaptive {
+		return
+	}
+
+	if !overloaded {
+		if l.baseline == 0 || latency < l.baseline {
+			l.baseline = latency
+		} else {
+			l.baseline += time.Duration(float64(latency-l.baseline) * baselineDrift)
+		}
+	}
+
+	switch {
+	case overloaded || float64(latency) > float64(l.baseline)*latencyTolerance:
+		l.limit *= backoffRatio
+	case float64(l.inflight+1) >= l.limit/2:
+		// Only grow while the current limit is actually being used
+		l.limit += 1 / l.limit
+	}
+
+	if l.limit < float64(l.opts.MinLimit) {
+		l.limit = float64(l.opts.MinLimit)
+	}
+	if l.limit > float64(l.opts.MaxLimit) {
+		l.limit = float64(l.opts.MaxLimit)
+	}
+}
+
+func (l *Limiter) reportLocked() {
+	l.metrics.SetLimit(int(l.limit))
+	l.metrics.SetInflight(l.inflight)
+	l.metrics.SetQueueDepth(len(l.queue))
+}
@@ -0,0 +1,162 @@
+package limiter
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestAcquire_QueueFull(t *testing.T) {
+	l := New(Options{InitialLimit: 1, MinLimit: 1, MaxLimit: 1, MaxQueue: 0})
+
+	release, err := l.Acquire(context.Background())
+	if err != nil {
+		t.Fatalf("Expected first acquire to succeed, got %v", err)
+	}
+	defer release(0, false)
+
+	if _, err := l.Acquire(context.Background()); !errors.Is(err, ErrQueueFull) {
+		t.Errorf("Expected ErrQueueFull, got %v", err)
+	}
+}
+
+func TestAcquire_QueueTimeout(t *testing.T) {
+	l := New(Options{InitialLimit: 1, MinLimit: 1, MaxLimit: 1, MaxQueue: 1, QueueTimeout: 10 * time.Millisecond})
+
+	release, err := l.Acquire(context.Background())
+	if err != nil {
+		t.Fatalf("Expected first acquire to succeed, got %v", err)
+	}
+	defer release(0, false)
+
+	if _, err := l.Acquire(context.Background()); !errors.Is(err, ErrQueueTimeout) {
+		t.Errorf("Expected ErrQueueTimeout, got %v", err)
+	}
+}
+
+func TestAcquire_HandsSlotToWaiter(t *testing.T) {
+	l := New(Options{InitialLimit: 1, MinLimit: 1, MaxLimit: 1, MaxQueue: 1, QueueTimeout: time.Second})
+
+	release, err := l.Acquire(context.Background())
+	if err != nil {
+		t.Fatalf("Expected first acquire to succeed, got %v", err)
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		next, err := l.Acquire(context.Background())
+		if err == nil {
+			next(0, false)
+		}
+		done <- err
+	}()
+
+	time.Sleep(10 * time.Millisecond)
+	release(0, false)
+
+	if err := <-done; err != nil {
+		t.Errorf("Expected queued acquire to succeed, got %v", err)
+	}
+}
+
+func TestAcquire_ServesHigherPriorityFirst(t *testing.T) {
+	l := New(Options{InitialLimit: 1, MinLimit: 1, MaxLimit: 1, MaxQueue: 2, QueueTimeout: time.Second})
+
+	release, err := l.Acquire(context.Background())
+	if err != nil {
+		t.Fatalf("Expected first acquire to succeed, got %v", err)
+	}
+
+	order := make(chan string, 2)
+	queue := func(name string, priority int) {
+		next, err := l.Acquire(WithPriority(context.Background(), priority))
+		if err != nil {
+			order <- err.Error()
+			return
+		}
+		order <- name
+		next(0, false)
+	}
+	go queue("low", 0)
+	time.Sleep(10 * time.Millisecond)
+	go queue("high", 10)
+	time.Sleep(10 * time.Millisecond)
+	release(0, false)
+
+	if first, second := <-order, <-order; first != "high" || second != "low" {
+		t.Errorf("Expected high priority waiter first, got %s then %s", first, second)
+	}
+}
+
+func TestAcquire_ContextCancelled(t *testing.T) {
+	l := New(Options{InitialLimit: 1, MinLimit: 1, MaxLimit: 1, MaxQueue: 1, QueueTimeout: time.Second})
+
+	release, err := l.Acquire(context.Background())
+	if err != nil {
+		t.Fatalf("Expected first acquire to succeed, got %v", err)
+	}
+	defer release(0, false)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	if _, err := l.Acquire(ctx); !errors.Is(err, context.Canceled) {
+		t.Errorf("Expected context.Canceled, got %v", err)
+	}
+}
+
+func TestAdaptive_ShrinksOnOverload(t *testing.T) {
+	l := New(Options{Adaptive: true, InitialLimit: 20, MinLimit: 5, MaxLimit: 50, MaxQueue: 10})
+
+	for i := 0; i < 50; i++ {
+		release, err := l.Acquire(context.Background())
+		if err != nil {
+			t.Fatalf("Unexpected acquire error: %v", err)
+		}
+		release(100*time.Millisecond, true)
+	}
+
+	if got := l.Limit(); got != 5 {
+		t.Errorf("Expected limit to shrink to the minimum 5, got %d", got)
+	}
+}
+
+func TestAdaptive_ShrinksOnLatencySpike(t *testing.T) {
+	l := New(Options{Adaptive: true, InitialLimit: 20, MinLimit: 5, MaxLimit: 50, MaxQueue: 10})
+
+	release, _ := l.Acquire(context.Background())
+	release(10*time.Millisecond, false)
+	before := l.Limit()
+
+	for i := 0; i < 5; i++ {
+		release, _ := l.Acquire(context.Background())
+		release(time.Second, false)
+	}
+
+	if got := l.Limit(); got >= before {
+		t.Errorf("Expected limit to shrink below %d after latency spike, got %d", before, got)
+	}
+}
+
+func TestAdaptive_GrowsUnderLoad(t *testing.T) {
+	l := New(Options{Adaptive: true, InitialLimit: 4, MinLimit: 1, MaxLimit: 50, MaxQueue: 10})
+
+	for round := 0; round < 20; round++ {
+		var releases []ReleaseFunc
+		for i := 0; i < l.Limit(); i++ {
+			release, err := l.Acquire(context.Background())
+			if err != nil {
+				t.Fatalf("Unexpected acquire error: %v", err)
+			}
+			releases = append(releases, release)
+		}
+		for _, release := range releases {
+			release(10*time.Millisecond, false)
+		}
+	}
+
+	if got := l.Limit(); got <= 4 {
+		t.Errorf("Expected limit to grow above 4 under steady load, got %d", got)
+	}
+}
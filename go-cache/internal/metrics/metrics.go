@@ -1,6 +1,9 @@
 package metrics
 
 import (
+	"strconv"
+	"time"
+
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promauto"
 
@@ -47,3 +50,671 @@ func (m *AlchemyHTTPMetrics) OnRequest(status string) {
 func (m *AlchemyHTTPMetrics) OnRetry() {
 	m.retries.Inc()
 }
+
+// ConcurrencyMetrics provides metrics for the upstream concurrency limiter
+type ConcurrencyMetrics struct {
+	limit      prometheus.Gauge
+	inflight   prometheus.Gauge
+	queueDepth prometheus.Gauge
+	shed       *prometheus.CounterVec
+}
+
+var (
+	upstreamConcurrencyLimit = promauto.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "nft_proxy_upstream_concurrency_limit",
+			Help: "Current limit on concurrent upstream requests",
+		},
+	)
+
+	upstreamInflight = promauto.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "nft_proxy_upstream_inflight",
+			Help: "Number of upstream requests currently in flight",
+		},
+	)
+
+	upstreamQueueDepth = promauto.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "nft_proxy_upstream_queue_depth",
+			Help: "Number of requests waiting for an upstream slot",
+		},
+	)
+
+	upstreamShed = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "nft_proxy_upstream_shed_total",
+			Help: "Total number of requests shed by the upstream concurrency limiter",
+		},
+		[]string{"reason"}, // reason: queue_full, queue_timeout
+	)
+)
+
+// NewConcurrencyMetrics creates a new metrics recorder for the concurrency limiter
+func NewConcurrencyMetrics() *ConcurrencyMetrics {
+	return &ConcurrencyMetrics{
+		limit:      upstreamConcurrencyLimit,
+		inflight:   upstreamInflight,
+		queueDepth: upstreamQueueDepth,
+		shed:       upstreamShed,
+	}
+}
+
+// SetLimit records the current concurrency limit
+func (m *ConcurrencyMetrics) SetLimit(limit int) {
+	m.limit.Set(float64(limit))
+}
+
+// SetInflight records the number of in-flight upstream requests
+func (m *ConcurrencyMetrics) SetInflight(n int) {
+	m.inflight.Set(float64(n))
+}
+
+// SetQueueDepth records the number of queued requests
+func (m *ConcurrencyMetrics) SetQueueDepth(n int) {
+	m.queueDepth.Set(float64(n))
+}
+
+// OnShed records a shed request
+func (m *ConcurrencyMetrics) OnShed(reason string) {
+	m.shed.WithLabelValues(reason).Inc()
+}
+
+// ThrottleMetrics provides metrics for client-side compute-unit pacing
+type ThrottleMetrics struct {
+	available *prometheus.GaugeVec
+	throttled *prometheus.CounterVec
+	wait      prometheus.Histogram
+}
+
+var (
+	alchemyComputeUnitsAvailable = promauto.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "nft_proxy_alchemy_compute_units_available",
+			Help: "Compute units currently available in the per-key token bucket",
+		},
+		[]string{"key_id"},
+	)
+
+	alchemyThrottled = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "nft_proxy_alchemy_throttled_total",
+			Help: "Total number of requests rejected because compute-unit budget was not available in time",
+		},
+		[]string{"key_id"},
+	)
+
+	alchemyThrottleWait = promauto.NewHistogram(
+		prometheus.HistogramOpts{
+			Name:    "nft_proxy_alchemy_throttle_wait_seconds",
+			Help:    "Time requests spent waiting for compute-unit budget",
+			Buckets: []float64{0.01, 0.05, 0.1, 0.25, 0.5, 1, 2, 5},
+		},
+	)
+)
+
+// NewThrottleMetrics creates a new metrics recorder for the compute-unit throttle
+func NewThrottleMetrics() *ThrottleMetrics {
+	return &ThrottleMetrics{
+		available: alchemyComputeUnitsAvailable,
+		throttled: alchemyThrottled,
+		wait:      alchemyThrottleWait,
+	}
+}
+
+// SetAvailable records the remaining compute-unit budget of a key. Budget that
+// is already reserved ahead is reported as zero.
+func (m *ThrottleMetrics) SetAvailable(keyID string, tokens float64) {
+	if tokens < 0 {
+		tokens = 0
+	}
+	m.available.WithLabelValues(keyID).Set(tokens)
+}
+
+// OnThrottled records a request rejected for lack of budget
+func (m *ThrottleMetrics) OnThrottled(keyID string) {
+	m.throttled.WithLabelValues(keyID).Inc()
+}
+
+// OnWait records time spent waiting for budget
+func (m *ThrottleMetrics) OnWait(d time.Duration) {
+	m.wait.Observe(d.Seconds())
+}
+
+// BreakerMetrics provides metrics for Alchemy circuit breakers and API key
+// quarantine
+type BreakerMetrics struct {
+	open        *prometheus.GaugeVec
+	quarantined *prometheus.GaugeVec
+}
+
+var (
+	alchemyCircuitOpen = promauto.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "nft_proxy_alchemy_circuit_open",
+			Help: "Whether the circuit breaker of a chain is open (1) or closed (0)",
+		},
+		[]string{"chain"},
+	)
+
+	alchemyKeyQuarantined = promauto.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "nft_proxy_alchemy_key_quarantined",
+			Help: "Whether an API key is quarantined after Alchemy rejected it (1) or not (0)",
+		},
+		[]string{"key_id"},
+	)
+)
+
+// NewBreakerMetrics creates a new metrics recorder for circuit breakers
+func NewBreakerMetrics() *BreakerMetrics {
+	return &BreakerMetrics{
+		open:        alchemyCircuitOpen,
+		quarantined: alchemyKeyQuarantined,
+	}
+}
+
+// SetOpen records whether a chain's circuit breaker is open
+func (m *BreakerMetrics) SetOpen(chain string, open bool) {
+	value := 0.0
+	if open {
+		value = 1
+	}
+	m.open.WithLabelValues(chain).Set(value)
+}
+
+// SetQuarantined records whether an API key is quarantined
+func (m *BreakerMetrics) SetQuarantined(keyID string, quarantined bool) {
+	value := 0.0
+	if quarantined {
+		value = 1
+	}
+	m.quarantined.WithLabelValues(keyID).Set(value)
+}
+
+// BudgetMetrics provides metrics for compute-unit accounting and budgets
+type BudgetMetrics struct {
+	spent       *prometheus.CounterVec
+	used        *prometheus.GaugeVec
+	state       *prometheus.GaugeVec
+	softReached *prometheus.CounterVec
+	rejected    *prometheus.CounterVec
+}
+
+var (
+	computeUnitsSpent = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "nft_proxy_compute_units_total",
+			Help: "Estimated Alchemy compute units spent",
+		},
+		[]string{"chain", "endpoint", "key_id"},
+	)
+
+	computeUnitsUsed = promauto.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "nft_proxy_compute_units_used",
+			Help: "Estimated compute units spent in the current budget period",
+		},
+		[]string{"period"}, // period: daily, monthly
+	)
+
+	computeUnitBudgetState = promauto.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "nft_proxy_compute_unit_budget_state",
+			Help: "Budget state per period: 0 under budget, 1 soft budget reached, 2 hard budget reached",
+		},
+		[]string{"period"},
+	)
+
+	computeUnitSoftBudgetReached = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "nft_proxy_compute_unit_soft_budget_reached_total",
+			Help: "Number of times a soft compute unit budget was reached",
+		},
+		[]string{"period"},
+	)
+
+	computeUnitBudgetRejections = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "nft_proxy_compute_unit_budget_rejections_total",
+			Help: "Total number of upstream calls rejected because a hard budget was reached",
+		},
+		[]string{"period"},
+	)
+)
+
+// NewBudgetMetrics creates a new metrics recorder for compute-unit budgets
+func NewBudgetMetrics() *BudgetMetrics {
+	return &BudgetMetrics{
+		spent:       computeUnitsSpent,
+		used:        computeUnitsUsed,
+		state:       computeUnitBudgetState,
+		softReached: computeUnitSoftBudgetReached,
+		rejected:    computeUnitBudgetRejections,
+	}
+}
+
+// OnSpend records compute units spent on one upstream call
+func (m *BudgetMetrics) OnSpend(chain, endpoint, keyID string, units int) {
+	m.spent.WithLabelValues(chain, endpoint, keyID).Add(float64(units))
+}
+
+// SetUsed records compute units spent in the current period
+func (m *BudgetMetrics) SetUsed(period string, units int64) {
+	m.used.WithLabelValues(period).Set(float64(units))
+}
+
+// SetBudgetState records the budget state of a period
+func (m *BudgetMetrics) SetBudgetState(period string, state int) {
+	m.state.WithLabelValues(period).Set(float64(state))
+}
+
+// OnSoftBudgetReached records a soft budget being crossed
+func (m *BudgetMetrics) OnSoftBudgetReached(period string) {
+	m.softReached.WithLabelValues(period).Inc()
+}
+
+// OnRejected records an upstream call rejected by a hard budget
+func (m *BudgetMetrics) OnRejected(period string) {
+	m.rejected.WithLabelValues(period).Inc()
+}
+
+// latencyBuckets cover cache hits served in microseconds up to slow upstream
+// calls that run into the request timeout
+var latencyBuckets = []float64{0.001, 0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30}
+
+// RequestMetrics provides metrics for requests served by the proxy handler
+type RequestMetrics struct {
+	requests *prometheus.CounterVec
+	duration *prometheus.HistogramVec
+	inflight prometheus.Gauge
+}
+
+var (
+	proxyRequests = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "nft_proxy_http_requests_total",
+			Help: "Total number of requests served by the proxy handler",
+		},
+		[]string{"chain", "endpoint", "status_class"},
+	)
+
+	proxyRequestDuration = promauto.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "nft_proxy_http_request_duration_seconds",
+			Help:    "Time taken to serve proxy requests, including streaming the body",
+			Buckets: latencyBuckets,
+		},
+		[]string{"chain", "endpoint", "status_class"},
+	)
+
+	proxyRequestsInflight = promauto.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "nft_proxy_http_requests_in_flight",
+			Help: "Number of proxy requests currently being served",
+		},
+	)
+)
+
+// NewRequestMetrics creates a new metrics recorder for the proxy handler
+func NewRequestMetrics() *RequestMetrics {
+	return &RequestMetrics{
+		requests: proxyRequests,
+		duration: proxyRequestDuration,
+		inflight: proxyRequestsInflight,
+	}
+}
+
+// OnStart records a request entering the handler
+func (m *RequestMetrics) OnStart() {
+	m.inflight.Inc()
+}
+
+// OnFinish records a request leaving the handler with the given status code
+func (m *RequestMetrics) OnFinish(chain, endpoint string, status int, d time.Duration) {
+	m.inflight.Dec()
+	class := StatusClass(status)
+	m.requests.WithLabelValues(chain, endpoint, class).Inc()
+	m.duration.WithLabelValues(chain, endpoint, class).Observe(d.Seconds())
+}
+
+// UpstreamMetrics provides per chain and endpoint metrics for Alchemy calls
+type UpstreamMetrics struct {
+	requests *prometheus.CounterVec
+	duration *prometheus.HistogramVec
+}
+
+var (
+	upstreamRequests = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "nft_proxy_upstream_requests_total",
+			Help: "Total number of Alchemy API calls, counting every retry attempt",
+		},
+		[]string{"chain", "endpoint", "status_class"},
+	)
+
+	upstreamRequestDuration = promauto.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "nft_proxy_upstream_request_duration_seconds",
+			Help:    "Time until Alchemy responded with headers, per attempt",
+			Buckets: latencyBuckets,
+		},
+		[]string{"chain", "endpoint", "status_class"},
+	)
+)
+
+// NewUpstreamMetrics creates a new metrics recorder for Alchemy calls
+func NewUpstreamMetrics() *UpstreamMetrics {
+	return &UpstreamMetrics{
+		requests: upstreamRequests,
+		duration: upstreamRequestDuration,
+	}
+}
+
+// OnResponse records one upstream attempt. A status of 0 means the attempt
+// failed without a response.
+func (m *UpstreamMetrics) OnResponse(chain, endpoint string, status int, d time.Duration) {
+	class := StatusClass(status)
+	m.requests.WithLabelValues(chain, endpoint, class).Inc()
+	m.duration.WithLabelValues(chain, endpoint, class).Observe(d.Seconds())
+}
+
+// StatusClass returns the class of an HTTP status code such as "2xx", or
+// "error" for requests that never got a status
+func StatusClass(status int) string {
+	switch {
+	case status >= 100 && status < 600:
+		return strconv.Itoa(status/100) + "xx"
+	default:
+		return "error"
+	}
+}
+
+// CacheMetrics provides metrics for the response cache and its tiers
+type CacheMetrics struct {
+	lookups   *prometheus.CounterVec
+	entries   *prometheus.GaugeVec
+	bytes     *prometheus.GaugeVec
+	evictions *prometheus.CounterVec
+	errors    *prometheus.CounterVec
+	duration  *prometheus.HistogramVec
+}
+
+var (
+	cacheLookups = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "nft_proxy_cache_lookups_total",
+			Help: "Total number of cache lookups per tier and endpoint",
+		},
+		[]string{"tier", "endpoint", "result"}, // result: hit, negative_hit, miss, stale
+	)
+
+	cacheEntries = promauto.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "nft_proxy_cache_entries",
+			Help: "Number of entries held by a cache tier",
+		},
+		[]string{"tier"},
+	)
+
+	cacheBytes = promauto.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "nft_proxy_cache_bytes",
+			Help: "Total body size of the entries held by a cache tier",
+		},
+		[]string{"tier"},
+	)
+
+	cacheEvictions = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "nft_proxy_cache_evictions_total",
+			Help: "Total number of entries evicted from a cache tier to make room",
+		},
+		[]string{"tier"},
+	)
+
+	cacheErrors = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "nft_proxy_cache_errors_total",
+			Help: "Total number of failed cache tier operations",
+		},
+		[]string{"tier", "operation"}, // operation: get, set, delete
+	)
+
+	cacheOperationDuration = promauto.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "nft_proxy_cache_operation_duration_seconds",
+			Help:    "Time taken by cache tier operations",
+			Buckets: []float64{0.00001, 0.0001, 0.0005, 0.001, 0.0025, 0.005, 0.01, 0.025, 0.05, 0.1, 0.25},
+		},
+		[]string{"tier", "operation"},
+	)
+)
+
+// NewCacheMetrics creates a new metrics recorder for the response cache
+func NewCacheMetrics() *CacheMetrics {
+	return &CacheMetrics{
+		lookups:   cacheLookups,
+		entries:   cacheEntries,
+		bytes:     cacheBytes,
+		evictions: cacheEvictions,
+		errors:    cacheErrors,
+		duration:  cacheOperationDuration,
+	}
+}
+
+// OnLookup records the result of looking a key up in one tier
+func (m *CacheMetrics) OnLookup(tier, endpoint, result string) {
+	m.lookups.WithLabelValues(tier, endpoint, result).Inc()
+}
+
+// OnOperation records the duration and outcome of a tier operation
+func (m *CacheMetrics) OnOperation(tier, operation string, d time.Duration, err error) {
+	m.duration.WithLabelValues(tier, operation).Observe(d.Seconds())
+	if err != nil {
+		m.errors.WithLabelValues(tier, operation).Inc()
+	}
+}
+
+// SetSize records the number of entries and bytes held by a tier
+func (m *CacheMetrics) SetSize(tier string, entries int, bytes int64) {
+	m.entries.WithLabelValues(tier).Set(float64(entries))
+	m.bytes.WithLabelValues(tier).Set(float64(bytes))
+}
+
+// OnEviction records an entry evicted from a tier
+func (m *CacheMetrics) OnEviction(tier string) {
+	m.evictions.WithLabelValues(tier).Inc()
+}
+
+// WebhookMetrics provides metrics for Alchemy Notify webhooks
+type WebhookMetrics struct {
+	requests      *prometheus.CounterVec
+	invalidations prometheus.Counter
+}
+
+var (
+	webhookRequests = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "nft_proxy_webhook_requests_total",
+			Help: "Total number of Alchemy webhook deliveries by result",
+		},
+		[]string{"result"},
+	)
+
+	webhookInvalidations = promauto.NewCounter(
+		prometheus.CounterOpts{
+			Name: "nft_proxy_webhook_invalidated_entries_total",
+			Help: "Total number of cache entries removed by webhook events, summed over tiers",
+		},
+	)
+)
+
+// NewWebhookMetrics creates a new metrics recorder for webhooks
+func NewWebhookMetrics() *WebhookMetrics {
+	return &WebhookMetrics{
+		requests:      webhookRequests,
+		invalidations: webhookInvalidations,
+	}
+}
+
+// OnRequest records a webhook delivery with its result, e.g. "ok" or
+// "invalid_signature", and the number of cache entries it removed
+func (m *WebhookMetrics) OnRequest(result string, invalidated int) {
+	m.requests.WithLabelValues(result).Inc()
+	m.invalidations.Add(float64(invalidated))
+}
+
+// WarmupMetrics provides metrics for cache warmup
+type WarmupMetrics struct {
+	requests *prometheus.CounterVec
+}
+
+var warmupRequests = promauto.NewCounterVec(
+	prometheus.CounterOpts{
+		Name: "nft_proxy_warmup_requests_total",
+		Help: "Total number of cache warmup requests by source (seed, hot) and result",
+	},
+	[]string{"source", "result"},
+)
+
+// NewWarmupMetrics creates a new metrics recorder for cache warmup
+func NewWarmupMetrics() *WarmupMetrics {
+	return &WarmupMetrics{requests: warmupRequests}
+}
+
+// OnRequest records the result of one warmup request, e.g. "ok" or "fresh"
+func (m *WarmupMetrics) OnRequest(source, result string) {
+	m.requests.WithLabelValues(source, result).Inc()
+}
+
+// SpamMetrics provides metrics for the spam filter
+type SpamMetrics struct {
+	items *prometheus.CounterVec
+}
+
+var spamItems = promauto.NewCounterVec(
+	prometheus.CounterOpts{
+		Name: "nft_proxy_spam_items_total",
+		Help: "Total number of response items classified as spam by endpoint, reason and action (flag, drop)",
+	},
+	[]string{"endpoint", "reason", "action"},
+)
+
+// NewSpamMetrics creates a new metrics recorder for the spam filter
+func NewSpamMetrics() *SpamMetrics {
+	return &SpamMetrics{items: spamItems}
+}
+
+// OnItem records a spam item flagged or dropped from a response
+func (m *SpamMetrics) OnItem(endpoint, reason, action string) {
+	m.items.WithLabelValues(endpoint, reason, action).Inc()
+}
+
+// TenantMetrics provides metrics for per-tenant policies
+type TenantMetrics struct {
+	requests     *prometheus.CounterVec
+	computeUnits *prometheus.CounterVec
+}
+
+var (
+	tenantRequests = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "nft_proxy_tenant_requests_total",
+			Help: "Total number of requests by tenant and result (allowed, forbidden, rate_limited); allowed cache misses refused for the daily budget also count as budget_exhausted",
+		},
+		[]string{"tenant", "result"},
+	)
+
+	tenantComputeUnits = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "nft_proxy_tenant_compute_units_total",
+			Help: "Estimated compute units spent on upstream calls by tenant",
+		},
+		[]string{"tenant"},
+	)
+)
+
+// NewTenantMetrics creates a new metrics recorder for tenant policies
+func NewTenantMetrics() *TenantMetrics {
+	return &TenantMetrics{requests: tenantRequests, computeUnits: tenantComputeUnits}
+}
+
+// OnRequest records the admission result of a tenant's request
+func (m *TenantMetrics) OnRequest(tenant, result string) {
+	m.requests.WithLabelValues(tenant, result).Inc()
+}
+
+// OnSpend records the compute units of an upstream call made for a tenant
+func (m *TenantMetrics) OnSpend(tenant string, cost int) {
+	m.computeUnits.WithLabelValues(tenant).Add(float64(cost))
+}
+
+// RateLimitMetrics provides metrics for the per-client rate limit
+type RateLimitMetrics struct {
+	requests *prometheus.CounterVec
+}
+
+var rateLimitRequests = promauto.NewCounterVec(
+	prometheus.CounterOpts{
+		Name: "nft_proxy_rate_limit_requests_total",
+		Help: "Total number of requests checked against the per-client rate limit by result (allowed, limited, error)",
+	},
+	[]string{"result"},
+)
+
+// NewRateLimitMetrics creates a new metrics recorder for the rate limit
+func NewRateLimitMetrics() *RateLimitMetrics {
+	return &RateLimitMetrics{requests: rateLimitRequests}
+}
+
+// OnRequest records the result of a rate limit check
+func (m *RateLimitMetrics) OnRequest(result string) {
+	m.requests.WithLabelValues(result).Inc()
+}
+
+// JWTAuthMetrics provides metrics for native JWT authentication
+type JWTAuthMetrics struct {
+	requests *prometheus.CounterVec
+}
+
+var jwtAuthRequests = promauto.NewCounterVec(
+	prometheus.CounterOpts{
+		Name: "nft_proxy_jwt_auth_total",
+		Help: "Total number of JWTs checked by nft-proxy by result (valid, invalid, expired, quota_exceeded)",
+	},
+	[]string{"result"},
+)
+
+// NewJWTAuthMetrics creates a new metrics recorder for JWT authentication
+func NewJWTAuthMetrics() *JWTAuthMetrics {
+	return &JWTAuthMetrics{requests: jwtAuthRequests}
+}
+
+// OnRequest records the result of a token check
+func (m *JWTAuthMetrics) OnRequest(result string) {
+	m.requests.WithLabelValues(result).Inc()
+}
+
+// SignedURLMetrics provides metrics for signed URLs
+type SignedURLMetrics struct {
+	requests *prometheus.CounterVec
+}
+
+var signedURLRequests = promauto.NewCounterVec(
+	prometheus.CounterOpts{
+		Name: "nft_proxy_signed_url_requests_total",
+		Help: "Total number of signed URL checks by result (valid, invalid, expired); valid URLs used outside their scope also count as out_of_scope",
+	},
+	[]string{"result"},
+)
+
+// NewSignedURLMetrics creates a new metrics recorder for signed URLs
+func NewSignedURLMetrics() *SignedURLMetrics {
+	return &SignedURLMetrics{requests: signedURLRequests}
+}
+
+// OnRequest records the result of a signed URL check
+func (m *SignedURLMetrics) OnRequest(result string) {
+	m.requests.WithLabelValues(result).Inc()
+}
@@ -0,0 +1,131 @@
+// Package projection prunes JSON responses down to the fields a client asks
+// for, so the full upstream response can be cached once and trimmed on the
+// way out.
+package projection
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// Param is the query parameter selecting the fields of a response
+const Param = "fields"
+
+// presetPrefix marks a named preset in a field list, e.g. "@wallet"
+const presetPrefix = "@"
+
+// maxFields bounds the number of paths in one projection
+const maxFields = 100
+
+// node is one level of a projection. A nil node keeps the whole value.
+type node map[string]node
+
+// Projection selects fields of a JSON document by dotted path, such as
+// "ownedNfts.image.thumbnailUrl". Arrays are traversed transparently, so a
+// path applies to every element.
+type Projection struct {
+	root node
+}
+
+// Parse builds a projection from a comma-separated list of dotted paths and
+// @preset names, which expand to the paths listed in presets
+func Parse(spec string, presets map[string][]string) (*Projection, error) {
+	var paths []string
+	for _, field := range strings.Split(spec, ",") {
+		field = strings.TrimSpace(field)
+		if field == "" {
+			continue
+		}
+		if name, ok := strings.CutPrefix(field, presetPrefix); ok {
+			preset, ok := presets[name]
+			if !ok {
+				return nil, fmt.Errorf("unknown field preset %q", name)
+			}
+			paths = append(paths, preset...)
+			continue
+		}
+		paths = append(paths, field)
+	}
+	if len(paths) == 0 {
+		return nil, fmt.Errorf("no fields selected")
+	}
+	if len(paths) > maxFields {
+		return nil, fmt.Errorf("too many fields, at most %d are allowed", maxFields)
+	}
+
+	root := node{}
+	for _, path := range paths {
+		if err := root.add(strings.Split(path, ".")); err != nil {
+			return nil, fmt.Errorf("invalid field %q: %w", path, err)
+		}
+	}
+	return &Projection{root: root}, nil
+}
+
+// add adds a path below n. A path that ends at a node already kept whole, or
+// that is a prefix of longer paths, keeps the whole value.
+func (n node) add(segments []string) error {
+	name := segments[0]
+	if name == "" {
+		return fmt.Errorf("empty path segment")
+	}
+	child, exists := n[name]
+	if len(segments) == 1 {
+		n[name] = nil
+		return nil
+	}
+	if exists && child == nil {
+		return nil
+	}
+	if child == nil {
+		child = node{}
+		n[name] = child
+	}
+	return child.add(segments[1:])
+}
+
+// Apply returns body pruned to the projection's fields. Numbers are copied
+// verbatim, but object keys are re-encoded in sorted order.
+func (p *Projection) Apply(body []byte) ([]byte, error) {
+	decoder := json.NewDecoder(bytes.NewReader(body))
+	decoder.UseNumber()
+	var doc any
+	if err := decoder.Decode(&doc); err != nil {
+		return nil, fmt.Errorf("failed to decode response: %w", err)
+	}
+
+	var out bytes.Buffer
+	encoder := json.NewEncoder(&out)
+	encoder.SetEscapeHTML(false)
+	if err := encoder.Encode(p.root.prune(doc)); err != nil {
+		return nil, fmt.Errorf("failed to encode response: %w", err)
+	}
+	return bytes.TrimSuffix(out.Bytes(), []byte{'\n'}), nil
+}
+
+// prune keeps the fields of value selected by n
+func (n node) prune(value any) any {
+	if n == nil {
+		return value
+	}
+	switch v := value.(type) {
+	case map[string]any:
+		pruned := make(map[string]any, len(n))
+		for name, child := range n {
+			if field, ok := v[name]; ok {
+				pruned[name] = child.prune(field)
+			}
+		}
+		return pruned
+	case []any:
+		for i, element := range v {
+			v[i] = n.prune(element)
+		}
+		return v
+	default:
+		// Scalars have no fields to select from
+		return value
+	}
+}
@@ -0,0 +1,48 @@
+package projection
+
+import (
+	"testing"
+)
+
+func TestApply(t *testing.T) {
+	body := []byte(`{"ownedNfts":[{"tokenId":"1","name":"<a>","raw":{"metadata":{}},"image":{"thumbnailUrl":"t","originalUrl":"o"}},` +
+		`{"tokenId":"2","balance":12345678901234567890}],"totalCount":2,"pageKey":"k"}`)
+
+	p, err := Parse("ownedNfts.tokenId, ownedNfts.name,ownedNfts.image.thumbnailUrl,@paging", map[string][]string{
+		"paging": {"pageKey"},
+	})
+	if err != nil {
+		t.Fatalf("Failed to parse projection: %v", err)
+	}
+	got, err := p.Apply(body)
+	if err != nil {
+		t.Fatalf("Failed to apply projection: %v", err)
+	}
+
+	expected := `{"ownedNfts":[{"image":{"thumbnailUrl":"t"},"name":"<a>","tokenId":"1"},{"tokenId":"2"}],"pageKey":"k"}`
+	if string(got) != expected {
+		t.Errorf("Expected %s, got %s", expected, got)
+	}
+}
+
+func TestApply_PrefixKeepsWholeValue(t *testing.T) {
+	p, err := Parse("a.b,a", nil)
+	if err != nil {
+		t.Fatalf("Failed to parse projection: %v", err)
+	}
+	got, err := p.Apply([]byte(`{"a":{"b":1,"c":12345678901234567890},"d":3}`))
+	if err != nil {
+		t.Fatalf("Failed to apply projection: %v", err)
+	}
+	if expected := `{"a":{"b":1,"c":12345678901234567890}}`; string(got) != expected {
+		t.Errorf("Expected %s, got %s", expected, got)
+	}
+}
+
+func TestParse_RejectsInvalidFields(t *testing.T) {
+	for _, spec := range []string{"", " , ", "a..b", "@missing"} {
+		if _, err := Parse(spec, nil); err == nil {
+			t.Errorf("Expected %q to be rejected", spec)
+		}
+	}
+}
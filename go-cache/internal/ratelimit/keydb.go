@@ -0,0 +1,64 @@
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// keyPrefix namespaces the rate limit state in KeyDB
+const keyPrefix = "nft:ratelimit:"
+
+// gcraScript applies GCRA atomically using the server's clock, so instances
+// with skewed clocks agree. Times are in microseconds. It returns whether
+// the request is allowed, how far the TAT is ahead of now and, when the
+// request is rejected, how long until it would be allowed.
+var gcraScript = redis.NewScript(`
+local time = redis.call('TIME')
+local now = tonumber(time[1]) * 1000000 + tonumber(time[2])
+local increment = tonumber(ARGV[1])
+local tolerance = tonumber(ARGV[2])
+
+local tat = tonumber(redis.call('GET', KEYS[1]) or 0)
+if tat < now then
+  tat = now
+end
+local new_tat = tat + increment
+local allow_at = new_tat - tolerance
+if now < allow_at then
+  return {0, tat - now, allow_at - now}
+end
+
+-- A free request (hit cost 0) from an idle client leaves nothing to store,
+-- and PX must be positive
+if new_tat > now then
+  redis.call('SET', KEYS[1], string.format('%.0f', new_tat), 'PX', math.max(1, math.ceil((new_tat - now) / 1000)))
+end
+return {1, new_tat - now, 0}
+`)
+
+// KeyDB is a Store shared by every proxy instance using the same KeyDB.
+// Each client's state expires once its allowance is fully restored.
+type KeyDB struct {
+	client redis.UniversalClient
+}
+
+// NewKeyDB creates a store over an existing client
+func NewKeyDB(client redis.UniversalClient) *KeyDB {
+	return &KeyDB{client: client}
+}
+
+// Take implements Store
+func (k *KeyDB) Take(ctx context.Context, key string, increment, tolerance time.Duration) (bool, time.Duration, time.Duration, error) {
+	values, err := gcraScript.Run(ctx, k.client, []string{keyPrefix + key},
+		increment.Microseconds(), tolerance.Microseconds()).Int64Slice()
+	if err != nil {
+		return false, 0, 0, fmt.Errorf("failed to take rate limit: %w", err)
+	}
+	if len(values) != 3 {
+		return false, 0, 0, fmt.Errorf("unexpected rate limit script result %v", values)
+	}
+	return values[0] == 1, time.Duration(values[1]) * time.Microsecond, time.Duration(values[2]) * time.Microsecond, nil
+}
@@ -0,0 +1,59 @@
+package ratelimit
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// sweepInterval is how often a Memory store drops clients whose allowance is
+// fully restored
+const sweepInterval = time.Minute
+
+// Memory is a Store local to one proxy instance
+type Memory struct {
+	now func() time.Time
+
+	mu        sync.Mutex
+	tat       map[string]time.Time
+	lastSweep time.Time
+}
+
+// NewMemory creates an empty in-memory store
+func NewMemory() *Memory {
+	return &Memory{now: time.Now, tat: make(map[string]time.Time)}
+}
+
+// Take implements Store
+func (m *Memory) Take(_ context.Context, key string, increment, tolerance time.Duration) (bool, time.Duration, time.Duration, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := m.now()
+	m.sweepLocked(now)
+
+	tat := m.tat[key]
+	if tat.Before(now) {
+		tat = now
+	}
+	newTAT := tat.Add(increment)
+	if allowAt := newTAT.Add(-tolerance); now.Before(allowAt) {
+		return false, tat.Sub(now), allowAt.Sub(now), nil
+	}
+	m.tat[key] = newTAT
+	return true, newTAT.Sub(now), 0, nil
+}
+
+// sweepLocked removes clients whose TAT has passed, as they are
+// indistinguishable from new ones
+func (m *Memory) sweepLocked(now time.Time) {
+	if now.Sub(m.lastSweep) < sweepInterval {
+		return
+	}
+	m.lastSweep = now
+	for key, tat := range m.tat {
+		if !tat.After(now) {
+			delete(m.tat, key)
+		}
+	}
+}
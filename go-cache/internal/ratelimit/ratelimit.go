@@ -0,0 +1,107 @@
+// Package ratelimit limits the request rate of each client with the generic
+// cell rate algorithm (GCRA), keeping state in memory or in KeyDB so several
+// proxy instances share one limit.
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"time"
+
+	"nft-proxy/internal/metrics"
+)
+
+// Options configures a Limiter
+type Options struct {
+	// Requests per Period is the sustained rate of each client
+	Requests int
+	Period   time.Duration
+	// Burst is how many requests a client can make at once; it defaults to
+	// Requests
+	Burst int
+	// HitCost is the share of a request charged for a cache hit, from 0 to
+	// 1; misses always cost 1
+	HitCost float64
+}
+
+// Result describes a client's limit after a request, in the terms of the
+// X-RateLimit-* headers
+type Result struct {
+	Allowed bool
+	// Limit is the number of requests a client with no recent traffic can make
+	Limit int
+	// Remaining is the number of full-cost requests the client can still make
+	Remaining int
+	// Reset is the time until the client's allowance is fully restored
+	Reset time.Duration
+	// RetryAfter is the time until a rejected request would be allowed
+	RetryAfter time.Duration
+}
+
+// Store keeps the theoretical arrival time (TAT) of each client. Take
+// charges increment to key unless its TAT would end up more than tolerance
+// ahead of now. It returns how far ahead of now the TAT is after the call
+// and, for rejected requests, when the request would be allowed.
+type Store interface {
+	Take(ctx context.Context, key string, increment, tolerance time.Duration) (allowed bool, ahead, retryAfter time.Duration, err error)
+}
+
+// Limiter enforces one rate limit per client key
+type Limiter struct {
+	opts     Options
+	store    Store
+	metrics  *metrics.RateLimitMetrics
+	interval time.Duration
+}
+
+// New creates a limiter over a store
+func New(opts Options, store Store) (*Limiter, error) {
+	if opts.Requests < 1 || opts.Period <= 0 {
+		return nil, fmt.Errorf("rate limit needs a positive number of requests per period")
+	}
+	if opts.HitCost < 0 || opts.HitCost > 1 {
+		return nil, fmt.Errorf("rate limit hit cost must be between 0 and 1, got %g", opts.HitCost)
+	}
+	if opts.Burst < 1 {
+		opts.Burst = opts.Requests
+	}
+
+	return &Limiter{
+		opts:     opts,
+		store:    store,
+		metrics:  metrics.NewRateLimitMetrics(),
+		interval: opts.Period / time.Duration(opts.Requests),
+	}, nil
+}
+
+// Take charges one request of a client, at the hit cost for cache hits. A
+// store error is returned with an allowing result, so an unavailable KeyDB
+// does not take the proxy down.
+func (l *Limiter) Take(ctx context.Context, key string, hit bool) (Result, error) {
+	cost := 1.0
+	if hit {
+		cost = l.opts.HitCost
+	}
+	tolerance := l.interval * time.Duration(l.opts.Burst)
+
+	allowed, ahead, retryAfter, err := l.store.Take(ctx, key, time.Duration(cost*float64(l.interval)), tolerance)
+	if err != nil {
+		l.metrics.OnRequest("error")
+		return Result{Allowed: true, Limit: l.opts.Burst, Remaining: l.opts.Burst}, err
+	}
+	if allowed {
+		l.metrics.OnRequest("allowed")
+	} else {
+		l.metrics.OnRequest("limited")
+	}
+
+	remaining := int(math.Floor(float64(tolerance-ahead) / float64(l.interval)))
+	return Result{
+		Allowed:    allowed,
+		Limit:      l.opts.Burst,
+		Remaining:  max(0, remaining),
+		Reset:      ahead,
+		RetryAfter: retryAfter,
+	}, nil
+}
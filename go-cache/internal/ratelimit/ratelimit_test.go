@@ -0,0 +1,133 @@
+package ratelimit
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+)
+
+func newTestLimiter(t *testing.T, opts Options, store Store) *Limiter {
+	t.Helper()
+
+	l, err := New(opts, store)
+	if err != nil {
+		t.Fatalf("Failed to create limiter: %v", err)
+	}
+	return l
+}
+
+func TestTake_LimitsBurstAndRefills(t *testing.T) {
+	store := NewMemory()
+	now := time.Date(2026, 3, 10, 12, 0, 0, 0, time.UTC)
+	store.now = func() time.Time { return now }
+	l := newTestLimiter(t, Options{Requests: 60, Period: time.Minute, Burst: 3}, store)
+
+	for i := range 3 {
+		result, err := l.Take(context.Background(), "basic:wallet", false)
+		if err != nil {
+			t.Fatalf("Take failed: %v", err)
+		}
+		if !result.Allowed || result.Remaining != 2-i {
+			t.Fatalf("Request %d: expected allowed with %d remaining, got %+v", i, 2-i, result)
+		}
+	}
+
+	result, _ := l.Take(context.Background(), "basic:wallet", false)
+	if result.Allowed || result.RetryAfter != time.Second || result.Reset != 3*time.Second {
+		t.Fatalf("Expected rejection with 1s retry and 3s reset, got %+v", result)
+	}
+
+	if other, _ := l.Take(context.Background(), "ip:10.0.0.1", false); !other.Allowed {
+		t.Errorf("Expected another client to have its own limit")
+	}
+
+	now = now.Add(time.Second)
+	if result, _ := l.Take(context.Background(), "basic:wallet", false); !result.Allowed {
+		t.Errorf("Expected a request to be allowed after one interval, got %+v", result)
+	}
+}
+
+func TestTake_CacheHitsCostLess(t *testing.T) {
+	store := NewMemory()
+	now := time.Date(2026, 3, 10, 12, 0, 0, 0, time.UTC)
+	store.now = func() time.Time { return now }
+	l := newTestLimiter(t, Options{Requests: 1, Period: time.Second, Burst: 1, HitCost: 0.25}, store)
+
+	for i := range 4 {
+		if result, _ := l.Take(context.Background(), "client", true); !result.Allowed {
+			t.Fatalf("Expected hit %d to be allowed, got %+v", i, result)
+		}
+	}
+	if result, _ := l.Take(context.Background(), "client", true); result.Allowed {
+		t.Errorf("Expected the fifth hit to exceed the burst, got %+v", result)
+	}
+}
+
+func TestKeyDB_SharesLimitBetweenLimiters(t *testing.T) {
+	server := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: server.Addr()})
+	defer client.Close()
+
+	opts := Options{Requests: 2, Period: time.Hour}
+	first := newTestLimiter(t, opts, NewKeyDB(client))
+	second := newTestLimiter(t, opts, NewKeyDB(client))
+
+	for i, l := range []*Limiter{first, second} {
+		result, err := l.Take(context.Background(), "client", false)
+		if err != nil {
+			t.Fatalf("Take failed: %v", err)
+		}
+		if !result.Allowed || result.Remaining != 1-i {
+			t.Fatalf("Request %d: expected allowed with %d remaining, got %+v", i, 1-i, result)
+		}
+	}
+
+	result, err := first.Take(context.Background(), "client", false)
+	if err != nil {
+		t.Fatalf("Take failed: %v", err)
+	}
+	if result.Allowed || result.RetryAfter <= 0 || result.RetryAfter > 30*time.Minute {
+		t.Errorf("Expected rejection within one interval, got %+v", result)
+	}
+	if ttl := server.TTL(keyPrefix + "client"); ttl <= 0 || ttl > time.Hour {
+		t.Errorf("Expected client state to expire once restored, got TTL %s", ttl)
+	}
+}
+
+func TestKeyDB_FreeCacheHitsFromIdleClients(t *testing.T) {
+	server := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: server.Addr()})
+	defer client.Close()
+
+	l := newTestLimiter(t, Options{Requests: 1, Period: time.Second, HitCost: 0}, NewKeyDB(client))
+	for i := range 3 {
+		result, err := l.Take(context.Background(), "client", true)
+		if err != nil {
+			t.Fatalf("Hit %d: take failed: %v", i, err)
+		}
+		if !result.Allowed || result.Remaining != 1 {
+			t.Fatalf("Hit %d: expected allowed at no cost, got %+v", i, result)
+		}
+	}
+	if server.Exists(keyPrefix + "client") {
+		t.Error("Expected no state stored for free requests")
+	}
+	if result, err := l.Take(context.Background(), "client", false); err != nil || !result.Allowed {
+		t.Errorf("Expected a miss to be allowed, got %+v and %v", result, err)
+	}
+}
+
+func TestNew_RejectsInvalidOptions(t *testing.T) {
+	for _, opts := range []Options{
+		{Requests: 0, Period: time.Minute},
+		{Requests: 10},
+		{Requests: 10, Period: time.Minute, HitCost: 2},
+	} {
+		if _, err := New(opts, NewMemory()); err == nil {
+			t.Errorf("Expected an error for %+v", opts)
+		}
+	}
+}
@@ -0,0 +1,160 @@
+package redact
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// Placeholder replaces redacted secrets
+const Placeholder = "[REDACTED]"
+
+// Redactor replaces known secrets such as Alchemy API keys in strings, errors
+// and log output
+type Redactor struct {
+	replacer *strings.Replacer
+	secrets  []string
+}
+
+// New creates a Redactor for the given secrets. Empty secrets are ignored.
+func New(secrets ...string) *Redactor {
+	var kept []string
+	for _, secret := range secrets {
+		if secret != "" {
+			kept = append(kept, secret)
+		}
+	}
+	// Longer secrets first so a key containing another is replaced whole
+	sort.Slice(kept, func(i, j int) bool { return len(kept[i]) > len(kept[j]) })
+
+	pairs := make([]string, 0, 2*len(kept))
+	for _, secret := range kept {
+		pairs = append(pairs, secret, Placeholder)
+	}
+	return &Redactor{replacer: strings.NewReplacer(pairs...), secrets: kept}
+}
+
+// String returns s with every secret replaced
+func (r *Redactor) String(s string) string {
+	if len(r.secrets) == 0 {
+		return s
+	}
+	return r.replacer.Replace(s)
+}
+
+// contains reports whether s holds any secret
+func (r *Redactor) contains(s string) bool {
+	for _, secret := range r.secrets {
+		if strings.Contains(s, secret) {
+			return true
+		}
+	}
+	return false
+}
+
+// Error returns err with secrets removed from its message. The result still
+// unwraps to err, so errors.Is and errors.As keep working, but callers must
+// not print the unwrapped errors.
+func (r *Redactor) Error(err error) error {
+	if err == nil {
+		return nil
+	}
+	msg := err.Error()
+	if !r.contains(msg) {
+		return err
+	}
+	return &redactedError{msg: r.String(msg), err: err}
+}
+
+type redactedError struct {
+	msg string
+	err error
+}
+
+func (e *redactedError) Error() string {
+	return e.msg
+}
+
+func (e *redactedError) Unwrap() error {
+	return e.err
+}
+
+// WrapCore returns a core that removes secrets from log messages, stack
+// traces and fields before they reach core. Use it with zap.WrapCore.
+func (r *Redactor) WrapCore(core zapcore.Core) zapcore.Core {
+	if len(r.secrets) == 0 {
+		return core
+	}
+	return &redactingCore{Core: core, redactor: r}
+}
+
+type redactingCore struct {
+	zapcore.Core
+	redactor *Redactor
+}
+
+func (c *redactingCore) With(fields []zapcore.Field) zapcore.Core {
+	return &redactingCore{Core: c.Core.With(c.redactor.fields(fields)), redactor: c.redactor}
+}
+
+// Check lets the wrapped core decide, so a sampler below keeps dropping
+// entries, but has the entry written through this core so it is redacted
+func (c *redactingCore) Check(entry zapcore.Entry, checked *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	if c.Core.Check(entry, nil) != nil {
+		return checked.AddCore(entry, c)
+	}
+	return checked
+}
+
+func (c *redactingCore) Write(entry zapcore.Entry, fields []zapcore.Field) error {
+	entry.Message = c.redactor.String(entry.Message)
+	entry.Stack = c.redactor.String(entry.Stack)
+	return c.Core.Write(entry, c.redactor.fields(fields))
+}
+
+// fields returns fields with secrets removed. Fields that are not plain
+// strings are rendered to check them and replaced by a redacted string
+// rendering only if they hold a secret.
+func (r *Redactor) fields(fields []zapcore.Field) []zapcore.Field {
+	redacted := make([]zapcore.Field, len(fields))
+	for i, f := range fields {
+		redacted[i] = r.field(f)
+	}
+	return redacted
+}
+
+func (r *Redactor) field(f zapcore.Field) zapcore.Field {
+	switch f.Type {
+	case zapcore.StringType:
+		f.String = r.String(f.String)
+		return f
+	case zapcore.ErrorType:
+		if err, ok := f.Interface.(error); ok && r.contains(err.Error()) {
+			return zap.String(f.Key, r.String(err.Error()))
+		}
+		return f
+	case zapcore.StringerType:
+		if s, ok := f.Interface.(fmt.Stringer); ok && r.contains(s.String()) {
+			return zap.String(f.Key, r.String(s.String()))
+		}
+		return f
+	case zapcore.ByteStringType, zapcore.ReflectType,
+		zapcore.ObjectMarshalerType, zapcore.ArrayMarshalerType, zapcore.InlineMarshalerType:
+		enc := zapcore.NewMapObjectEncoder()
+		f.AddTo(enc)
+		rendered, err := json.Marshal(enc.Fields)
+		if err != nil {
+			return zap.String(f.Key, Placeholder)
+		}
+		if r.contains(string(rendered)) {
+			return zap.String(f.Key, r.String(string(rendered)))
+		}
+		return f
+	default:
+		return f
+	}
+}
@@ -0,0 +1,93 @@
+package redact
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+const testKey = "alchemy-secret-key"
+
+type upstreamRequest struct {
+	URL string
+}
+
+func TestRedactor_Error(t *testing.T) {
+	r := New(testKey)
+	err := fmt.Errorf("request failed: %w", &url.Error{
+		Op:  "Get",
+		URL: "https://eth-mainnet.g.alchemy.com/nft/v3/" + testKey + "/getNFTsForOwner",
+		Err: context.DeadlineExceeded,
+	})
+
+	redacted := r.Error(err)
+	if strings.Contains(redacted.Error(), testKey) {
+		t.Errorf("Expected key to be redacted, got %q", redacted.Error())
+	}
+	if !strings.Contains(redacted.Error(), Placeholder) {
+		t.Errorf("Expected placeholder in %q", redacted.Error())
+	}
+	if !errors.Is(redacted, context.DeadlineExceeded) {
+		t.Error("Expected redacted error to keep its chain for errors.Is")
+	}
+
+	plain := errors.New("unsupported chain")
+	if r.Error(plain) != plain {
+		t.Error("Expected errors without secrets to be returned unchanged")
+	}
+}
+
+func TestRedactor_WrapCore(t *testing.T) {
+	core, logs := observer.New(zap.DebugLevel)
+	logger := zap.New(New(testKey, "").WrapCore(core))
+
+	upstreamURL := "https://eth-mainnet.g.alchemy.com/nft/v3/" + testKey + "/getNFTsForOwner"
+	parsed, _ := url.Parse(upstreamURL)
+
+	logger.With(zap.String("base", upstreamURL)).Error("Request to "+upstreamURL+" failed",
+		zap.String("url", upstreamURL),
+		zap.Error(&url.Error{Op: "Get", URL: upstreamURL, Err: errors.New("timeout")}),
+		zap.Stringer("parsed", parsed),
+		zap.Any("request", upstreamRequest{URL: upstreamURL}),
+		zap.ByteString("raw", []byte(upstreamURL)),
+		zap.Int("attempt", 3),
+	)
+
+	entries := logs.All()
+	if len(entries) != 1 {
+		t.Fatalf("Expected 1 log entry, got %d", len(entries))
+	}
+	if rendered := fmt.Sprint(entries[0].Message, entries[0].ContextMap()); strings.Contains(rendered, testKey) {
+		t.Errorf("Expected no API key in log output, got %s", rendered)
+	}
+	if entries[0].ContextMap()["attempt"] != int64(3) {
+		t.Error("Expected fields without secrets to be kept as is")
+	}
+}
+
+func TestRedactor_WrapCoreKeepsSampling(t *testing.T) {
+	core, logs := observer.New(zap.DebugLevel)
+	// Like zap.NewProduction: the first entry of a message per tick, none after
+	sampled := zapcore.NewSamplerWithOptions(core, time.Hour, 1, 0)
+	logger := zap.New(New(testKey).WrapCore(sampled))
+
+	for range 3 {
+		logger.Warn("Request failed", zap.String("url", "https://eth-mainnet.g.alchemy.com/nft/v3/"+testKey))
+	}
+
+	entries := logs.All()
+	if len(entries) != 1 {
+		t.Fatalf("Expected sampling to keep 1 of 3 entries, got %d", len(entries))
+	}
+	if got := entries[0].ContextMap()["url"].(string); strings.Contains(got, testKey) {
+		t.Errorf("Expected the sampled entry to be redacted, got %s", got)
+	}
+}
@@ -0,0 +1,203 @@
+// Package signedurl signs and verifies expiring request URLs, so NFT queries
+// can be shared, e.g. embedded in web pages, without client credentials.
+package signedurl
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"nft-proxy/internal/metrics"
+)
+
+// Query parameters of a signed URL
+const (
+	// ParamExpires is the Unix time after which the URL is rejected
+	ParamExpires = "expires"
+	// ParamScope, when present, additionally restricts the URL to a
+	// canonical chain and endpoint, e.g. "eth-mainnet:getNFTsForOwner"
+	ParamScope = "scope"
+	// ParamSignature is the base64url HMAC-SHA256 of the URL
+	ParamSignature = "sig"
+)
+
+// Errors returned by Verify and Authorize
+var (
+	ErrInvalidSignature = errors.New("invalid URL signature")
+	ErrExpired          = errors.New("signed URL expired")
+	ErrOutOfScope       = errors.New("request outside the signed URL's scope")
+)
+
+// Grant is what a verified URL authorizes
+type Grant struct {
+	ExpiresAt time.Time
+	// Scope is the URL's scope, "" for unscoped URLs
+	Scope string
+	// Chain and Endpoint restrict a scoped URL; "" allows any
+	Chain    string
+	Endpoint string
+}
+
+// Signer signs URLs with the first of its keys and verifies them with any,
+// so keys can be rotated without breaking URLs already handed out
+type Signer struct {
+	keys    [][]byte
+	maxTTL  time.Duration
+	metrics *metrics.SignedURLMetrics
+	now     func() time.Time
+}
+
+// New creates a signer. maxTTL bounds the lifetime of minted URLs; zero
+// leaves it unbounded.
+func New(keys []string, maxTTL time.Duration) (*Signer, error) {
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("signed URLs need at least one key")
+	}
+	s := &Signer{maxTTL: maxTTL, metrics: metrics.NewSignedURLMetrics(), now: time.Now}
+	for _, key := range keys {
+		s.keys = append(s.keys, []byte(key))
+	}
+	return s, nil
+}
+
+// Signed reports whether a query carries a URL signature
+func Signed(query url.Values) bool {
+	return query.Has(ParamSignature)
+}
+
+// HasSignature reports whether a raw query names the signature parameter in
+// any pair, including malformed pairs that url.ParseQuery drops but a proxy
+// in front may have taken for a signature
+func HasSignature(rawQuery string) bool {
+	pairs := strings.FieldsFunc(rawQuery, func(r rune) bool { return r == '&' || r == ';' })
+	for _, pair := range pairs {
+		key, _, _ := strings.Cut(pair, "=")
+		if unescaped, err := url.QueryUnescape(key); err == nil {
+			key = unescaped
+		}
+		if key == ParamSignature {
+			return true
+		}
+	}
+	return false
+}
+
+// Strip removes the signature parameters from a query
+func Strip(query url.Values) {
+	query.Del(ParamExpires)
+	query.Del(ParamScope)
+	query.Del(ParamSignature)
+}
+
+// Sign returns u with an expiry ttl from now and a signature over its path
+// and query added. A scope further restricts the URL to a chain and
+// endpoint.
+func (s *Signer) Sign(u *url.URL, ttl time.Duration, scope string) (*url.URL, time.Time, error) {
+	if ttl <= 0 {
+		return nil, time.Time{}, fmt.Errorf("ttl must be positive")
+	}
+	if s.maxTTL > 0 && ttl > s.maxTTL {
+		return nil, time.Time{}, fmt.Errorf("ttl %s exceeds the maximum of %s", ttl, s.maxTTL)
+	}
+	if scope != "" {
+		if _, _, err := parseScope(scope); err != nil {
+			return nil, time.Time{}, err
+		}
+	}
+
+	expiresAt := s.now().Add(ttl).Truncate(time.Second)
+	query := u.Query()
+	Strip(query)
+	query.Set(ParamExpires, strconv.FormatInt(expiresAt.Unix(), 10))
+	if scope != "" {
+		query.Set(ParamScope, scope)
+	}
+	query.Set(ParamSignature, sign(s.keys[0], u.Path, query))
+
+	signed := *u
+	signed.RawQuery = query.Encode()
+	return &signed, expiresAt, nil
+}
+
+// Verify checks the signature and expiry of a request URL
+func (s *Signer) Verify(u *url.URL) (*Grant, error) {
+	query := u.Query()
+	signature, err := base64.RawURLEncoding.DecodeString(query.Get(ParamSignature))
+	if err != nil || len(signature) == 0 {
+		s.metrics.OnRequest("invalid")
+		return nil, ErrInvalidSignature
+	}
+
+	valid := false
+	for _, key := range s.keys {
+		expected, _ := base64.RawURLEncoding.DecodeString(sign(key, u.Path, query))
+		if hmac.Equal(signature, expected) {
+			valid = true
+			break
+		}
+	}
+	expires, err := strconv.ParseInt(query.Get(ParamExpires), 10, 64)
+	if !valid || err != nil {
+		s.metrics.OnRequest("invalid")
+		return nil, ErrInvalidSignature
+	}
+
+	grant := &Grant{ExpiresAt: time.Unix(expires, 0), Scope: query.Get(ParamScope)}
+	if grant.Scope != "" {
+		if grant.Chain, grant.Endpoint, err = parseScope(grant.Scope); err != nil {
+			s.metrics.OnRequest("invalid")
+			return nil, ErrInvalidSignature
+		}
+	}
+	if !s.now().Before(grant.ExpiresAt) {
+		s.metrics.OnRequest("expired")
+		return nil, ErrExpired
+	}
+	s.metrics.OnRequest("valid")
+	return grant, nil
+}
+
+// Authorize returns ErrOutOfScope if a grant does not cover a request for
+// endpoint on a canonical chain such as "eth-mainnet"
+func (s *Signer) Authorize(g *Grant, chain, endpoint string) error {
+	if matches(g.Chain, chain) && matches(g.Endpoint, endpoint) {
+		return nil
+	}
+	s.metrics.OnRequest("out_of_scope")
+	return ErrOutOfScope
+}
+
+// sign returns the signature of a URL over its path and its query, with the
+// expiry and scope but without the signature, sorted by parameter
+func sign(key []byte, path string, query url.Values) string {
+	signed := url.Values{}
+	for name, values := range query {
+		if name != ParamSignature {
+			signed[name] = values
+		}
+	}
+
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte("v1\n" + path + "\n" + signed.Encode()))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// parseScope splits a "<chain>:<endpoint>" scope. Wildcards are rejected so
+// a leaked URL never grants more than one chain and endpoint.
+func parseScope(scope string) (chain, endpoint string, err error) {
+	chain, endpoint, ok := strings.Cut(scope, ":")
+	if !ok || chain == "" || endpoint == "" || strings.Contains(scope, "*") {
+		return "", "", fmt.Errorf("invalid scope %q, expected <chain>:<endpoint> such as eth-mainnet:getNFTsForOwner", scope)
+	}
+	return chain, endpoint, nil
+}
+
+func matches(scoped, value string) bool {
+	return scoped == "" || strings.EqualFold(scoped, value)
+}
@@ -0,0 +1,139 @@
+package signedurl
+
+import (
+	"errors"
+	"net/url"
+	"testing"
+	"time"
+)
+
+func newTestSigner(t *testing.T, keys []string, now time.Time) *Signer {
+	t.Helper()
+
+	s, err := New(keys, 24*time.Hour)
+	if err != nil {
+		t.Fatalf("Failed to create signer: %v", err)
+	}
+	s.now = func() time.Time { return now }
+	return s
+}
+
+func mustSign(t *testing.T, s *Signer, rawURL string, ttl time.Duration, scope string) *url.URL {
+	t.Helper()
+
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		t.Fatalf("Failed to parse URL: %v", err)
+	}
+	signed, _, err := s.Sign(u, ttl, scope)
+	if err != nil {
+		t.Fatalf("Failed to sign URL: %v", err)
+	}
+	return signed
+}
+
+func TestVerify_RejectsTamperedAndExpiredURLs(t *testing.T) {
+	now := time.Unix(1_800_000_000, 0)
+	s := newTestSigner(t, []string{"key"}, now)
+	signed := mustSign(t, s, "/eth/mainnet/nft/v3/getNFTsForOwner?owner=0x1", time.Hour, "")
+
+	if _, err := s.Verify(signed); err != nil {
+		t.Fatalf("Expected signed URL to verify, got %v", err)
+	}
+
+	tamper := func(param, value string) *url.URL {
+		u := *signed
+		query := u.Query()
+		query.Set(param, value)
+		u.RawQuery = query.Encode()
+		return &u
+	}
+	otherPath := *signed
+	otherPath.Path = "/eth/mainnet/nft/v3/getOwnersForContract"
+
+	for name, u := range map[string]*url.URL{
+		"query":     tamper("owner", "0x2"),
+		"expiry":    tamper(ParamExpires, "1900000000"),
+		"scope":     tamper(ParamScope, "*:*"),
+		"signature": tamper(ParamSignature, "AAAA"),
+		"path":      &otherPath,
+	} {
+		if _, err := s.Verify(u); !errors.Is(err, ErrInvalidSignature) {
+			t.Errorf("Tampered %s: expected ErrInvalidSignature, got %v", name, err)
+		}
+	}
+
+	s.now = func() time.Time { return now.Add(time.Hour) }
+	if _, err := s.Verify(signed); !errors.Is(err, ErrExpired) {
+		t.Errorf("Expected ErrExpired, got %v", err)
+	}
+}
+
+func TestVerify_ScopedURLIsBoundToItsQuery(t *testing.T) {
+	now := time.Unix(1_800_000_000, 0)
+	s := newTestSigner(t, []string{"key"}, now)
+	signed := mustSign(t, s, "/eth/mainnet/nft/v3/getNFTsForOwner?owner=0x1", time.Hour, "eth-mainnet:getNFTsForOwner")
+
+	grant, err := s.Verify(signed)
+	if err != nil {
+		t.Fatalf("Expected scoped URL to verify, got %v", err)
+	}
+	if err := s.Authorize(grant, "eth-mainnet", "getNFTsForOwner"); err != nil {
+		t.Errorf("Expected request in scope to be authorized, got %v", err)
+	}
+	if err := s.Authorize(grant, "polygon-mainnet", "getNFTsForOwner"); !errors.Is(err, ErrOutOfScope) {
+		t.Errorf("Expected ErrOutOfScope for another chain, got %v", err)
+	}
+
+	// The scope narrows the URL; it does not free its query
+	other := *signed
+	query := other.Query()
+	query.Set("owner", "0x2")
+	other.RawQuery = query.Encode()
+	if _, err := s.Verify(&other); !errors.Is(err, ErrInvalidSignature) {
+		t.Errorf("Expected a scoped URL with another owner to be rejected, got %v", err)
+	}
+}
+
+func TestHasSignature_SeesMalformedPairs(t *testing.T) {
+	for query, want := range map[string]bool{
+		"owner=0x1":          false,
+		"owner=0x1&sig=abc":  true,
+		"sig=abc;x":          true,
+		"sig=%zz":            true,
+		"%73ig=abc":          true,
+		"signature=abc&a=%z": false,
+	} {
+		if got := HasSignature(query); got != want {
+			t.Errorf("HasSignature(%q) = %v, want %v", query, got, want)
+		}
+	}
+}
+
+func TestVerify_AcceptsRotatedKeys(t *testing.T) {
+	now := time.Unix(1_800_000_000, 0)
+	old := newTestSigner(t, []string{"old"}, now)
+	signed := mustSign(t, old, "/eth/mainnet/nft/v3/getNFTsForOwner?owner=0x1", time.Hour, "")
+
+	rotated := newTestSigner(t, []string{"new", "old"}, now)
+	if _, err := rotated.Verify(signed); err != nil {
+		t.Errorf("Expected URL signed with the previous key to verify, got %v", err)
+	}
+}
+
+func TestSign_RejectsInvalidRequests(t *testing.T) {
+	s := newTestSigner(t, []string{"key"}, time.Unix(1_800_000_000, 0))
+	u, _ := url.Parse("/eth/mainnet/nft/v3/getNFTsForOwner")
+
+	if _, _, err := s.Sign(u, 48*time.Hour, ""); err == nil {
+		t.Error("Expected a TTL above the maximum to be rejected")
+	}
+	if _, _, err := s.Sign(u, time.Hour, "eth-mainnet"); err == nil {
+		t.Error("Expected a scope without an endpoint to be rejected")
+	}
+	for _, scope := range []string{"*:*", "eth-mainnet:*", "*:getNFTsForOwner"} {
+		if _, _, err := s.Sign(u, time.Hour, scope); err == nil {
+			t.Errorf("Expected wildcard scope %q to be rejected", scope)
+		}
+	}
+}
@@ -0,0 +1,141 @@
+// Package snapshot writes and reads cache snapshots: gzip compressed JSON
+// lines, a header followed by one record per entry.
+package snapshot
+
+import (
+	"bufio"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"nft-proxy/internal/cache"
+)
+
+// Format identifies snapshot files in their header
+const Format = "nft-proxy-cache-snapshot"
+
+// Version is the snapshot format version written. Readers reject other
+// versions.
+const Version = 1
+
+// ContentType is the media type of snapshot files
+const ContentType = "application/gzip"
+
+// maxRecordBytes bounds one record, which holds a base64 encoded body
+const maxRecordBytes = 64 << 20
+
+// header is the first line of a snapshot
+type header struct {
+	Format    string    `json:"format"`
+	Version   int       `json:"version"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// record is one cache entry. TTL is the time the entry had left when the
+// snapshot was created.
+type record struct {
+	Key             string    `json:"key"`
+	StatusCode      int       `json:"status_code"`
+	ContentType     string    `json:"content_type,omitempty"`
+	ContentEncoding string    `json:"content_encoding,omitempty"`
+	StoredAt        time.Time `json:"stored_at"`
+	TTL             float64   `json:"ttl_seconds"`
+	Tags            []string  `json:"tags,omitempty"`
+	Body            []byte    `json:"body"`
+}
+
+// Stats reports what a snapshot export or import covered
+type Stats struct {
+	Entries int `json:"entries"`
+	// Skipped counts imported entries that had expired or that no tier
+	// stored
+	Skipped int   `json:"skipped"`
+	Bytes   int64 `json:"bytes"`
+}
+
+// Export writes every unexpired entry of c to w
+func Export(ctx context.Context, c *cache.Cache, w io.Writer) (Stats, error) {
+	var stats Stats
+	now := time.Now()
+
+	gz := gzip.NewWriter(w)
+	enc := json.NewEncoder(gz)
+	if err := enc.Encode(header{Format: Format, Version: Version, CreatedAt: now}); err != nil {
+		return stats, err
+	}
+
+	err := c.Range(ctx, func(key string, entry *cache.Entry) error {
+		stats.Entries++
+		stats.Bytes += entry.Size()
+		return enc.Encode(record{
+			Key:             key,
+			StatusCode:      entry.StatusCode,
+			ContentType:     entry.ContentType,
+			ContentEncoding: entry.ContentEncoding,
+			StoredAt:        entry.StoredAt,
+			TTL:             entry.ExpiresAt.Sub(now).Seconds(),
+			Tags:            entry.Tags,
+			Body:            entry.Body,
+		})
+	})
+	if err != nil {
+		return stats, err
+	}
+	return stats, gz.Close()
+}
+
+// Import loads the entries of a snapshot into c. Remaining TTLs count from
+// the snapshot's creation, so entries that have expired since are skipped.
+func Import(ctx context.Context, c *cache.Cache, r io.Reader) (Stats, error) {
+	var stats Stats
+
+	gz, err := gzip.NewReader(r)
+	if err != nil {
+		return stats, fmt.Errorf("not a snapshot file: %w", err)
+	}
+	defer gz.Close()
+
+	scanner := bufio.NewScanner(gz)
+	scanner.Buffer(make([]byte, 0, 64<<10), maxRecordBytes)
+	if !scanner.Scan() {
+		return stats, fmt.Errorf("not a snapshot file: %w", errors.Join(errors.New("missing header"), scanner.Err()))
+	}
+	var h header
+	if err := json.Unmarshal(scanner.Bytes(), &h); err != nil || h.Format != Format {
+		return stats, errors.New("not a snapshot file: invalid header")
+	}
+	if h.Version != Version {
+		return stats, fmt.Errorf("unsupported snapshot version %d, expected %d", h.Version, Version)
+	}
+
+	for scanner.Scan() {
+		if err := ctx.Err(); err != nil {
+			return stats, err
+		}
+		var rec record
+		if err := json.Unmarshal(scanner.Bytes(), &rec); err != nil {
+			return stats, fmt.Errorf("invalid snapshot record: %w", err)
+		}
+
+		entry := &cache.Entry{
+			Body:            rec.Body,
+			StatusCode:      rec.StatusCode,
+			ContentType:     rec.ContentType,
+			ContentEncoding: rec.ContentEncoding,
+			StoredAt:        rec.StoredAt,
+			ExpiresAt:       h.CreatedAt.Add(time.Duration(rec.TTL * float64(time.Second))),
+			Tags:            rec.Tags,
+		}
+		if !c.Load(ctx, rec.Key, entry) {
+			stats.Skipped++
+			continue
+		}
+		stats.Entries++
+		stats.Bytes += entry.Size()
+	}
+	return stats, scanner.Err()
+}
@@ -0,0 +1,75 @@
+package snapshot
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+
+	"nft-proxy/internal/cache"
+)
+
+func TestExportImport_RoundTrip(t *testing.T) {
+	ctx := context.Background()
+	rules := cache.Rules{Default: cache.Rule{TTL: time.Hour}}
+	source := cache.New(zap.NewNop(), rules, cache.NewMemory(10, 0))
+	source.Set(ctx, "nft:v1:eth-mainnet:getNFTsForOwner:a", "getNFTsForOwner", &cache.Entry{
+		StatusCode:      http.StatusOK,
+		Body:            []byte("compressed"),
+		ContentEncoding: "gzip",
+		Tags:            []string{cache.OwnerTag("0x1")},
+	})
+	source.Load(ctx, "nft:v1:eth-mainnet:getNFTsForOwner:b", &cache.Entry{
+		StatusCode: http.StatusOK,
+		Body:       []byte("{}"),
+		StoredAt:   time.Now(),
+		ExpiresAt:  time.Now().Add(50 * time.Millisecond),
+	})
+
+	var buf bytes.Buffer
+	stats, err := Export(ctx, source, &buf)
+	if err != nil || stats.Entries != 2 {
+		t.Fatalf("Expected 2 entries exported, got %+v (err %v)", stats, err)
+	}
+
+	// b expires between export and import
+	time.Sleep(100 * time.Millisecond)
+
+	target := cache.New(zap.NewNop(), rules, cache.NewMemory(10, 0))
+	stats, err = Import(ctx, target, &buf)
+	if err != nil || stats.Entries != 1 || stats.Skipped != 1 {
+		t.Fatalf("Expected 1 entry imported and 1 skipped, got %+v (err %v)", stats, err)
+	}
+
+	entry, _, ok := target.Get(ctx, "nft:v1:eth-mainnet:getNFTsForOwner:a", "getNFTsForOwner")
+	if !ok || string(entry.Body) != "compressed" || entry.ContentEncoding != "gzip" {
+		t.Fatalf("Expected imported entry, got %+v", entry)
+	}
+	if remaining := time.Until(entry.ExpiresAt); remaining <= 59*time.Minute || remaining > time.Hour {
+		t.Errorf("Expected the remaining TTL to be kept, got %s", remaining)
+	}
+	if results := target.PurgeTag(ctx, cache.OwnerTag("0x1")); results[0].Purged != 1 {
+		t.Error("Expected imported entry to keep its tags")
+	}
+}
+
+func TestImport_RejectsOtherFormats(t *testing.T) {
+	target := cache.New(zap.NewNop(), cache.Rules{}, cache.NewMemory(10, 0))
+
+	if _, err := Import(context.Background(), target, strings.NewReader("plain text")); err == nil {
+		t.Error("Expected uncompressed input to be rejected")
+	}
+
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	gz.Write([]byte(`{"format":"nft-proxy-cache-snapshot","version":99}` + "\n"))
+	gz.Close()
+	if _, err := Import(context.Background(), target, &buf); err == nil || !strings.Contains(err.Error(), "version 99") {
+		t.Errorf("Expected unsupported version to be rejected, got %v", err)
+	}
+}
@@ -0,0 +1,271 @@
+// Package spam filters spam and scam collections out of NFT API responses,
+// using a hot-reloaded denylist and allowlist and text heuristics
+package spam
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"go.uber.org/zap"
+
+	"nft-proxy/internal/metrics"
+)
+
+// Modes of a Filter
+const (
+	// ModeFlag annotates spam items with their reason
+	ModeFlag = "flag"
+	// ModeDrop removes spam items from lists; single contracts are flagged
+	ModeDrop = "drop"
+)
+
+// Reason codes of spam items
+const (
+	// ReasonDenylisted marks a contract on the denylist
+	ReasonDenylisted = "denylisted"
+	// ReasonSuspiciousURL marks a name containing a URL, or a description
+	// linking to a URL next to a bait keyword
+	ReasonSuspiciousURL = "suspicious_url"
+)
+
+// ReasonField is the field added to flagged items
+const ReasonField = "spamReason"
+
+// shape locates the items of an endpoint's response
+type shape struct {
+	// items is the array of items, or "" when the response is one item
+	items string
+	// contract is the field of an item holding its contract, or "" when the
+	// item is a contract
+	contract string
+}
+
+// shapes lists the endpoints a Filter applies to
+var shapes = map[string]shape{
+	"getNFTsForOwner":          {items: "ownedNfts", contract: "contract"},
+	"getContractMetadata":      {},
+	"getContractMetadataBatch": {items: "contracts"},
+}
+
+// urlPattern matches links and bare domains, as scam collections put them in
+// names and descriptions
+var urlPattern = regexp.MustCompile(`(?i)https?://|www\.|\b[a-z0-9-]+\.(com|net|org|io|xyz|app|site|top|gift|link|fun|live|club|vip|claims?)\b`)
+
+// Options configures a Filter
+type Options struct {
+	// Mode is ModeFlag or ModeDrop
+	Mode string
+	// ListsFile is the YAML file holding the deny and allow lists
+	ListsFile string
+	// ReloadInterval is how often ListsFile is checked for changes
+	ReloadInterval time.Duration
+	// Heuristics enables flagging by name and description
+	Heuristics bool
+}
+
+// Filter classifies the collections in NFT API responses. Allowlisted
+// contracts are never flagged.
+type Filter struct {
+	opts    Options
+	logger  *zap.Logger
+	metrics *metrics.SpamMetrics
+
+	lists   atomic.Pointer[lists]
+	modTime time.Time
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+// New creates a filter and loads its lists. Call Start to reload them when
+// the file changes.
+func New(opts Options, logger *zap.Logger) (*Filter, error) {
+	if opts.Mode != ModeFlag && opts.Mode != ModeDrop {
+		return nil, fmt.Errorf("unknown spam filter mode %q, expected %q or %q", opts.Mode, ModeFlag, ModeDrop)
+	}
+	f := &Filter{
+		opts:    opts,
+		logger:  logger,
+		metrics: metrics.NewSpamMetrics(),
+		stop:    make(chan struct{}),
+		done:    make(chan struct{}),
+	}
+	if err := f.Reload(); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+// Start checks the lists file once per reload interval until Stop
+func (f *Filter) Start() {
+	go func() {
+		defer close(f.done)
+
+		ticker := time.NewTicker(f.opts.ReloadInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				if err := f.Reload(); err != nil {
+					f.logger.Error("Failed to reload spam lists, keeping the previous ones", zap.Error(err))
+				}
+			case <-f.stop:
+				return
+			}
+		}
+	}()
+}
+
+// Stop stops reloading
+func (f *Filter) Stop() {
+	close(f.stop)
+	<-f.done
+}
+
+// Reload loads the lists file if it changed since the last load
+func (f *Filter) Reload() error {
+	info, err := os.Stat(f.opts.ListsFile)
+	if err != nil {
+		return fmt.Errorf("failed to read spam lists: %w", err)
+	}
+	if info.ModTime().Equal(f.modTime) {
+		return nil
+	}
+
+	l, err := loadLists(f.opts.ListsFile)
+	if err != nil {
+		return err
+	}
+	f.lists.Store(l)
+	f.modTime = info.ModTime()
+	f.logger.Info("Spam lists loaded", zap.Int("deny", len(l.deny)), zap.Int("allow", len(l.allow)))
+	return nil
+}
+
+// Applies reports whether the filter rewrites responses of endpoint
+func (f *Filter) Applies(endpoint string) bool {
+	_, ok := shapes[endpoint]
+	return ok
+}
+
+// Apply flags or drops the spam items of a JSON response of endpoint on a
+// canonical chain such as "eth-mainnet". It reports whether the body changed;
+// bodies without spam are returned as is.
+func (f *Filter) Apply(chain, endpoint string, body []byte) ([]byte, bool, error) {
+	sh, ok := shapes[endpoint]
+	if !ok {
+		return body, false, nil
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(body))
+	decoder.UseNumber()
+	var doc any
+	if err := decoder.Decode(&doc); err != nil {
+		return nil, false, fmt.Errorf("failed to decode response: %w", err)
+	}
+	root, ok := doc.(map[string]any)
+	if !ok {
+		return body, false, nil
+	}
+
+	l := f.lists.Load()
+	changed := false
+	if sh.items == "" {
+		if reason := f.classify(l, chain, root, sh.contract); reason != "" {
+			f.metrics.OnItem(endpoint, reason, ModeFlag)
+			root[ReasonField] = reason
+			changed = true
+		}
+	} else if items, ok := root[sh.items].([]any); ok {
+		kept := items[:0]
+		for _, value := range items {
+			item, ok := value.(map[string]any)
+			if !ok {
+				kept = append(kept, value)
+				continue
+			}
+			reason := f.classify(l, chain, item, sh.contract)
+			if reason == "" {
+				kept = append(kept, item)
+				continue
+			}
+			changed = true
+			f.metrics.OnItem(endpoint, reason, f.opts.Mode)
+			if f.opts.Mode == ModeFlag {
+				item[ReasonField] = reason
+				kept = append(kept, item)
+			}
+		}
+		root[sh.items] = kept
+	}
+	if !changed {
+		return body, false, nil
+	}
+
+	var out bytes.Buffer
+	encoder := json.NewEncoder(&out)
+	encoder.SetEscapeHTML(false)
+	if err := encoder.Encode(root); err != nil {
+		return nil, false, fmt.Errorf("failed to encode response: %w", err)
+	}
+	return bytes.TrimSuffix(out.Bytes(), []byte{'\n'}), true, nil
+}
+
+// classify returns the reason code of a spam item, or "" for a clean one
+func (f *Filter) classify(l *lists, chain string, item map[string]any, contractField string) string {
+	contract := item
+	if contractField != "" {
+		contract, _ = item[contractField].(map[string]any)
+	}
+	address := strings.ToLower(stringField(contract, "address"))
+	if address != "" && match(l.allow, chain, address) {
+		return ""
+	}
+	if address != "" && match(l.deny, chain, address) {
+		return ReasonDenylisted
+	}
+	if !f.opts.Heuristics {
+		return ""
+	}
+
+	openSea, _ := contract["openSeaMetadata"].(map[string]any)
+	names := []string{stringField(contract, "name"), stringField(openSea, "collectionName")}
+	descriptions := []string{stringField(openSea, "description")}
+	if contractField != "" {
+		names = append(names, stringField(item, "name"))
+		descriptions = append(descriptions, stringField(item, "description"))
+	}
+	for _, name := range names {
+		if urlPattern.MatchString(name) {
+			return ReasonSuspiciousURL
+		}
+	}
+	for _, description := range descriptions {
+		if urlPattern.MatchString(description) && containsAny(strings.ToLower(description), l.keywords) {
+			return ReasonSuspiciousURL
+		}
+	}
+	return ""
+}
+
+// stringField returns a string field of a JSON object, or "" if it has none
+func stringField(object map[string]any, name string) string {
+	s, _ := object[name].(string)
+	return s
+}
+
+func containsAny(s string, words []string) bool {
+	for _, word := range words {
+		if strings.Contains(s, word) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,130 @@
+package spam
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+const ownerResponse = `{"ownedNfts":[` +
+	`{"tokenId":"1","name":"Ape","contract":{"address":"0xAAA","name":"Apes"}},` +
+	`{"tokenId":"2","name":"Free","contract":{"address":"0xBBB","name":"Claim at rewards.xyz"}},` +
+	`{"tokenId":"3","description":"Visit https://scam.example to claim","contract":{"address":"0xCCC"}},` +
+	`{"tokenId":"4","contract":{"address":"0xDDD","name":"Denied"}},` +
+	`{"tokenId":"5","contract":{"address":"0xEEE","name":"Trusted.com"}}` +
+	`],"totalCount":5}`
+
+func newTestFilter(t *testing.T, mode, lists string) (*Filter, string) {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "spam_lists.yaml")
+	if err := os.WriteFile(path, []byte(lists), 0o644); err != nil {
+		t.Fatalf("Failed to write lists: %v", err)
+	}
+	f, err := New(Options{Mode: mode, ListsFile: path, ReloadInterval: time.Hour, Heuristics: true}, zap.NewNop())
+	if err != nil {
+		t.Fatalf("Failed to create filter: %v", err)
+	}
+	return f, path
+}
+
+// reasons returns the spamReason of every item by tokenId
+func reasons(t *testing.T, body []byte) map[string]string {
+	t.Helper()
+	var resp struct {
+		OwnedNfts []struct {
+			TokenID    string `json:"tokenId"`
+			SpamReason string `json:"spamReason"`
+		} `json:"ownedNfts"`
+	}
+	if err := json.Unmarshal(body, &resp); err != nil {
+		t.Fatalf("Failed to decode filtered response: %v", err)
+	}
+	got := make(map[string]string, len(resp.OwnedNfts))
+	for _, nft := range resp.OwnedNfts {
+		got[nft.TokenID] = nft.SpamReason
+	}
+	return got
+}
+
+func TestFilter_FlagsSpamItems(t *testing.T) {
+	f, _ := newTestFilter(t, ModeFlag, "deny: [eth-mainnet:0xddd]\nallow: [0xeee]\n")
+
+	body, changed, err := f.Apply("eth-mainnet", "getNFTsForOwner", []byte(ownerResponse))
+	if err != nil || !changed {
+		t.Fatalf("Expected spam to be flagged, got changed=%v err=%v", changed, err)
+	}
+	expected := map[string]string{
+		"1": "",
+		"2": ReasonSuspiciousURL,
+		"3": ReasonSuspiciousURL,
+		"4": ReasonDenylisted,
+		"5": "",
+	}
+	got := reasons(t, body)
+	for tokenID, reason := range expected {
+		if got[tokenID] != reason {
+			t.Errorf("Token %s: expected reason %q, got %q", tokenID, reason, got[tokenID])
+		}
+	}
+
+	// The denylist entry is scoped to eth-mainnet
+	body, _, _ = f.Apply("base-mainnet", "getNFTsForOwner", []byte(ownerResponse))
+	if got := reasons(t, body); got["4"] != "" {
+		t.Errorf("Expected chain-scoped denylist entry not to apply on base-mainnet, got %q", got["4"])
+	}
+}
+
+func TestFilter_DropsSpamItems(t *testing.T) {
+	f, _ := newTestFilter(t, ModeDrop, "deny: [0xddd]\n")
+
+	body, _, err := f.Apply("eth-mainnet", "getNFTsForOwner", []byte(ownerResponse))
+	if err != nil {
+		t.Fatalf("Failed to filter: %v", err)
+	}
+	got := reasons(t, body)
+	if len(got) != 1 {
+		t.Errorf("Expected only the clean item to be kept, got %v", got)
+	}
+
+	clean := []byte(`{"address":"0xAAA","name":"Apes"}`)
+	if out, changed, _ := f.Apply("eth-mainnet", "getContractMetadata", clean); changed || string(out) != string(clean) {
+		t.Errorf("Expected clean contract to be returned as is, got %s", out)
+	}
+	if out, _, _ := f.Apply("eth-mainnet", "getContractMetadata", []byte(`{"address":"0xDDD"}`)); string(out) != `{"address":"0xDDD","spamReason":"denylisted"}` {
+		t.Errorf("Expected single contract to be flagged even in drop mode, got %s", out)
+	}
+}
+
+func TestFilter_ReloadsChangedLists(t *testing.T) {
+	f, path := newTestFilter(t, ModeFlag, "deny: []\n")
+	body := []byte(`{"contracts":[{"address":"0xAAA"}]}`)
+
+	if _, changed, _ := f.Apply("eth-mainnet", "getContractMetadataBatch", body); changed {
+		t.Fatal("Expected no spam before the reload")
+	}
+
+	if err := os.WriteFile(path, []byte("deny: [0xaaa]\n"), 0o644); err != nil {
+		t.Fatalf("Failed to write lists: %v", err)
+	}
+	later := time.Now().Add(time.Minute)
+	os.Chtimes(path, later, later)
+	if err := f.Reload(); err != nil {
+		t.Fatalf("Failed to reload: %v", err)
+	}
+	if _, changed, _ := f.Apply("eth-mainnet", "getContractMetadataBatch", body); !changed {
+		t.Error("Expected reloaded denylist to apply")
+	}
+
+	os.WriteFile(path, []byte("deny: ["), 0o644)
+	os.Chtimes(path, later.Add(time.Minute), later.Add(time.Minute))
+	if err := f.Reload(); err == nil {
+		t.Error("Expected invalid lists to be rejected")
+	}
+	if _, changed, _ := f.Apply("eth-mainnet", "getContractMetadataBatch", body); !changed {
+		t.Error("Expected previous lists to be kept after a failed reload")
+	}
+}
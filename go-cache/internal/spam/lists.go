@@ -0,0 +1,72 @@
+package spam
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// listsFile is the format of the denylist file
+type listsFile struct {
+	// Deny and Allow hold contract addresses, optionally scoped to a chain
+	// as "eth-mainnet:0x..."
+	Deny  []string `yaml:"deny"`
+	Allow []string `yaml:"allow"`
+	// Keywords mark a description linking to a URL as bait, e.g. "claim"
+	Keywords []string `yaml:"keywords"`
+}
+
+// defaultKeywords apply when the lists file sets none
+var defaultKeywords = []string{"claim", "reward", "airdrop", "voucher", "redeem", "visit"}
+
+// lists is a loaded lists file. Addresses are lowercased.
+type lists struct {
+	deny     map[string]bool
+	allow    map[string]bool
+	keywords []string
+}
+
+// loadLists reads and parses a lists file
+func loadLists(path string) (*lists, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read spam lists: %w", err)
+	}
+	var file listsFile
+	if err := yaml.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("failed to parse spam lists: %w", err)
+	}
+
+	keywords := file.Keywords
+	if keywords == nil {
+		keywords = defaultKeywords
+	}
+	l := &lists{
+		deny:     addressSet(file.Deny),
+		allow:    addressSet(file.Allow),
+		keywords: make([]string, 0, len(keywords)),
+	}
+	for _, keyword := range keywords {
+		if keyword = strings.ToLower(strings.TrimSpace(keyword)); keyword != "" {
+			l.keywords = append(l.keywords, keyword)
+		}
+	}
+	return l, nil
+}
+
+func addressSet(entries []string) map[string]bool {
+	set := make(map[string]bool, len(entries))
+	for _, entry := range entries {
+		if entry = strings.ToLower(strings.TrimSpace(entry)); entry != "" {
+			set[entry] = true
+		}
+	}
+	return set
+}
+
+// match reports whether a set holds address, on any chain or on chain
+func match(set map[string]bool, chain, address string) bool {
+	return set[address] || set[chain+":"+address]
+}
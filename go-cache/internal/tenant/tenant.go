@@ -0,0 +1,261 @@
+// Package tenant maps the client identity forwarded by nginx to a tenant and
+// enforces the tenant's policy: allowed chains and endpoints, a request rate,
+// a daily compute-unit budget and an upstream scheduling priority.
+package tenant
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/time/rate"
+
+	"nft-proxy/internal/metrics"
+)
+
+// Header carries the caller's identity, set by nginx after authentication as
+// "basic:<user>" or "jwt:<subject>". It is only trusted because the service
+// listens on a Unix socket that nginx alone can reach.
+const Header = "X-Client-Identity"
+
+// Admission results, as reported in metrics
+const (
+	ResultAllowed         = "allowed"
+	ResultForbidden       = "forbidden"
+	ResultRateLimited     = "rate_limited"
+	ResultBudgetExhausted = "budget_exhausted"
+)
+
+// ErrForbidden is returned for requests a tenant's policy does not allow
+var ErrForbidden = errors.New("request not allowed for client")
+
+// LimitedError reports a request rejected by a tenant's rate limit or budget
+// and how long the client should wait before retrying
+type LimitedError struct {
+	Result     string
+	RetryAfter time.Duration
+}
+
+func (e *LimitedError) Error() string {
+	if e.Result == ResultBudgetExhausted {
+		return "daily compute unit budget exhausted"
+	}
+	return "rate limit exceeded"
+}
+
+// Policy is the configuration of one tenant
+type Policy struct {
+	Name string
+	// Identities are the client identities of the tenant, e.g. "basic:wallet"
+	Identities []string
+	// Chains and Endpoints restrict canonical chains such as "eth-mainnet"
+	// and endpoint names such as "getNFTsForOwner"; empty allows all
+	Chains    []string
+	Endpoints []string
+	// RequestsPerSecond limits the tenant's request rate; zero disables it
+	RequestsPerSecond float64
+	Burst             int
+	// DailyComputeUnits caps the compute units spent on cache misses per UTC
+	// day; zero disables it
+	DailyComputeUnits int64
+	// Priority orders the tenant's upstream calls when requests queue
+	Priority int
+}
+
+// Options configures a Registry
+type Options struct {
+	Policies []Policy
+	// Default names the policy of unknown identities; empty rejects them
+	Default string
+	// Cost returns the compute-unit cost of an endpoint
+	Cost func(endpoint string) int
+}
+
+// Registry resolves client identities to tenants
+type Registry struct {
+	byIdentity map[string]*Tenant
+	fallback   *Tenant
+}
+
+// New creates a registry from a set of policies
+func New(opts Options) (*Registry, error) {
+	if opts.Cost == nil {
+		opts.Cost = func(string) int { return 1 }
+	}
+	tenantMetrics := metrics.NewTenantMetrics()
+
+	r := &Registry{byIdentity: make(map[string]*Tenant)}
+	names := make(map[string]*Tenant, len(opts.Policies))
+	for _, policy := range opts.Policies {
+		if policy.Name == "" {
+			return nil, fmt.Errorf("tenant policy without a name")
+		}
+		if _, ok := names[policy.Name]; ok {
+			return nil, fmt.Errorf("duplicate tenant policy %q", policy.Name)
+		}
+		if policy.RequestsPerSecond < 0 || policy.DailyComputeUnits < 0 {
+			return nil, fmt.Errorf("tenant policy %q: limits must not be negative", policy.Name)
+		}
+
+		t := newTenant(policy, opts.Cost, tenantMetrics)
+		names[policy.Name] = t
+		for _, identity := range policy.Identities {
+			if other, ok := r.byIdentity[identity]; ok {
+				return nil, fmt.Errorf("identity %q is listed by tenants %q and %q", identity, other.Name(), policy.Name)
+			}
+			r.byIdentity[identity] = t
+		}
+	}
+
+	if opts.Default != "" {
+		fallback, ok := names[opts.Default]
+		if !ok {
+			return nil, fmt.Errorf("default tenant %q is not defined", opts.Default)
+		}
+		r.fallback = fallback
+	}
+	return r, nil
+}
+
+// Resolve returns the tenant of a client identity, falling back to the
+// default tenant. It returns nil for unknown identities without a default.
+func (r *Registry) Resolve(identity string) *Tenant {
+	if t, ok := r.byIdentity[identity]; ok {
+		return t
+	}
+	return r.fallback
+}
+
+// Tenant enforces one policy. Usage is kept in memory and starts afresh when
+// the service restarts.
+type Tenant struct {
+	policy    Policy
+	chains    map[string]bool
+	endpoints map[string]bool
+	limiter   *rate.Limiter
+	cost      func(endpoint string) int
+	metrics   *metrics.TenantMetrics
+	now       func() time.Time
+
+	mu   sync.Mutex
+	day  string
+	used int64
+}
+
+func newTenant(policy Policy, cost func(string) int, tenantMetrics *metrics.TenantMetrics) *Tenant {
+	t := &Tenant{
+		policy:    policy,
+		chains:    stringSet(policy.Chains),
+		endpoints: stringSet(policy.Endpoints),
+		cost:      cost,
+		metrics:   tenantMetrics,
+		now:       time.Now,
+	}
+	if policy.RequestsPerSecond > 0 {
+		burst := policy.Burst
+		if burst < 1 {
+			burst = max(1, int(policy.RequestsPerSecond))
+		}
+		t.limiter = rate.NewLimiter(rate.Limit(policy.RequestsPerSecond), burst)
+	}
+	return t
+}
+
+// Name returns the tenant's policy name
+func (t *Tenant) Name() string {
+	return t.policy.Name
+}
+
+// Priority returns the tenant's upstream scheduling priority
+func (t *Tenant) Priority() int {
+	return t.policy.Priority
+}
+
+// Admit checks a request for endpoint on a canonical chain against the
+// tenant's allowed chains and endpoints and its rate limit. It returns
+// ErrForbidden or a *LimitedError when the request is rejected.
+func (t *Tenant) Admit(chain, endpoint string) error {
+	if (len(t.chains) > 0 && !t.chains[strings.ToLower(chain)]) ||
+		(len(t.endpoints) > 0 && !t.endpoints[strings.ToLower(endpoint)]) {
+		t.metrics.OnRequest(t.policy.Name, ResultForbidden)
+		return ErrForbidden
+	}
+
+	if t.limiter != nil {
+		now := t.now()
+		reservation := t.limiter.ReserveN(now, 1)
+		if delay := reservation.DelayFrom(now); delay > 0 {
+			reservation.CancelAt(now)
+			t.metrics.OnRequest(t.policy.Name, ResultRateLimited)
+			return &LimitedError{Result: ResultRateLimited, RetryAfter: delay}
+		}
+	}
+
+	t.metrics.OnRequest(t.policy.Name, ResultAllowed)
+	return nil
+}
+
+// AllowSpend returns a *LimitedError if the tenant's daily compute-unit
+// budget is spent, so a cache miss must not go upstream
+func (t *Tenant) AllowSpend() error {
+	if t.policy.DailyComputeUnits == 0 {
+		return nil
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	now := t.now().UTC()
+	t.rollLocked(now)
+	if t.used < t.policy.DailyComputeUnits {
+		return nil
+	}
+	t.metrics.OnRequest(t.policy.Name, ResultBudgetExhausted)
+	return &LimitedError{Result: ResultBudgetExhausted, RetryAfter: nextDay(now).Sub(now)}
+}
+
+// Record accounts one upstream call to endpoint against the tenant's budget
+func (t *Tenant) Record(endpoint string) {
+	cost := t.cost(endpoint)
+	t.metrics.OnSpend(t.policy.Name, cost)
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.rollLocked(t.now().UTC())
+	t.used += int64(cost)
+}
+
+// Used returns the compute units the tenant spent in the current UTC day
+func (t *Tenant) Used() int64 {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.rollLocked(t.now().UTC())
+	return t.used
+}
+
+// rollLocked starts a new day of usage when the UTC date changes
+func (t *Tenant) rollLocked(now time.Time) {
+	if day := now.Format(time.DateOnly); day != t.day {
+		t.day = day
+		t.used = 0
+	}
+}
+
+// nextDay returns the start of the UTC day after now
+func nextDay(now time.Time) time.Time {
+	return time.Date(now.Year(), now.Month(), now.Day()+1, 0, 0, 0, 0, time.UTC)
+}
+
+func stringSet(values []string) map[string]bool {
+	set := make(map[string]bool, len(values))
+	for _, value := range values {
+		if value = strings.ToLower(strings.TrimSpace(value)); value != "" {
+			set[value] = true
+		}
+	}
+	return set
+}
@@ -0,0 +1,138 @@
+package tenant
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func newTestRegistry(t *testing.T, opts Options) *Registry {
+	t.Helper()
+
+	registry, err := New(opts)
+	if err != nil {
+		t.Fatalf("Failed to create registry: %v", err)
+	}
+	return registry
+}
+
+func TestResolve_FallsBackToDefault(t *testing.T) {
+	registry := newTestRegistry(t, Options{
+		Policies: []Policy{
+			{Name: "public", Identities: []string{"jwt:anonymous"}},
+			{Name: "wallet", Identities: []string{"basic:wallet"}},
+		},
+		Default: "public",
+	})
+
+	if got := registry.Resolve("basic:wallet"); got == nil || got.Name() != "wallet" {
+		t.Errorf("Expected wallet tenant, got %v", got)
+	}
+	if got := registry.Resolve("basic:unknown"); got == nil || got.Name() != "public" {
+		t.Errorf("Expected unknown identity to fall back to public, got %v", got)
+	}
+
+	strict := newTestRegistry(t, Options{Policies: []Policy{{Name: "wallet", Identities: []string{"basic:wallet"}}}})
+	if got := strict.Resolve(""); got != nil {
+		t.Errorf("Expected no tenant without a default, got %q", got.Name())
+	}
+}
+
+func TestNew_RejectsInvalidPolicies(t *testing.T) {
+	tests := map[string]Options{
+		"duplicate name":      {Policies: []Policy{{Name: "a"}, {Name: "a"}}},
+		"shared identity":     {Policies: []Policy{{Name: "a", Identities: []string{"basic:x"}}, {Name: "b", Identities: []string{"basic:x"}}}},
+		"unknown default":     {Policies: []Policy{{Name: "a"}}, Default: "b"},
+		"negative rate":       {Policies: []Policy{{Name: "a", RequestsPerSecond: -1}}},
+		"missing policy name": {Policies: []Policy{{}}},
+	}
+	for name, opts := range tests {
+		if _, err := New(opts); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+}
+
+func TestAdmit_EnforcesChainsAndEndpoints(t *testing.T) {
+	registry := newTestRegistry(t, Options{Policies: []Policy{{
+		Name:       "wallet",
+		Identities: []string{"basic:wallet"},
+		Chains:     []string{"eth-mainnet"},
+		Endpoints:  []string{"getNFTsForOwner"},
+	}}})
+	tenant := registry.Resolve("basic:wallet")
+
+	if err := tenant.Admit("eth-mainnet", "getNFTsForOwner"); err != nil {
+		t.Errorf("Expected allowed request, got %v", err)
+	}
+	if err := tenant.Admit("polygon-mainnet", "getNFTsForOwner"); !errors.Is(err, ErrForbidden) {
+		t.Errorf("Expected ErrForbidden for another chain, got %v", err)
+	}
+	if err := tenant.Admit("eth-mainnet", "getOwnersForContract"); !errors.Is(err, ErrForbidden) {
+		t.Errorf("Expected ErrForbidden for another endpoint, got %v", err)
+	}
+}
+
+func TestAdmit_RateLimits(t *testing.T) {
+	registry := newTestRegistry(t, Options{Policies: []Policy{{
+		Name:              "wallet",
+		Identities:        []string{"basic:wallet"},
+		RequestsPerSecond: 1,
+		Burst:             2,
+	}}})
+	tenant := registry.Resolve("basic:wallet")
+	now := time.Date(2026, 3, 10, 12, 0, 0, 0, time.UTC)
+	tenant.now = func() time.Time { return now }
+
+	for i := 0; i < 2; i++ {
+		if err := tenant.Admit("eth-mainnet", "getNFTsForOwner"); err != nil {
+			t.Fatalf("Expected request %d within burst, got %v", i, err)
+		}
+	}
+
+	var limited *LimitedError
+	if err := tenant.Admit("eth-mainnet", "getNFTsForOwner"); !errors.As(err, &limited) {
+		t.Fatalf("Expected *LimitedError, got %v", err)
+	}
+	if limited.Result != ResultRateLimited || limited.RetryAfter != time.Second {
+		t.Errorf("Expected rate limit with 1s retry, got %q after %s", limited.Result, limited.RetryAfter)
+	}
+
+	// The rejected request did not use up the next token
+	now = now.Add(time.Second)
+	if err := tenant.Admit("eth-mainnet", "getNFTsForOwner"); err != nil {
+		t.Errorf("Expected request after refill to be allowed, got %v", err)
+	}
+}
+
+func TestAllowSpend_DailyBudgetResetsNextDay(t *testing.T) {
+	registry := newTestRegistry(t, Options{
+		Policies: []Policy{{Name: "wallet", Identities: []string{"basic:wallet"}, DailyComputeUnits: 100}},
+		Cost:     func(string) int { return 60 },
+	})
+	tenant := registry.Resolve("basic:wallet")
+	now := time.Date(2026, 3, 10, 23, 0, 0, 0, time.UTC)
+	tenant.now = func() time.Time { return now }
+
+	tenant.Record("getNFTsForOwner")
+	if err := tenant.AllowSpend(); err != nil {
+		t.Fatalf("Expected budget left, got %v", err)
+	}
+	tenant.Record("getNFTsForOwner")
+
+	var limited *LimitedError
+	if err := tenant.AllowSpend(); !errors.As(err, &limited) {
+		t.Fatalf("Expected *LimitedError, got %v", err)
+	}
+	if limited.Result != ResultBudgetExhausted || limited.RetryAfter != time.Hour {
+		t.Errorf("Expected budget exhausted until midnight, got %q after %s", limited.Result, limited.RetryAfter)
+	}
+
+	now = now.Add(time.Hour)
+	if err := tenant.AllowSpend(); err != nil {
+		t.Errorf("Expected budget to reset at midnight UTC, got %v", err)
+	}
+	if used := tenant.Used(); used != 0 {
+		t.Errorf("Expected no usage on the new day, got %d", used)
+	}
+}
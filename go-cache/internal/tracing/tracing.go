@@ -0,0 +1,54 @@
+package tracing
+
+import (
+	"context"
+	"fmt"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+)
+
+// Options configures trace export
+type Options struct {
+	// Endpoint is the OTLP/HTTP collector URL, e.g. http://otel-collector:4318.
+	// When empty the exporter reads the OTEL_EXPORTER_OTLP_* variables.
+	Endpoint    string
+	ServiceName string
+	// SampleRatio is the fraction of new traces recorded. Requests that
+	// arrive with a sampled traceparent are always recorded.
+	SampleRatio float64
+}
+
+// Setup installs a global tracer provider exporting spans over OTLP/HTTP and
+// the W3C trace context propagator. The returned function flushes pending
+// spans and stops the exporter.
+func Setup(ctx context.Context, opts Options) (func(context.Context) error, error) {
+	var exporterOpts []otlptracehttp.Option
+	if opts.Endpoint != "" {
+		exporterOpts = append(exporterOpts, otlptracehttp.WithEndpointURL(opts.Endpoint))
+	}
+	exporter, err := otlptracehttp.New(ctx, exporterOpts...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create OTLP exporter: %w", err)
+	}
+
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(opts.SampleRatio))),
+		sdktrace.WithResource(resource.NewSchemaless(attribute.String("service.name", opts.ServiceName))),
+	)
+
+	otel.SetTracerProvider(provider)
+	otel.SetTextMapPropagator(Propagator())
+	return provider.Shutdown, nil
+}
+
+// Propagator returns the propagator used for inbound requests: W3C
+// traceparent/tracestate and baggage
+func Propagator() propagation.TextMapPropagator {
+	return propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{})
+}
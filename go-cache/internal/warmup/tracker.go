@@ -0,0 +1,106 @@
+package warmup
+
+import (
+	"sort"
+	"sync"
+)
+
+// Tracker counts requests per cache key to find the hottest keys. Counts are
+// halved every time the top keys are taken, so keys that stop being requested
+// fade out. It holds at most capacity keys; when full, the colder half is
+// dropped.
+type Tracker struct {
+	capacity int
+
+	mu   sync.Mutex
+	keys map[string]*trackedKey
+}
+
+type trackedKey struct {
+	request Request
+	hits    float64
+}
+
+// Tracked is a hot cache key with the request that fills it
+type Tracked struct {
+	Key     string
+	Request Request
+}
+
+// NewTracker creates a tracker holding up to capacity keys
+func NewTracker(capacity int) *Tracker {
+	return &Tracker{
+		capacity: capacity,
+		keys:     make(map[string]*trackedKey),
+	}
+}
+
+// Record counts a request for key. req must not carry client credentials, as
+// it is replayed to refresh the key.
+func (t *Tracker) Record(key string, req Request) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if tracked, ok := t.keys[key]; ok {
+		tracked.hits++
+		return
+	}
+	if len(t.keys) >= t.capacity {
+		t.prune(t.capacity / 2)
+	}
+	t.keys[key] = &trackedKey{request: req, hits: 1}
+}
+
+// Top returns up to n of the most requested keys, hottest first, and decays
+// all counts
+func (t *Tracker) Top(n int) []Tracked {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	ranked := t.ranked()
+	if len(ranked) > n {
+		ranked = ranked[:n]
+	}
+	top := make([]Tracked, 0, len(ranked))
+	for _, key := range ranked {
+		top = append(top, Tracked{Key: key, Request: t.keys[key].request})
+	}
+
+	for key, tracked := range t.keys {
+		tracked.hits /= 2
+		if tracked.hits < 0.5 {
+			delete(t.keys, key)
+		}
+	}
+	return top
+}
+
+// Len returns the number of keys tracked
+func (t *Tracker) Len() int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return len(t.keys)
+}
+
+// ranked returns the tracked keys by descending count
+func (t *Tracker) ranked() []string {
+	keys := make([]string, 0, len(t.keys))
+	for key := range t.keys {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		a, b := t.keys[keys[i]].hits, t.keys[keys[j]].hits
+		if a != b {
+			return a > b
+		}
+		return keys[i] < keys[j]
+	})
+	return keys
+}
+
+// prune keeps only the keep hottest keys
+func (t *Tracker) prune(keep int) {
+	for _, key := range t.ranked()[keep:] {
+		delete(t.keys, key)
+	}
+}
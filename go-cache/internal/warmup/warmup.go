@@ -0,0 +1,219 @@
+package warmup
+
+import (
+	"context"
+	"errors"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+
+	"nft-proxy/internal/alchemy"
+	"nft-proxy/internal/budget"
+	"nft-proxy/internal/metrics"
+)
+
+// Request is a proxied NFT API request that warmup replays to fill the cache
+type Request struct {
+	Method  string
+	Chain   string
+	Network string
+	// Path is the Alchemy path such as "/getNFTsForOwner"
+	Path     string
+	RawQuery string
+	Body     []byte
+}
+
+// Fetcher fetches requests from upstream into the response cache
+type Fetcher interface {
+	Prefetch(ctx context.Context, req Request) error
+	// Remaining returns how long the cached response of req stays fresh, or
+	// 0 if it is not cached
+	Remaining(ctx context.Context, req Request) time.Duration
+}
+
+// addressPlaceholder is replaced by each seed address in request templates
+const addressPlaceholder = "{address}"
+
+// Seed lists the contracts and owners of one chain to prefetch at startup
+type Seed struct {
+	Contracts []string
+	Owners    []string
+}
+
+// Options configures a Warmer
+type Options struct {
+	// Concurrency bounds the warmup requests in flight, separately from the
+	// proxy's upstream limiter
+	Concurrency int
+	// Seeds maps chain keys such as "eth-mainnet" to addresses to prefetch
+	Seeds map[string]Seed
+	// ContractRequests and OwnerRequests are request templates such as
+	// "/getNFTsForOwner?owner={address}&withMetadata=true". They must match
+	// what clients send, since the query is part of the cache key.
+	ContractRequests []string
+	OwnerRequests    []string
+
+	// Tracker, if set, supplies the hot keys refreshed every Interval
+	Tracker  *Tracker
+	TopN     int
+	Interval time.Duration
+	// RefreshBefore is how close to expiry a hot key is refreshed
+	RefreshBefore time.Duration
+}
+
+// Warmer prefetches seed requests at startup and keeps hot keys fresh.
+// Requests go through the Alchemy client, so its compute-unit throttle and
+// budget apply to them like to any cache miss.
+type Warmer struct {
+	fetcher Fetcher
+	opts    Options
+	logger  *zap.Logger
+	metrics *metrics.WarmupMetrics
+
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+// New creates a warmer. Call Start to begin warming.
+func New(fetcher Fetcher, opts Options, logger *zap.Logger) *Warmer {
+	if opts.Concurrency <= 0 {
+		opts.Concurrency = 1
+	}
+	return &Warmer{
+		fetcher: fetcher,
+		opts:    opts,
+		logger:  logger,
+		metrics: metrics.NewWarmupMetrics(),
+		done:    make(chan struct{}),
+	}
+}
+
+// Start prefetches the seeds in the background and then, if a tracker is
+// set, refreshes hot keys every interval until Stop
+func (w *Warmer) Start() {
+	ctx, cancel := context.WithCancel(context.Background())
+	w.cancel = cancel
+
+	go func() {
+		defer close(w.done)
+
+		w.WarmSeeds(ctx)
+		if w.opts.Tracker == nil {
+			return
+		}
+
+		ticker := time.NewTicker(w.opts.Interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				w.RefreshHot(ctx)
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+}
+
+// Stop cancels warming and waits for in-flight requests to finish
+func (w *Warmer) Stop() {
+	w.cancel()
+	<-w.done
+}
+
+// WarmSeeds prefetches every seed request that is not already cached
+func (w *Warmer) WarmSeeds(ctx context.Context) {
+	requests := w.seedRequests()
+	if len(requests) == 0 {
+		return
+	}
+
+	start := time.Now()
+	w.run(ctx, "seed", requests, 0)
+	w.logger.Info("Cache warmup from seeds finished", zap.Int("requests", len(requests)), zap.Duration("duration", time.Since(start)))
+}
+
+// RefreshHot refreshes the hottest tracked keys that expire within
+// RefreshBefore
+func (w *Warmer) RefreshHot(ctx context.Context) {
+	top := w.opts.Tracker.Top(w.opts.TopN)
+	requests := make([]Request, 0, len(top))
+	for _, tracked := range top {
+		requests = append(requests, tracked.Request)
+	}
+	w.run(ctx, "hot", requests, w.opts.RefreshBefore)
+}
+
+// run prefetches requests with bounded concurrency, skipping those whose
+// cached response stays fresh for longer than minRemaining
+func (w *Warmer) run(ctx context.Context, source string, requests []Request, minRemaining time.Duration) {
+	sem := make(chan struct{}, w.opts.Concurrency)
+	var wg sync.WaitGroup
+	for _, req := range requests {
+		select {
+		case sem <- struct{}{}:
+		case <-ctx.Done():
+			wg.Wait()
+			return
+		}
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer func() { <-sem }()
+			w.metrics.OnRequest(source, w.warm(ctx, req, minRemaining))
+		}()
+	}
+	wg.Wait()
+}
+
+// warm prefetches one request and returns the result for metrics
+func (w *Warmer) warm(ctx context.Context, req Request, minRemaining time.Duration) string {
+	if w.fetcher.Remaining(ctx, req) > minRemaining {
+		return "fresh"
+	}
+
+	err := w.fetcher.Prefetch(ctx, req)
+	switch {
+	case err == nil:
+		return "ok"
+	case errors.Is(err, budget.ErrExhausted) || errors.Is(err, alchemy.ErrThrottled):
+		return "throttled"
+	case errors.Is(err, context.Canceled):
+		return "canceled"
+	default:
+		w.logger.Warn("Cache warmup request failed",
+			zap.String("chain", req.Chain+"-"+req.Network),
+			zap.String("path", req.Path),
+			zap.Error(err))
+		return "error"
+	}
+}
+
+// seedRequests expands the request templates for every seed address
+func (w *Warmer) seedRequests() []Request {
+	var requests []Request
+	for chainKey, seed := range w.opts.Seeds {
+		chain, network, _ := strings.Cut(chainKey, "-")
+		expand := func(templates, addresses []string) {
+			for _, template := range templates {
+				path, query, _ := strings.Cut(template, "?")
+				for _, address := range addresses {
+					requests = append(requests, Request{
+						Method:   "GET",
+						Chain:    chain,
+						Network:  network,
+						Path:     path,
+						RawQuery: strings.ReplaceAll(query, addressPlaceholder, url.QueryEscape(address)),
+					})
+				}
+			}
+		}
+		expand(w.opts.ContractRequests, seed.Contracts)
+		expand(w.opts.OwnerRequests, seed.Owners)
+	}
+	return requests
+}
@@ -0,0 +1,130 @@
+package warmup
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+
+	"nft-proxy/internal/budget"
+)
+
+type fakeFetcher struct {
+	mu        sync.Mutex
+	fetched   []Request
+	fresh     map[string]time.Duration
+	err       error
+	inflight  atomic.Int32
+	peak      atomic.Int32
+	fetchTime time.Duration
+}
+
+func (f *fakeFetcher) Prefetch(_ context.Context, req Request) error {
+	n := f.inflight.Add(1)
+	defer f.inflight.Add(-1)
+	for {
+		peak := f.peak.Load()
+		if n <= peak || f.peak.CompareAndSwap(peak, n) {
+			break
+		}
+	}
+	time.Sleep(f.fetchTime)
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.fetched = append(f.fetched, req)
+	return f.err
+}
+
+func (f *fakeFetcher) Remaining(_ context.Context, req Request) time.Duration {
+	return f.fresh[req.Path+"?"+req.RawQuery]
+}
+
+func TestWarmer_WarmsSeedsWithBoundedConcurrency(t *testing.T) {
+	fetcher := &fakeFetcher{
+		fresh:     map[string]time.Duration{"/getContractMetadata?contractAddress=0xc1": time.Hour},
+		fetchTime: 10 * time.Millisecond,
+	}
+	w := New(fetcher, Options{
+		Concurrency: 2,
+		Seeds: map[string]Seed{
+			"eth-mainnet":  {Contracts: []string{"0xc1", "0xc2"}, Owners: []string{"0xo1", "0xo2"}},
+			"base-mainnet": {Owners: []string{"0xo3"}},
+		},
+		ContractRequests: []string{"/getContractMetadata?contractAddress={address}"},
+		OwnerRequests:    []string{"/getNFTsForOwner?owner={address}&withMetadata=true"},
+	}, zap.NewNop())
+
+	w.WarmSeeds(context.Background())
+
+	// 0xc1 is already fresh in the cache
+	if len(fetcher.fetched) != 4 {
+		t.Fatalf("Expected 4 prefetches, got %d: %+v", len(fetcher.fetched), fetcher.fetched)
+	}
+	if peak := fetcher.peak.Load(); peak > 2 {
+		t.Errorf("Expected at most 2 concurrent prefetches, got %d", peak)
+	}
+	for _, req := range fetcher.fetched {
+		if req.Path == "/getNFTsForOwner" && req.Chain == "base" && (req.Network != "mainnet" || req.RawQuery != "owner=0xo3&withMetadata=true") {
+			t.Errorf("Unexpected expanded request %+v", req)
+		}
+	}
+}
+
+func TestWarmer_RefreshesHotKeysNearExpiry(t *testing.T) {
+	tracker := NewTracker(10)
+	for i := 0; i < 3; i++ {
+		tracker.Record("hot", Request{Path: "/getNFTsForOwner", RawQuery: "owner=0x1"})
+	}
+	tracker.Record("lukewarm", Request{Path: "/getNFTsForOwner", RawQuery: "owner=0x2"})
+	tracker.Record("lukewarm", Request{Path: "/getNFTsForOwner", RawQuery: "owner=0x2"})
+	tracker.Record("cold", Request{Path: "/getNFTsForOwner", RawQuery: "owner=0x3"})
+
+	fetcher := &fakeFetcher{
+		fresh: map[string]time.Duration{
+			"/getNFTsForOwner?owner=0x1": 10 * time.Second,
+			"/getNFTsForOwner?owner=0x2": time.Hour,
+		},
+		err: budget.ErrExhausted,
+	}
+	w := New(fetcher, Options{Concurrency: 1, Tracker: tracker, TopN: 2, RefreshBefore: time.Minute}, zap.NewNop())
+
+	w.RefreshHot(context.Background())
+
+	if len(fetcher.fetched) != 1 || fetcher.fetched[0].RawQuery != "owner=0x1" {
+		t.Errorf("Expected only the hot key near expiry to be refreshed, got %+v", fetcher.fetched)
+	}
+}
+
+func TestTracker_DecaysAndPrunes(t *testing.T) {
+	tracker := NewTracker(4)
+	for i := 0; i < 5; i++ {
+		tracker.Record("a", Request{})
+	}
+	tracker.Record("b", Request{})
+	tracker.Record("b", Request{})
+	tracker.Record("c", Request{})
+	tracker.Record("d", Request{})
+
+	// Full: the colder half goes before e is added
+	tracker.Record("e", Request{})
+	if tracker.Len() != 3 {
+		t.Fatalf("Expected 3 keys after pruning, got %d", tracker.Len())
+	}
+
+	top := tracker.Top(2)
+	if len(top) != 2 || top[0].Key != "a" || top[1].Key != "b" {
+		t.Errorf("Expected a and b as top keys, got %+v", top)
+	}
+
+	// e had a single hit and fades out after two decays
+	tracker.Top(2)
+	for _, tracked := range tracker.Top(10) {
+		if tracked.Key == "e" {
+			t.Error("Expected cold key to fade out")
+		}
+	}
+}
@@ -6,6 +6,14 @@ local auth_utils = require("utils.auth_utils")
 local token, token_source = auth_utils.extract_jwt_token()
 
 if not token then
+    -- Signed URLs carry no credentials; nft-proxy verifies their signature
+    -- and rejects tampered or expired ones. X-Auth-Signed-URL tells it the
+    -- request was let through only because of the signature.
+    if auth_utils.has_url_signature() then
+        ngx.header["X-Auth-Signed-URL"] = "1"
+        ngx.status = 200
+        ngx.exit(200)
+    end
     ngx.status = 401
     ngx.exit(401)
 end
@@ -55,6 +63,7 @@ if cached_result then
     ngx.header["X-RateLimit-Limit"] = tostring(requests_per_token)
     ngx.header["X-RateLimit-Remaining"] = tostring(requests_per_token - new_usage)
     ngx.header["X-Auth-Cache-Status"] = "HIT"
+    ngx.header["X-Auth-Subject"] = auth_utils.jwt_subject(token)
     
     ngx.status = 200
     ngx.exit(200)
@@ -90,6 +99,7 @@ if res.status == 200 then
     ngx.header["X-RateLimit-Limit"] = tostring(requests_per_token)
     ngx.header["X-RateLimit-Remaining"] = tostring(requests_per_token - 1)
     ngx.header["X-Auth-Cache-Status"] = "MISS"
+    ngx.header["X-Auth-Subject"] = auth_utils.jwt_subject(token)
     
     ngx.status = 200
     ngx.exit(200)
@@ -1,3 +1,5 @@
+local json = require("cjson")
+
 local _M = {}
 
 -- Extract JWT token from various sources (Authorization header or query parameter)
@@ -70,4 +72,49 @@ function _M.extract_jwt_token()
     return nil, nil
 end
 
+-- Check whether the client request's query carries a URL signature ("sig"),
+-- as minted by nft-proxy's /admin/signed-urls. Pairs are split on "&" and
+-- ";" alike so that malformed pairs still count; nft-proxy rejects them.
+function _M.has_url_signature()
+    local request_uri = ngx.var.request_uri
+    local query_start = request_uri and request_uri:find("?", 1, true)
+    if not query_start then
+        return false
+    end
+    for pair in string.gmatch(request_uri:sub(query_start + 1), "[^&;]+") do
+        local key, value = pair:match("([^=]+)=?(.*)")
+        if key and ngx.unescape_uri(key) == "sig" and value ~= "" then
+            return true
+        end
+    end
+    return false
+end
+
+-- Return the subject of a JWT for the client identity nginx forwards to
+-- nft-proxy, or "anonymous" when the token has none. The signature is not
+-- checked here; only call this for tokens the auth service has verified.
+function _M.jwt_subject(token)
+    local payload = token:match("^[^.]+%.([^.]+)%.")
+    if not payload then
+        return "anonymous"
+    end
+
+    -- base64url without padding to standard base64
+    payload = payload:gsub("-", "+"):gsub("_", "/")
+    local padding = #payload % 4
+    if padding > 0 then
+        payload = payload .. string.rep("=", 4 - padding)
+    end
+
+    local decoded = ngx.decode_base64(payload)
+    if not decoded then
+        return "anonymous"
+    end
+    local ok, claims = pcall(json.decode, decoded)
+    if not ok or type(claims) ~= "table" or type(claims.sub) ~= "string" or claims.sub == "" then
+        return "anonymous"
+    end
+    return claims.sub
+end
+
 return _M